@@ -21,24 +21,17 @@ import (
 	"encoding/xml"
 	"fmt"
 	"net/http"
-	"strings"
 	"time"
 
-	"google.golang.org/appengine/datastore"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/memcache"
-
-	"github.com/mjibson/goon"
+	"github.com/msde/goread/platform/log"
 )
 
 func AllFeedsOpml(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
-	q := datastore.NewQuery(gn.Kind(&Feed{})).KeysOnly()
-	keys, _ := gn.GetAll(q, nil)
-	fs := make([]*Feed, len(keys))
-	for i, k := range keys {
-		fs[i] = &Feed{Url: k.StringID()}
+	urls, _, _ := Store.FeedUrls(c, time.Time{}, Page{})
+	fs := make([]*Feed, len(urls))
+	for i, u := range urls {
+		fs[i] = &Feed{Url: u}
 	}
 	b := feedsToOpml(fs)
 	w.Header().Add("Content-Type", "text/xml")
@@ -65,56 +58,25 @@ func feedsToOpml(feeds []*Feed) []byte {
 
 func AllFeeds(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
-	q := datastore.NewQuery(gn.Kind(&Feed{})).KeysOnly()
-	keys, _ := gn.GetAll(q, nil)
-	templates.ExecuteTemplate(w, "admin-all-feeds.html", keys)
+	urls, _, _ := Store.FeedUrls(c, time.Time{}, Page{})
+	templates.ExecuteTemplate(w, "admin-all-feeds.html", urls)
 }
 
 func AdminFeed(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
-	f := Feed{Url: r.FormValue("f")}
-	if err := gn.Get(&f); err != nil {
+	f, err := Store.GetFeed(c, r.FormValue("f"))
+	if err != nil {
 		serveError(w, err)
 		return
 	}
-	q := datastore.NewQuery(gn.Kind(&Story{})).KeysOnly()
-	fk := gn.Key(&f)
-	q = q.Ancestor(fk)
-	q = q.Limit(100)
-	q = q.Order("-" + IDX_COL)
-	keys, _ := gn.GetAll(q, nil)
-	stories := make([]*Story, len(keys))
-	for j, key := range keys {
-		stories[j] = &Story{
-			Id:     key.StringID(),
-			Parent: fk,
-		}
-	}
-	gn.GetMulti(stories)
-	lk := gn.Key(&Log{Parent: fk, Id: time.Now().Add(-time.Hour * 6).UnixNano()})
-	q = datastore.NewQuery(lk.Kind()).KeysOnly()
-	q = q.Ancestor(fk)
-	q = q.Filter("__key__ >", lk)
-	keys, _ = gn.GetAll(q, nil)
-	logs := make([]*Log, len(keys))
-	for j, key := range keys {
-		logs[j] = &Log{
-			Id:     key.IntID(),
-			Parent: fk,
-		}
-	}
-	gn.GetMulti(logs)
+	stories, _, _ := Store.FeedStories(c, f.Url, StoryQuery{Page: Page{Limit: 100}})
 
 	templates.ExecuteTemplate(w, "admin-feed.html", struct {
 		Feed    *Feed
-		Logs    []*Log
 		Stories []*Story
 		Now     time.Time
 	}{
-		&f,
-		logs,
+		f,
 		stories,
 		time.Now(),
 	})
@@ -123,7 +85,7 @@ func AdminFeed(w http.ResponseWriter, r *http.Request) {
 func AdminUpdateFeed(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
 	url := r.FormValue("f")
-	if feed, stories, err := fetchFeed(c, url, url); err == nil {
+	if feed, stories, err := fetchFeed(c, url, url, nil); err == nil {
 		updateFeed(c, url, feed, stories, true, false, false)
 		fmt.Fprintf(w, "updated: %v", url)
 	} else {
@@ -133,9 +95,8 @@ func AdminUpdateFeed(w http.ResponseWriter, r *http.Request) {
 
 func AdminSubHub(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
-	f := Feed{Url: r.FormValue("f")}
-	if err := gn.Get(&f); err != nil {
+	f, err := Store.GetFeed(c, r.FormValue("f"))
+	if err != nil {
 		serveError(w, err)
 		return
 	}
@@ -146,28 +107,38 @@ func AdminSubHub(w http.ResponseWriter, r *http.Request) {
 
 func AdminDateFormats(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	type df struct {
-		URL, Format string
+	groups, err := dateFailureGroups(c)
+	if err != nil {
+		serveError(w, err)
+		return
 	}
-	keys := make([]string, dateFormatCount)
-	for i := range keys {
-		keys[i] = fmt.Sprintf("_dateformat-%v", i)
+	layout := r.FormValue("layout")
+	matched := 0
+	if layout != "" {
+		matched = testDateLayout(groups, layout)
 	}
-	items, _ := memcache.GetMulti(c, keys)
-	dfs := make(map[string]df)
-	for k, v := range items {
-		sp := strings.Split(string(v.Value), "|")
-		dfs[k] = df{sp[1], sp[0]}
+	total := 0
+	for _, g := range groups {
+		total += len(g.Samples)
 	}
-	if err := templates.ExecuteTemplate(w, "admin-date-formats.html", dfs); err != nil {
+	if err := templates.ExecuteTemplate(w, "admin-date-formats.html", struct {
+		Groups  []*dateShapeGroup
+		Layout  string
+		Matched int
+		Total   int
+	}{
+		groups,
+		layout,
+		matched,
+		total,
+	}); err != nil {
 		serveError(w, err)
 	}
 }
 
 func AdminStats(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
-	uc, _ := datastore.NewQuery(gn.Kind(&User{})).Count(c)
+	uc, _ := Store.CountUsers(c)
 	templates.ExecuteTemplate(w, "admin-stats.html", struct {
 		Users int
 	}{
@@ -175,26 +146,38 @@ func AdminStats(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+func AdminHosts(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	hosts, err := hostBudgets(c)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	templates.ExecuteTemplate(w, "admin-hosts.html", struct {
+		Hosts       []*hostBudget
+		Concurrency int
+		Rate        int
+		Now         time.Time
+	}{
+		hosts,
+		hostConcurrency,
+		hostRate,
+		time.Now(),
+	})
+}
+
 func AdminUser(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
-	q := datastore.NewQuery(gn.Kind(&User{})).Limit(1)
-	q = q.Filter("e =", r.FormValue("u"))
-	it := gn.Run(q)
-	var u User
-	ud := UserData{Id: "data"}
-	var h []Log
-	k, err := it.Next(&u)
+	u, err := Store.FindUser(c, r.FormValue("u"))
 	if err != nil {
 		serveError(w, err)
 		return
 	}
-	ud.Parent = gn.Key(&u)
-	gn.Get(&ud)
+	ud, _ := Store.GetUserData(c, u.Id)
 	until := r.FormValue("until")
 	if d, err := time.Parse("2006-01-02", until); err == nil {
 		u.Until = d
-		gn.Put(&u)
+		Store.PutUser(c, u)
 	}
 	if o := []byte(r.FormValue("opml")); len(o) > 0 {
 		opml := Opml{}
@@ -203,22 +186,18 @@ func AdminUser(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 		ud.Opml = o
-		if _, err := gn.Put(&ud); err != nil {
+		if err := Store.PutUserData(c, u.Id, ud); err != nil {
 			serveError(w, err)
 			return
 		}
 		log.Infof(c, "opml updated")
 	}
-	q = datastore.NewQuery(gn.Kind(&Log{})).Ancestor(k)
-	_, err = gn.GetAll(q, &h)
 	if err := templates.ExecuteTemplate(w, "admin-user.html", struct {
-		User User
-		Data UserData
-		Log  []Log
+		User *User
+		Data *UserData
 	}{
 		u,
 		ud,
-		h,
 	}); err != nil {
 		serveError(w, err)
 	}
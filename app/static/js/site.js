@@ -73,19 +73,27 @@ goReadAppModule.controller('GoreadCtrl', function($scope, $http, $timeout, $wind
 		});
 	};
 
-	$scope.addSubscription = function(e) {
-		if (!$scope.addFeedUrl) {
+	$scope.addSubscription = function(e, feedUrl) {
+		feedUrl = feedUrl || $scope.addFeedUrl;
+		if (!feedUrl) {
 			return false;
 		}
-		var btn = $(e.target);
+		var btn = $('#add-subscription-form input[type="submit"]');
 		btn.button('loading');
 		$scope.loading++;
 		var f = $('#add-subscription-form');
 		$scope.http('POST', f.attr('data-url'), {
-			url: $scope.addFeedUrl
-		}).then(function() {
-			$scope.addFeedUrl = '';
+			url: feedUrl
+		}).then(function(resp) {
 			btn.button('reset');
+			if (resp.data && resp.data.Feeds) {
+				// the page offers several feeds: let the user pick one
+				$scope.feedChoices = resp.data.Feeds;
+				$scope.loaded();
+				return;
+			}
+			delete $scope.feedChoices;
+			$scope.addFeedUrl = '';
 			// I think this is needed due to the datastore's eventual consistency.
 			// Without the delay we only get the feed data with no story data.
 			$timeout(function() {
@@ -742,7 +750,7 @@ goReadAppModule.controller('GoreadCtrl', function($scope, $http, $timeout, $wind
 				delete $scope.fetching[f];
 				$scope.cursors[f] = data.Cursor;
 				_.each(data.Stories, function(s) {
-					$scope.procStory(f, s, true);
+					$scope.procStory(f, s, !_.contains(data.Unread, s.Id));
 				});
 				_.each(data.Stars, function(s) {
 					$scope.stories[s].star = Date.now();
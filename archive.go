@@ -0,0 +1,174 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/taskqueue"
+
+	"google.golang.org/appengine"
+)
+
+// Budget for backfilling the history of new feeds, see BackfillFeed.
+// settings.go may override these.
+var (
+	ArchiveMaxPages   = 10
+	ArchiveMaxStories = 500
+)
+
+// archiveLink picks the link to older entries: an RFC 5005 prev-archive
+// link, or else a paged feed's next link.
+func archiveLink(n int, link func(i int) (rel, href string)) string {
+	var next string
+	for i := 0; i < n; i++ {
+		rel, href := link(i)
+		switch strings.ToLower(strings.TrimSpace(rel)) {
+		case "prev-archive":
+			return strings.TrimSpace(href)
+		case "next":
+			if next == "" {
+				next = strings.TrimSpace(href)
+			}
+		}
+	}
+	return next
+}
+
+// queueBackfill queues a backfill-feed task to fetch the archive page of
+// feedUrl. pages and stored count what has been backfilled so far.
+func queueBackfill(c context.Context, feedUrl, page string, pages, stored int, delay time.Duration) {
+	t := taskqueue.NewPOSTTask(routeUrl("backfill-feed"), url.Values{
+		"feed": {feedUrl},
+		"page": {page},
+		"p":    {strconv.Itoa(pages)},
+		"n":    {strconv.Itoa(stored)},
+	})
+	t.Delay = delay
+	if pages == 0 {
+		t.Name = fmt.Sprintf("backfill_%v", taskNameEscape(feedUrl))
+	}
+	if _, err := taskqueue.Add(c, t, ""); err == taskqueue.ErrTaskAlreadyAdded {
+		log.Debugf(c, "backfill already queued: %v", feedUrl)
+	} else if err != nil {
+		log.Errorf(c, "taskqueue error: %v", err.Error())
+	}
+}
+
+// BackfillFeed stores the stories of one archive page of a feed, then
+// queues the next older page until ArchiveMaxPages or ArchiveMaxStories
+// is reached.
+func BackfillFeed(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	feedUrl := r.FormValue("feed")
+	page := r.FormValue("page")
+	pages, _ := strconv.Atoi(r.FormValue("p"))
+	stored, _ := strconv.Atoi(r.FormValue("n"))
+	if fu, err := url.Parse(feedUrl); err == nil {
+		if pu, err := fu.Parse(page); err == nil && page != "" {
+			page = pu.String()
+		}
+	}
+	f, err := Store.GetFeed(c, feedUrl)
+	if err != nil {
+		log.Errorf(c, "backfill %v: %v", feedUrl, err)
+		return
+	}
+	if f.Migrated || page == "" || pages >= ArchiveMaxPages || stored >= ArchiveMaxStories {
+		log.Infof(c, "backfill %v done: %v pages, %v stories", feedUrl, pages, stored)
+		return
+	}
+	release, ok := acquireHost(c, feedHost(page))
+	if !ok {
+		queueBackfill(c, feedUrl, page, pages, stored, hostPushback)
+		return
+	}
+	defer release()
+	feed, stories, err := fetchFeed(c, feedUrl, page, nil)
+	if err != nil {
+		log.Warningf(c, "backfill %v page %v: %v", feedUrl, page, err)
+		return
+	}
+	if left := ArchiveMaxStories - stored; len(stories) > left {
+		stories = stories[:left]
+	}
+	n, err := putArchiveStories(c, feedUrl, stories)
+	if err != nil {
+		log.Errorf(c, "backfill %v put: %v", feedUrl, err)
+		serveError(w, err)
+		return
+	}
+	pages++
+	stored += n
+	log.Infof(c, "backfill %v page %v: %v new stories", feedUrl, page, n)
+
+	// a page with nothing new means we've reached already stored history
+	// or are going around in circles
+	next := feed.ArchiveLink
+	if pu, err := url.Parse(page); err == nil && next != "" {
+		if nu, err := pu.Parse(next); err == nil {
+			next = nu.String()
+		}
+	}
+	if n == 0 || next == "" || next == page || next == feedUrl {
+		log.Infof(c, "backfill %v done: %v pages, %v stories", feedUrl, pages, stored)
+		return
+	}
+	queueBackfill(c, feedUrl, next, pages, stored, 0)
+}
+
+// putArchiveStories stores those of stories that don't exist yet, dated
+// by their original publish time so they don't show up as unread.
+func putArchiveStories(c context.Context, feed string, stories []*Story) (int, error) {
+	if len(stories) == 0 {
+		return 0, nil
+	}
+	ids := make([]readStory, len(stories))
+	for i, s := range stories {
+		s.Feed = feed
+		ids[i] = readStory{Feed: feed, Story: s.Id}
+	}
+	existing, err := Store.GetStories(c, ids)
+	if err != nil {
+		return 0, err
+	}
+	var puts []*Story
+	var failures []string
+	for i, s := range stories {
+		if existing[i] != nil {
+			continue
+		}
+		s.Created = s.Published
+		puts = append(puts, s)
+		failures = append(failures, s.dateFailures...)
+	}
+	if len(puts) == 0 {
+		return 0, nil
+	}
+	if err := Store.PutStories(c, puts, true); err != nil {
+		return 0, err
+	}
+	recordDateFailures(c, feed, failures)
+	return len(puts), nil
+}
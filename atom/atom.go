@@ -21,26 +21,84 @@ type Feed struct {
 	Author  *Person  `xml:"author"`
 	Entry   []*Entry `xml:"entry"`
 	XMLBase string   `xml:"base,attr"`
+	Lang    string   `xml:"lang,attr"`
 }
 
 type Entry struct {
-	Title     *Text   `xml:"title"`
-	ID        string  `xml:"id"`
-	Link      []Link  `xml:"link"`
-	Published TimeStr `xml:"published"`
-	Updated   TimeStr `xml:"updated"`
-	Author    *Person `xml:"author"`
-	Summary   *Text   `xml:"summary"`
-	Content   *Text   `xml:"content"`
-	XMLBase   string  `xml:"base,attr"`
+	Title        *Text      `xml:"title"`
+	ID           string     `xml:"id"`
+	Link         []Link     `xml:"link"`
+	Published    TimeStr    `xml:"published"`
+	Updated      TimeStr    `xml:"updated"`
+	Authors      []*Person  `xml:"author"`
+	Contributors []*Person  `xml:"contributor"`
+	Summary      *Text      `xml:"summary"`
+	Contents     []*Content `xml:"content"`
+	XMLBase      string     `xml:"base,attr"`
+	Lang         string     `xml:"lang,attr"`
+
+	ItunesDuration string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ItunesImage    *ItunesImage  `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ItunesEpisode  string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	ItunesSeason   string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	ItunesExplicit string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+	Chapters       *Chapters     `xml:"https://podcastindex.org/namespace/1.0 chapters"`
+	Transcripts    []*Transcript `xml:"https://podcastindex.org/namespace/1.0 transcript"`
+
+	MediaThumbnails []*MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaGroups     []*MediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+
+	Categories []*Category `xml:"category"`
+	Subjects   []string    `xml:"http://purl.org/dc/elements/1.1/ subject"`
+
+	InReplyTo []*InReplyTo `xml:"http://purl.org/syndication/thread/1.0 in-reply-to"`
+	Total     string       `xml:"http://purl.org/syndication/thread/1.0 total"`
+}
+
+// InReplyTo is from the Atom Threading Extensions (RFC 4685).
+type InReplyTo struct {
+	Ref  string `xml:"ref,attr"`
+	Href string `xml:"href,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type Category struct {
+	Term   string `xml:"term,attr"`
+	Scheme string `xml:"scheme,attr"`
+	Label  string `xml:"label,attr"`
+}
+
+// Name returns the human-readable label of the category, or its term.
+func (c *Category) Name() string {
+	if c.Label != "" {
+		return c.Label
+	}
+	return c.Term
 }
 
 type Link struct {
-	Rel  string `xml:"rel,attr"`
+	Rel    string `xml:"rel,attr"`
+	Href   string `xml:"href,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+	Count  string `xml:"http://purl.org/syndication/thread/1.0 count,attr"`
+}
+
+type ItunesImage struct {
 	Href string `xml:"href,attr"`
+}
+
+type Chapters struct {
+	Url  string `xml:"url,attr"`
 	Type string `xml:"type,attr"`
 }
 
+type Transcript struct {
+	Url      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Language string `xml:"language,attr"`
+}
+
 type Person struct {
 	Name     string `xml:"name"`
 	URI      string `xml:"uri"`
@@ -54,6 +112,51 @@ type Text struct {
 	InnerXML string `xml:",innerxml"`
 }
 
+// Content is either an atom:content or a media:content element, which
+// can't be told apart by field tags alone.
+type Content struct {
+	XMLName xml.Name
+	Text
+	URL    string `xml:"url,attr"`
+	Medium string `xml:"medium,attr"`
+	Width  string `xml:"width,attr"`
+	Height string `xml:"height,attr"`
+}
+
+const MediaNS = "http://search.yahoo.com/mrss/"
+
+// Content returns the entry's atom:content, or nil.
+func (e *Entry) Content() *Text {
+	for _, c := range e.Contents {
+		if c.XMLName.Space != MediaNS {
+			return &c.Text
+		}
+	}
+	return nil
+}
+
+// MediaContents returns the entry's media:content elements.
+func (e *Entry) MediaContents() []*Content {
+	var m []*Content
+	for _, c := range e.Contents {
+		if c.XMLName.Space == MediaNS {
+			m = append(m, c)
+		}
+	}
+	return m
+}
+
+type MediaThumbnail struct {
+	URL    string `xml:"url,attr"`
+	Width  string `xml:"width,attr"`
+	Height string `xml:"height,attr"`
+}
+
+type MediaGroup struct {
+	Contents   []*Content        `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails []*MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+}
+
 type TimeStr string
 
 func Time(t time.Time) TimeStr {
@@ -0,0 +1,166 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"encoding/json"
+	"html"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/msde/goread/atom"
+	"github.com/msde/goread/platform/user"
+)
+
+const (
+	maxAuthors = 20
+
+	// Number of stories get-author looks at per request while looking
+	// for ones in the user's subscriptions, and per query.
+	authorScanLimit = 500
+	authorPageSize  = 100
+)
+
+// authorKey normalizes an author name, or email if there is no name, for
+// the ak index.
+func authorKey(p Person) string {
+	if k := strings.ToLower(strings.TrimSpace(p.Name)); k != "" {
+		return k
+	}
+	return strings.ToLower(strings.TrimSpace(p.Email))
+}
+
+// addAuthor adds p to st's authors unless it has no name or email, or is
+// already there.
+func addAuthor(st *Story, p Person) {
+	p.Name = strings.TrimSpace(html.UnescapeString(p.Name))
+	p.Uri = strings.TrimSpace(p.Uri)
+	p.Email = strings.TrimSpace(p.Email)
+	key := authorKey(p)
+	if key == "" || len(key) > maxCategorySize || len(st.Authors) >= maxAuthors {
+		return
+	}
+	for _, k := range st.AuthorKeys {
+		if k == key {
+			return
+		}
+	}
+	st.Authors = append(st.Authors, p)
+	st.AuthorKeys = append(st.AuthorKeys, key)
+}
+
+// authorNames returns the names of st's authors, not contributors, for
+// Story.Author.
+func authorNames(st *Story) string {
+	var names []string
+	for _, p := range st.Authors {
+		if p.Contributor {
+			continue
+		}
+		if p.Name != "" {
+			names = append(names, p.Name)
+		} else {
+			names = append(names, p.Email)
+		}
+	}
+	return strings.Join(names, ", ")
+}
+
+func atomPerson(p *atom.Person, contributor bool) Person {
+	return Person{
+		Name:        p.Name,
+		Uri:         p.URI,
+		Email:       p.Email,
+		Contributor: contributor,
+	}
+}
+
+// rssPerson parses an RSS author, which is supposed to be an email
+// address, often followed by a name in parentheses.
+func rssPerson(v string) Person {
+	v = strings.TrimSpace(v)
+	if a, err := mail.ParseAddress(v); err == nil {
+		return Person{Name: a.Name, Email: a.Address}
+	}
+	if i := strings.Index(v, " ("); i > 0 && strings.HasSuffix(v, ")") && strings.Contains(v[:i], "@") {
+		return Person{Name: v[i+2 : len(v)-1], Email: v[:i]}
+	}
+	return Person{Name: v}
+}
+
+// GetAuthor lists stories by the author a across the user's subscriptions,
+// newest first.
+func GetAuthor(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	cu := user.Current(c)
+	key := authorKey(Person{Name: r.FormValue("a")})
+	if key == "" {
+		return
+	}
+	var fs Opml
+	if ud, err := Store.GetUserData(c, cu.ID); err == nil {
+		json.Unmarshal(ud.Opml, &fs)
+	} else if err != ErrNotFound {
+		serveError(w, err)
+		return
+	}
+	subs := fs.feedUrls()
+
+	// The cursor resumes after the last story looked at, so stories past
+	// the 20th match are not skipped.
+	cursor := r.FormValue("c")
+	var ids []readStory
+	for scanned := 0; scanned < authorScanLimit && len(ids) < 20; {
+		page, curs, err := Store.AuthorStories(c, key, Page{Cursor: cursor, Limit: authorPageSize})
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		for i, id := range page {
+			cursor = curs[i]
+			if subs[id.Feed] {
+				if ids = append(ids, id); len(ids) == 20 {
+					break
+				}
+			}
+		}
+		scanned += len(page)
+		if len(page) < authorPageSize {
+			break
+		}
+	}
+	ss, err := Store.GetStories(c, ids)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	stories := ss[:0]
+	for _, s := range ss {
+		if s != nil {
+			stories = append(stories, s)
+		}
+	}
+	b, _ := json.Marshal(struct {
+		Cursor  string
+		Stories []*Story
+	}{
+		Cursor:  cursor,
+		Stories: stories,
+	})
+	w.Write(b)
+}
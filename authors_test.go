@@ -0,0 +1,83 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestGetAuthor(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := newFeedServer()
+		defer s.Close()
+		subscribe(t, s)
+
+		// One in six of the author's stories is in a subscribed feed.
+		var stories []*Story
+		var want []string
+		now := time.Now()
+		for i := 0; i < 150; i++ {
+			st := &Story{
+				Id:         fmt.Sprint("s", i),
+				Feed:       "http://example.com/other",
+				Created:    now.Add(-time.Minute * time.Duration(i)),
+				AuthorKeys: []string{"ann"},
+			}
+			if i%6 == 0 {
+				st.Feed = s.feedUrl()
+				want = append(want, st.Id)
+			}
+			stories = append(stories, st)
+		}
+		if err := Store.PutStories(context.Background(), stories, false); err != nil {
+			t.Fatal(err)
+		}
+
+		var got []string
+		var sizes []int
+		cursor := ""
+		for len(sizes) < 5 {
+			var ga struct {
+				Cursor  string
+				Stories []*Story
+			}
+			decode(t, serve(t, GetAuthor, testUser, "/user/get-author?"+url.Values{"a": {"Ann"}, "c": {cursor}}.Encode(), nil), &ga)
+			sizes = append(sizes, len(ga.Stories))
+			if len(ga.Stories) == 0 {
+				break
+			}
+			for _, st := range ga.Stories {
+				got = append(got, st.Id)
+			}
+			cursor = ga.Cursor
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) || fmt.Sprint(sizes) != "[20 5 0]" {
+			t.Errorf("got pages of %v: %v; want %v", sizes, got, want)
+		}
+
+		// A user without any data yet has no subscriptions.
+		var ga struct{ Stories []*Story }
+		decode(t, serve(t, GetAuthor, "new@example.com", "/user/get-author?a=Ann", nil), &ga)
+		if len(ga.Stories) != 0 {
+			t.Errorf("stories for a new user: %v", len(ga.Stories))
+		}
+	})
+}
@@ -18,11 +18,23 @@ package goread
 
 import (
 	"bytes"
+	"context"
+	"encoding/json"
 	"errors"
 	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
 	"golang.org/x/net/html"
 	"golang.org/x/net/html/atom"
+
+	"github.com/msde/goread/platform/urlfetch"
 )
 
 var (
@@ -30,60 +42,345 @@ var (
 	ErrNoIcon    = errors.New("No icon found")
 )
 
-func Autodiscover(b []byte) (string, error) {
+// FeedLink is a feed offered by a web page.
+type FeedLink struct {
+	Url   string
+	Title string
+	Type  string
+}
+
+var feedTypes = map[string]bool{
+	"application/atom+xml":   true,
+	"application/feed+json":  true,
+	"application/rdf+xml":    true,
+	"application/rss+xml":    true,
+	"application/x-atom+xml": true,
+	"application/x-rss+xml":  true,
+}
+
+// Paths probed when a page does not link to its feed.
+var feedPaths = []string{"/feed", "/rss.xml", "/atom.xml", "/index.xml"}
+
+// Autodiscover returns the feeds linked from the <head> of an HTML page,
+// resolved against base (or the page's <base> element). Comment feeds are
+// listed after the others.
+func Autodiscover(base *url.URL, b []byte) ([]*FeedLink, error) {
 	r := bytes.NewReader(b)
 	z := html.NewTokenizer(r)
+	var links []*FeedLink
+	seen := make(map[string]bool)
 	for {
 		if z.Next() == html.ErrorToken {
 			if err := z.Err(); err == io.EOF {
 				break
 			} else {
-				return "", ErrNoRssLink
+				return nil, ErrNoRssLink
 			}
 		}
 		t := z.Token()
+		if t.Type != html.StartTagToken && t.Type != html.SelfClosingTagToken {
+			continue
+		}
+		attrs := make(map[string]string)
+		for _, a := range t.Attr {
+			attrs[a.Key] = strings.TrimSpace(a.Val)
+		}
 		switch t.DataAtom {
+		case atom.Base:
+			if u, err := base.Parse(attrs["href"]); err == nil && attrs["href"] != "" {
+				base = u
+			}
 		case atom.Link:
-			if t.Type == html.StartTagToken || t.Type == html.SelfClosingTagToken {
-				attrs := make(map[string]string)
-				for _, a := range t.Attr {
-					attrs[a.Key] = a.Val
-				}
-				if attrs["rel"] == "alternate" && attrs["href"] != "" &&
-					(attrs["type"] == "application/rss+xml" || attrs["type"] == "application/atom+xml") {
-					return attrs["href"], nil
-				}
+			rels := strings.Fields(strings.ToLower(attrs["rel"]))
+			var alternate, feed bool
+			for _, rel := range rels {
+				alternate = alternate || rel == "alternate"
+				feed = feed || rel == "feed"
+			}
+			typ, _, _ := mime.ParseMediaType(attrs["type"])
+			if attrs["href"] == "" || !(alternate && feedTypes[typ] || feed && (typ == "" || feedTypes[typ] || typ == "application/json")) {
+				continue
+			}
+			u, err := base.Parse(attrs["href"])
+			if err != nil {
+				continue
+			}
+			u.Fragment = ""
+			if seen[u.String()] {
+				continue
+			}
+			seen[u.String()] = true
+			links = append(links, &FeedLink{
+				Url:   u.String(),
+				Title: attrs["title"],
+				Type:  typ,
+			})
+		case atom.Body:
+			// feed links belong in <head>
+			if len(links) > 0 {
+				return sortFeedLinks(links), nil
+			}
+		}
+	}
+	if len(links) == 0 {
+		return nil, ErrNoRssLink
+	}
+	return sortFeedLinks(links), nil
+}
+
+func isCommentFeed(l *FeedLink) bool {
+	return strings.Contains(strings.ToLower(l.Title), "comment") ||
+		strings.Contains(strings.ToLower(l.Url), "comment")
+}
+
+func sortFeedLinks(links []*FeedLink) []*FeedLink {
+	sort.SliceStable(links, func(i, j int) bool {
+		return !isCommentFeed(links[i]) && isCommentFeed(links[j])
+	})
+	return links
+}
+
+// sniffFeed returns the type of the feed in b, or "" if b is not a feed.
+func sniffFeed(contentType string, b []byte) string {
+	ct, _, _ := mime.ParseMediaType(contentType)
+	if feedTypes[ct] {
+		return ct
+	}
+	if len(b) > 1024 {
+		b = b[:1024]
+	}
+	s := string(b)
+	switch {
+	case strings.Contains(s, "<rss"):
+		return "application/rss+xml"
+	case strings.Contains(s, "<feed"):
+		return "application/atom+xml"
+	case strings.Contains(s, "<rdf:RDF"):
+		return "application/rdf+xml"
+	case strings.Contains(s, "jsonfeed.org/version"):
+		return "application/feed+json"
+	}
+	return ""
+}
+
+// discoverFeeds fetches the page at u and returns the feeds it offers. If
+// the page has no feed links, common feed paths on its host are probed. If
+// u is a feed itself, it is returned parsed instead, so it needn't be
+// fetched again.
+func discoverFeeds(c context.Context, u string) ([]*FeedLink, *Feed, []*Story, error) {
+	if !strings.Contains(u, "://") {
+		u = "http://" + u
+	}
+	c, cancel := context.WithTimeout(c, time.Minute)
+	defer cancel()
+	cl := urlfetch.Client(c)
+	resp, err := cl.Get(u)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, nil, nil
+	}
+	const sz = 1 << 21
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, sz))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	ct, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if ct != "text/html" && ct != "application/xhtml+xml" {
+		if len(b) == sz || resp.Request.URL.String() != u {
+			// Leave size limits and redirects to fetchFeed.
+			return nil, nil, nil, nil
+		}
+		feed, stories, err := ParseFeed(c, resp.Header.Get("Content-Type"), u, u, b)
+		if err != nil || feed == nil {
+			return nil, nil, nil, nil
+		}
+		feed.ETag = resp.Header.Get("ETag")
+		feed.LastModified = resp.Header.Get("Last-Modified")
+		feed.ValidatorUrl = u
+		return nil, feed, stories, nil
+	}
+	if links, err := Autodiscover(resp.Request.URL, b); err == nil {
+		return links, nil, nil, nil
+	}
+	var links []*FeedLink
+	seen := make(map[string]bool)
+	for _, p := range feedPaths {
+		pu, err := resp.Request.URL.Parse(p)
+		if err != nil {
+			continue
+		}
+		l := probeFeed(cl, pu.String())
+		if l == nil || seen[l.Url] {
+			continue
+		}
+		seen[l.Url] = true
+		links = append(links, l)
+	}
+	return links, nil, nil, nil
+}
+
+// probeFeed returns a link to the feed at u, following redirects, or nil if
+// there is no feed there.
+func probeFeed(cl *http.Client, u string) *FeedLink {
+	resp, err := cl.Get(u)
+	if err != nil {
+		return nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return nil
+	}
+	typ := sniffFeed(resp.Header.Get("Content-Type"), b)
+	if typ == "" {
+		return nil
+	}
+	return &FeedLink{
+		Url:  resp.Request.URL.String(),
+		Type: typ,
+	}
+}
+
+// IconLink is an icon offered by a web page. Size is its width in pixels,
+// or 0 if unknown.
+type IconLink struct {
+	Url  string
+	Size int
+}
+
+// iconSize parses a sizes attribute such as "16x16 32x32" and returns the
+// largest width.
+func iconSize(sizes string) int {
+	n := 0
+	for _, s := range strings.Fields(strings.ToLower(sizes)) {
+		if i := strings.IndexByte(s, 'x'); i > 0 {
+			if w, err := strconv.Atoi(s[:i]); err == nil && w > n {
+				n = w
 			}
 		}
 	}
-	return "", ErrNoRssLink
+	return n
 }
 
-// Returns the href attribute of a <link rel="shortcut icon"> tag or error if not found.
-func FindIcon(b []byte) (string, error) {
+// SVG icons can't be resized, so they are skipped.
+func isSvgIcon(typ, href string) bool {
+	return strings.HasPrefix(typ, "image/svg") || strings.HasSuffix(strings.ToLower(href), ".svg")
+}
+
+// FindIcon returns the icons linked from an HTML page, best first for an
+// icon of size pixels, and the URL of the page's web app manifest, if any.
+func FindIcon(base *url.URL, b []byte, size int) ([]*IconLink, string, error) {
 	r := bytes.NewReader(b)
 	z := html.NewTokenizer(r)
+	var icons []*IconLink
+	var manifest string
 	for {
 		if z.Next() == html.ErrorToken {
 			if err := z.Err(); err == io.EOF {
 				break
 			} else {
-				return "", ErrNoIcon
+				return nil, "", ErrNoIcon
 			}
 		}
 		t := z.Token()
+		if t.Type != html.StartTagToken && t.Type != html.SelfClosingTagToken {
+			continue
+		}
+		attrs := make(map[string]string)
+		for _, a := range t.Attr {
+			attrs[a.Key] = strings.TrimSpace(a.Val)
+		}
 		switch t.DataAtom {
+		case atom.Base:
+			if u, err := base.Parse(attrs["href"]); err == nil && attrs["href"] != "" {
+				base = u
+			}
 		case atom.Link:
-			if t.Type == html.StartTagToken || t.Type == html.SelfClosingTagToken {
-				attrs := make(map[string]string)
-				for _, a := range t.Attr {
-					attrs[a.Key] = a.Val
-				}
-				if attrs["rel"] == "shortcut icon" && attrs["href"] != "" {
-					return attrs["href"], nil
+			if attrs["href"] == "" {
+				continue
+			}
+			u, err := base.Parse(attrs["href"])
+			if err != nil {
+				continue
+			}
+			for _, rel := range strings.Fields(strings.ToLower(attrs["rel"])) {
+				switch {
+				case rel == "manifest":
+					manifest = u.String()
+				case rel == "icon" || strings.HasPrefix(rel, "apple-touch-icon"):
+					if isSvgIcon(attrs["type"], attrs["href"]) {
+						continue
+					}
+					n := iconSize(attrs["sizes"])
+					if n == 0 && strings.HasPrefix(rel, "apple-touch-icon") {
+						// the size Apple devices assume
+						n = 180
+					}
+					icons = append(icons, &IconLink{Url: u.String(), Size: n})
 				}
 			}
 		}
 	}
-	return "", ErrNoIcon
+	if len(icons) == 0 && manifest == "" {
+		return nil, "", ErrNoIcon
+	}
+	return sortIcons(icons, size), manifest, nil
+}
+
+// manifestIcons returns the icons listed in a web app manifest.
+func manifestIcons(base *url.URL, b []byte) []*IconLink {
+	var m struct {
+		Icons []struct {
+			Src     string
+			Sizes   string
+			Type    string
+			Purpose string
+		}
+	}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil
+	}
+	var icons []*IconLink
+	for _, i := range m.Icons {
+		if i.Src == "" || isSvgIcon(i.Type, i.Src) || strings.TrimSpace(i.Purpose) == "maskable" {
+			continue
+		}
+		u, err := base.Parse(i.Src)
+		if err != nil {
+			continue
+		}
+		icons = append(icons, &IconLink{Url: u.String(), Size: iconSize(i.Sizes)})
+	}
+	return icons
+}
+
+// sortIcons orders icons best first for an icon of size pixels: the
+// smallest at least that large, then those of unknown size, then the
+// largest of the smaller ones.
+func sortIcons(icons []*IconLink, size int) []*IconLink {
+	rank := func(i *IconLink) (int, int) {
+		switch {
+		case i.Size >= size:
+			return 0, i.Size - size
+		case i.Size == 0:
+			return 1, 0
+		default:
+			return 2, size - i.Size
+		}
+	}
+	sort.SliceStable(icons, func(i, j int) bool {
+		gi, di := rank(icons[i])
+		gj, dj := rank(icons[j])
+		if gi != gj {
+			return gi < gj
+		}
+		return di < dj
+	})
+	return icons
 }
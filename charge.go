@@ -26,12 +26,11 @@ import (
 	"strings"
 	"time"
 
-	"github.com/mjibson/goon"
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/urlfetch"
+	"github.com/msde/goread/platform/user"
 
 	"google.golang.org/appengine/datastore"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/urlfetch"
-	"google.golang.org/appengine/user"
 )
 
 type Plan struct {
@@ -79,20 +78,18 @@ type StripeError struct {
 func Charge(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := User{Id: cu.ID}
-	uc := &UserCharge{Id: 1, Parent: gn.Key(&u)}
-	if err := gn.Get(&u); err != nil {
+	u, err := Store.GetUser(c, cu.ID)
+	if err != nil {
 		serveError(w, err)
 		return
 	} else if u.Account != AFree {
 		serveError(w, fmt.Errorf("You're already subscribed."))
 		return
 	}
-	if err := gn.Get(uc); err == nil && len(uc.Customer) > 0 {
+	if uc, err := Store.GetCharge(c, cu.ID); err == nil && len(uc.Customer) > 0 {
 		serveError(w, fmt.Errorf("You're already subscribed."))
 		return
-	} else if err != datastore.ErrNoSuchEntity {
+	} else if err != ErrNotFound {
 		serveError(w, err)
 		return
 	}
@@ -117,7 +114,7 @@ func Charge(w http.ResponseWriter, r *http.Request) {
 		log.Errorf(c, "status: %v, %s", resp.StatusCode, b)
 		return
 	}
-	uc, err = setCharge(c, resp)
+	uc, err := setCharge(c, resp)
 	if err != nil {
 		serveError(w, err)
 		return
@@ -137,14 +134,14 @@ func setCharge(c context.Context, r *http.Response) (*UserCharge, error) {
 		return nil, err
 	}
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := User{Id: cu.ID}
-	uc := UserCharge{Id: 1, Parent: gn.Key(&u)}
-	if err := gn.RunInTransaction(func(gn *goon.Goon) error {
-		if err := gn.Get(&u); err != nil && err != datastore.ErrNoSuchEntity {
+	var uc *UserCharge
+	if err := Store.RunInTransaction(c, func(c context.Context) error {
+		u, err := Store.GetUser(c, cu.ID)
+		if err != nil && err != ErrNotFound {
 			return err
 		}
-		if err := gn.Get(&uc); err != nil && err != datastore.ErrNoSuchEntity {
+		uc, err = Store.GetCharge(c, cu.ID)
+		if err != nil && err != ErrNotFound {
 			return err
 		}
 		u.Account = APaid
@@ -155,21 +152,20 @@ func setCharge(c context.Context, r *http.Response) (*UserCharge, error) {
 		uc.Amount = sc.Subscription.Plan.Amount
 		uc.Interval = sc.Subscription.Plan.Interval
 		uc.Plan = sc.Subscription.Plan.Id
-		_, err := gn.PutMulti([]interface{}{&u, &uc})
-		return err
-	}, nil); err != nil {
+		if err := Store.PutUser(c, u); err != nil {
+			return err
+		}
+		return Store.PutCharge(c, cu.ID, uc)
+	}); err != nil {
 		return nil, err
 	}
-	return &uc, nil
+	return uc, nil
 }
 
 func Account(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := User{Id: cu.ID}
-	uc := &UserCharge{Id: 1, Parent: gn.Key(&u)}
-	if err := gn.Get(uc); err == nil {
+	if uc, err := Store.GetCharge(c, cu.ID); err == nil {
 		if uc.Next.Before(time.Now()) {
 			if resp, err := stripe(c, "GET", "customers/"+uc.Customer, ""); err == nil {
 				if nuc, err := setCharge(c, resp); err == nil {
@@ -180,7 +176,7 @@ func Account(w http.ResponseWriter, r *http.Request) {
 		}
 		b, _ := json.Marshal(&uc)
 		w.Write(b)
-	} else if err != datastore.ErrNoSuchEntity {
+	} else if err != ErrNotFound {
 		serveError(w, err)
 		return
 	}
@@ -199,13 +195,11 @@ func Uncheckout(w http.ResponseWriter, r *http.Request) {
 
 func doUncheckout(c context.Context) (*UserCharge, error) {
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := User{Id: cu.ID}
-	uc := UserCharge{Id: 1, Parent: gn.Key(&u)}
-	if err := gn.Get(&u); err != nil {
+	if _, err := Store.GetUser(c, cu.ID); err != nil {
 		return nil, err
 	}
-	if err := gn.Get(&uc); err != nil || len(uc.Customer) == 0 {
+	uc, err := Store.GetCharge(c, cu.ID)
+	if err != nil || len(uc.Customer) == 0 {
 		return nil, err
 	}
 	resp, err := stripe(c, "DELETE", "customers/"+uc.Customer, "")
@@ -215,23 +209,23 @@ func doUncheckout(c context.Context) (*UserCharge, error) {
 		log.Errorf(c, "%s", resp.Body)
 		log.Errorf(c, "stripe delete error, but proceeding")
 	}
-	if err := gn.RunInTransaction(func(gn *goon.Goon) error {
-		if err := gn.Get(&u); err != nil && err != datastore.ErrNoSuchEntity {
+	if err := Store.RunInTransaction(c, func(c context.Context) error {
+		u, err := Store.GetUser(c, cu.ID)
+		if err != nil && err != ErrNotFound {
 			return err
 		}
 		u.Account = AFree
 		if uc.Next.After(u.Until) {
 			u.Until = uc.Next
 		}
-		if err := gn.Delete(gn.Key(&uc)); err != nil {
+		if err := Store.DeleteCharge(c, cu.ID); err != nil {
 			return err
 		}
-		_, err := gn.Put(&u)
-		return err
-	}, nil); err != nil {
+		return Store.PutUser(c, u)
+	}); err != nil {
 		return nil, err
 	}
-	return &uc, nil
+	return uc, nil
 }
 
 func stripe(c context.Context, method, urlStr, body string) (*http.Response, error) {
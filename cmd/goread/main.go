@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Command goread serves goread without App Engine, keeping entities in
+// SQLite or PostgreSQL. It must be run from a directory with goread's
+// templates, such as app.
+//
+// goread doesn't sign users in itself. Either put it behind a proxy that
+// authenticates users and passes their email in a header, named by
+// -auth-header, or run it for a single user with -user.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"io/ioutil"
+	_log "log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	_ "github.com/lib/pq"
+	_ "github.com/mattn/go-sqlite3"
+	"github.com/msde/goread"
+	"github.com/msde/goread/platform"
+	"github.com/msde/goread/platform/blobstore"
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/taskqueue"
+	"github.com/msde/goread/platform/user"
+)
+
+var (
+	listen     = flag.String("listen", ":8080", "address to listen on")
+	driver     = flag.String("db", "sqlite3", "database driver: sqlite3 or postgres")
+	dsn        = flag.String("dsn", "goread.db", "database data source name")
+	staticDir  = flag.String("static", "static", "directory of static files")
+	blobDir    = flag.String("blobs", "blobs", "directory of uploaded files")
+	queueFile  = flag.String("queues", "queue.yaml", "queue configuration")
+	workers    = flag.Int("workers", 20, "most tasks run at once")
+	authHeader = flag.String("auth-header", "", "request header with the email of the signed in user")
+	single     = flag.String("user", "", "email of the only user, instead of -auth-header")
+	admins     = flag.String("admins", "", "comma-separated emails of administrators")
+	interval   = flag.Duration("update-feeds", time.Minute*5, "how often feeds due for an update are queued")
+	debug      = flag.Bool("debug", false, "log debug messages")
+)
+
+// Paths needing a signed in user or an administrator, as in app.yaml.
+var (
+	loginPaths = []string{"/login/google", "/user/"}
+	adminPaths = []string{"/admin/", "/tasks/", "/date-formats"}
+)
+
+// sqliteOptions are added to SQLite data source names without options, so
+// concurrent requests wait for each other instead of failing.
+const sqliteOptions = "?_busy_timeout=10000&_journal_mode=WAL&_txlock=immediate"
+
+func main() {
+	flag.Parse()
+	if (*authHeader == "") == (*single == "") {
+		_log.Fatal("one of -auth-header or -user is required")
+	}
+	platform.Standalone = true
+	log.Debug = *debug
+	blobstore.Dir = *blobDir
+
+	source := *dsn
+	if *driver == "sqlite3" && !strings.Contains(source, "?") {
+		source += sqliteOptions
+	}
+	db, err := sql.Open(*driver, source)
+	if err != nil {
+		_log.Fatal(err)
+	}
+	if goread.Store, err = goread.NewSQLStorage(db, *driver); err != nil {
+		_log.Fatal(err)
+	}
+
+	b, err := ioutil.ReadFile(*queueFile)
+	if err != nil {
+		_log.Fatal(err)
+	}
+	queues, err := taskqueue.ParseQueues(b)
+	if err != nil {
+		_log.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	goread.RegisterHandlers(router)
+	taskqueue.Default = taskqueue.NewPool(router, *workers, queues)
+	go updateFeeds(*interval)
+
+	static := http.FileServer(http.Dir(*staticDir))
+	http.Handle("/static/", http.StripPrefix("/static/", static))
+	http.Handle("/favicon.ico", http.RedirectHandler("/static/favicon.png", http.StatusMovedPermanently))
+	http.Handle("/", authenticate(router))
+	_log.Printf("listening on %v", *listen)
+	_log.Fatal(http.ListenAndServe(*listen, nil))
+}
+
+// updateFeeds queues the update-feeds task every d, like cron.yaml.
+func updateFeeds(d time.Duration) {
+	c := context.Background()
+	for range time.Tick(d) {
+		t := &taskqueue.Task{Method: "GET", Path: "/tasks/update-feeds"}
+		if _, err := taskqueue.Add(c, t, ""); err != nil {
+			log.Errorf(c, "update feeds: %v", err)
+		}
+	}
+}
+
+// authenticate sets the user of requests, and enforces the login and admin
+// rules App Engine applies from app.yaml.
+func authenticate(h http.Handler) http.Handler {
+	isAdmin := make(map[string]bool)
+	for _, e := range strings.Split(*admins, ",") {
+		if e = strings.ToLower(strings.TrimSpace(e)); e != "" {
+			isAdmin[e] = true
+		}
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		email := *single
+		if *authHeader != "" {
+			email = r.Header.Get(*authHeader)
+		}
+		var u *user.User
+		if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+			u = &user.User{
+				Email: email,
+				ID:    email,
+				Admin: isAdmin[email],
+			}
+			r = r.WithContext(user.NewContext(r.Context(), u))
+		}
+		for _, p := range adminPaths {
+			if strings.HasPrefix(r.URL.Path, p) && (u == nil || !u.Admin) {
+				http.Error(w, "admin required", http.StatusForbidden)
+				return
+			}
+		}
+		for _, p := range loginPaths {
+			if strings.HasPrefix(r.URL.Path, p) && u == nil {
+				http.Error(w, "login required", http.StatusUnauthorized)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
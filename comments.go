@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/memcache"
+)
+
+const (
+	commentsExpiration = time.Minute * 10
+	commentsLimit      = 200
+)
+
+type Comment struct {
+	Id        string
+	Title     string `json:",omitempty"`
+	Link      string `json:",omitempty"`
+	Author    string `json:",omitempty"`
+	Date      int64
+	Content   string
+	InReplyTo string `json:",omitempty"`
+}
+
+func commentsKey(feedUrl string) string {
+	h := sha1.Sum([]byte(feedUrl))
+	return "_comments-" + hex.EncodeToString(h[:])
+}
+
+// GetComments returns the sanitized entries of a story's comment feed,
+// oldest first. Results are cached for a few minutes.
+func GetComments(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	ss, err := Store.GetStories(c, []readStory{{Feed: r.FormValue("feed"), Story: r.FormValue("story")}})
+	if err != nil {
+		serveError(w, err)
+		return
+	} else if ss[0] == nil {
+		serveError(w, ErrNotFound)
+		return
+	}
+	s := ss[0]
+	if s.CommentsFeed == "" {
+		w.Write([]byte("[]"))
+		return
+	}
+	key := commentsKey(s.CommentsFeed)
+	if item, err := memcache.Get(c, key); err == nil {
+		w.Write(item.Value)
+		return
+	}
+	_, stories, err := fetchFeed(c, s.CommentsFeed, s.CommentsFeed, nil)
+	if err != nil {
+		log.Warningf(c, "comments %v: %v", s.CommentsFeed, err)
+		serveError(w, err)
+		return
+	}
+	sort.SliceStable(stories, func(i, j int) bool {
+		return stories[i].Date < stories[j].Date
+	})
+	if len(stories) > commentsLimit {
+		stories = stories[len(stories)-commentsLimit:]
+	}
+	comments := make([]*Comment, 0, len(stories))
+	for _, st := range stories {
+		comments = append(comments, &Comment{
+			Id:        st.Id,
+			Title:     st.Title,
+			Link:      st.Link,
+			Author:    st.Author,
+			Date:      st.Date,
+			Content:   st.content,
+			InReplyTo: st.InReplyTo,
+		})
+	}
+	b, err := json.Marshal(comments)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	memcache.Set(c, &memcache.Item{
+		Key:        key,
+		Value:      b,
+		Expiration: commentsExpiration,
+	})
+	w.Write(b)
+}
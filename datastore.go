@@ -0,0 +1,602 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"time"
+
+	"github.com/mjibson/goon"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+// datastoreStorage keeps entities in the App Engine datastore via goon.
+type datastoreStorage struct{}
+
+type txKey struct{}
+
+// goon returns the transaction's goon if c is inside RunInTransaction.
+func (datastoreStorage) goon(c context.Context) *goon.Goon {
+	if gn, ok := c.Value(txKey{}).(*goon.Goon); ok {
+		return gn
+	}
+	return goon.FromContext(c)
+}
+
+func (d datastoreStorage) RunInTransaction(c context.Context, f func(c context.Context) error) error {
+	return d.goon(c).RunInTransaction(func(gn *goon.Goon) error {
+		return f(context.WithValue(c, txKey{}, gn))
+	}, nil)
+}
+
+func (d datastoreStorage) userKey(c context.Context, uid string) *datastore.Key {
+	return d.goon(c).Key(&User{Id: uid})
+}
+
+func (d datastoreStorage) feedKey(c context.Context, url string) *datastore.Key {
+	return d.goon(c).Key(&Feed{Url: url})
+}
+
+// notFound reports whether entity i of a GetMulti is missing, and returns
+// err if it isn't a per-entity error.
+func notFound(err error, i int) (bool, error) {
+	if _, ok := err.(appengine.MultiError); err != nil && !ok {
+		return false, err
+	}
+	return goon.NotFound(err, i), nil
+}
+
+// pageQuery starts q at p.Cursor, if valid, and limits it to p.Limit.
+func pageQuery(q *datastore.Query, p Page) *datastore.Query {
+	if cur, err := datastore.DecodeCursor(p.Cursor); err == nil && p.Cursor != "" {
+		q = q.Start(cur)
+	}
+	if p.Limit > 0 {
+		q = q.Limit(p.Limit)
+	}
+	return q
+}
+
+// keys runs the keys-only query q to its end or limit.
+func (d datastoreStorage) keys(c context.Context, q *datastore.Query) ([]*datastore.Key, string, error) {
+	var keys []*datastore.Key
+	it := d.goon(c).Run(q.KeysOnly())
+	for {
+		k, err := it.Next(nil)
+		if err == datastore.Done {
+			break
+		} else if err != nil {
+			return nil, "", err
+		}
+		keys = append(keys, k)
+	}
+	cur := ""
+	if ic, err := it.Cursor(); err == nil {
+		cur = ic.String()
+	}
+	return keys, cur, nil
+}
+
+func (d datastoreStorage) GetFeed(c context.Context, url string) (*Feed, error) {
+	f := &Feed{Url: url}
+	return f, d.goon(c).Get(f)
+}
+
+func (d datastoreStorage) GetFeeds(c context.Context, urls []string) ([]*Feed, error) {
+	fs := make([]*Feed, len(urls))
+	for i, u := range urls {
+		fs[i] = &Feed{Url: u}
+	}
+	err := d.goon(c).GetMulti(fs)
+	for i := range fs {
+		if nf, err := notFound(err, i); err != nil {
+			return nil, err
+		} else if nf {
+			fs[i] = nil
+		}
+	}
+	return fs, nil
+}
+
+func (d datastoreStorage) PutFeed(c context.Context, f *Feed) error {
+	_, err := d.goon(c).Put(f)
+	return err
+}
+
+func (d datastoreStorage) DueFeeds(c context.Context, t time.Time, limit int) ([]*Feed, error) {
+	var fs []*Feed
+	q := datastore.NewQuery(d.goon(c).Kind(&Feed{})).Filter("n <=", t).Limit(limit)
+	_, err := d.goon(c).GetAll(q, &fs)
+	return fs, err
+}
+
+func (d datastoreStorage) FeedUrls(c context.Context, next time.Time, p Page) ([]string, string, error) {
+	q := datastore.NewQuery(d.goon(c).Kind(&Feed{}))
+	if !next.IsZero() {
+		q = q.Filter("n=", next)
+	}
+	keys, cur, err := d.keys(c, pageQuery(q, p))
+	urls := make([]string, len(keys))
+	for i, k := range keys {
+		urls[i] = k.StringID()
+	}
+	return urls, cur, err
+}
+
+func (d datastoreStorage) GetStories(c context.Context, ids []readStory) ([]*Story, error) {
+	ss := make([]*Story, len(ids))
+	for i, id := range ids {
+		ss[i] = &Story{Id: id.Story, Parent: d.feedKey(c, id.Feed)}
+	}
+	err := d.goon(c).GetMulti(ss)
+	for i, s := range ss {
+		if nf, err := notFound(err, i); err != nil {
+			return nil, err
+		} else if nf {
+			ss[i] = nil
+		} else {
+			s.Feed = ids[i].Feed
+		}
+	}
+	return ss, nil
+}
+
+func (d datastoreStorage) PutStories(c context.Context, stories []*Story, content bool) error {
+	if len(stories) == 0 {
+		return nil
+	}
+	gn := d.goon(c)
+	puts := make([]interface{}, 0, len(stories)*2)
+	for _, s := range stories {
+		s.Parent = d.feedKey(c, s.Feed)
+		puts = append(puts, s)
+		if content {
+			sc := newStoryContent(s)
+			sc.Parent = gn.Key(s)
+			puts = append(puts, sc)
+		}
+	}
+	_, err := gn.PutMulti(puts)
+	return err
+}
+
+// newStoryContent returns the compressed content of s.
+func newStoryContent(s *Story) *StoryContent {
+	sc := &StoryContent{Id: 1}
+	buf := &bytes.Buffer{}
+	if gz, err := gzip.NewWriterLevel(buf, gzip.BestCompression); err == nil {
+		gz.Write([]byte(s.content))
+		gz.Close()
+		sc.Compressed = buf.Bytes()
+	}
+	if len(sc.Compressed) == 0 {
+		sc.Content = s.content
+	}
+	return sc
+}
+
+func (d datastoreStorage) FeedStories(c context.Context, feed string, sq StoryQuery) ([]*Story, string, error) {
+	gn := d.goon(c)
+	fk := d.feedKey(c, feed)
+	q := datastore.NewQuery(gn.Kind(&Story{})).Ancestor(fk).Order("-" + IDX_COL)
+	if !sq.Since.IsZero() {
+		q = q.Filter(IDX_COL+" >=", sq.Since)
+	}
+	if sq.Category != "" {
+		q = q.Filter("ck =", categoryKey(sq.Category))
+	}
+	keys, cur, err := d.keys(c, pageQuery(q, sq.Page))
+	if err != nil {
+		return nil, "", err
+	}
+	ids := make([]readStory, len(keys))
+	for i, k := range keys {
+		ids[i] = readStory{Feed: feed, Story: k.StringID()}
+	}
+	ss, err := d.GetStories(c, ids)
+	if err != nil {
+		return nil, "", err
+	}
+	stories := ss[:0]
+	for _, s := range ss {
+		if s != nil {
+			stories = append(stories, s)
+		}
+	}
+	return stories, cur, nil
+}
+
+func (d datastoreStorage) StoryContents(c context.Context, ids []readStory) ([]string, error) {
+	gn := d.goon(c)
+	scs := make([]*StoryContent, len(ids))
+	for i, id := range ids {
+		s := &Story{Id: id.Story, Parent: d.feedKey(c, id.Feed)}
+		scs[i] = &StoryContent{Id: 1, Parent: gn.Key(s)}
+	}
+	err := gn.GetMulti(scs)
+	ret := make([]string, len(ids))
+	for i, sc := range scs {
+		if _, err := notFound(err, i); err != nil {
+			return nil, err
+		}
+		ret[i] = sc.content()
+	}
+	return ret, nil
+}
+
+func (d datastoreStorage) DeleteStories(c context.Context, feed string) (int, error) {
+	gn := d.goon(c)
+	fk := d.feedKey(c, feed)
+	keys, _, err := d.keys(c, datastore.NewQuery(gn.Kind(&Story{})).Ancestor(fk))
+	if err != nil {
+		return 0, err
+	}
+	sckeys, _, err := d.keys(c, datastore.NewQuery(gn.Kind(&StoryContent{})).Ancestor(fk))
+	if err != nil {
+		return 0, err
+	}
+	if len(keys)+len(sckeys) == 0 {
+		return 0, nil
+	}
+	return len(keys), gn.DeleteMulti(append(keys, sckeys...))
+}
+
+func (d datastoreStorage) AuthorStories(c context.Context, author string, p Page) ([]readStory, []string, error) {
+	q := datastore.NewQuery(d.goon(c).Kind(&Story{})).
+		Filter("ak =", author).
+		Order("-" + IDX_COL)
+	var ids []readStory
+	var curs []string
+	it := d.goon(c).Run(pageQuery(q, p).KeysOnly())
+	for {
+		k, err := it.Next(nil)
+		if err == datastore.Done {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+		ic, err := it.Cursor()
+		if err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, readStory{Feed: k.Parent().StringID(), Story: k.StringID()})
+		curs = append(curs, ic.String())
+	}
+	return ids, curs, nil
+}
+
+func (d datastoreStorage) CountStories(c context.Context, feed string, since time.Time) (int, error) {
+	q := datastore.NewQuery(d.goon(c).Kind(&Story{})).Ancestor(d.feedKey(c, feed))
+	if !since.IsZero() {
+		q = q.Filter(IDX_COL+" >=", since)
+	}
+	return q.Count(c)
+}
+
+func (d datastoreStorage) GetUser(c context.Context, id string) (*User, error) {
+	u := &User{Id: id}
+	return u, d.goon(c).Get(u)
+}
+
+func (d datastoreStorage) FindUser(c context.Context, email string) (*User, error) {
+	var us []*User
+	q := datastore.NewQuery(d.goon(c).Kind(&User{})).Filter("e =", email).Limit(1)
+	if _, err := d.goon(c).GetAll(q, &us); err != nil {
+		return nil, err
+	} else if len(us) == 0 {
+		return &User{}, ErrNotFound
+	}
+	return us[0], nil
+}
+
+func (d datastoreStorage) PutUser(c context.Context, u *User) error {
+	_, err := d.goon(c).Put(u)
+	return err
+}
+
+func (d datastoreStorage) UserIds(c context.Context, p Page) ([]string, string, error) {
+	keys, cur, err := d.keys(c, pageQuery(datastore.NewQuery(d.goon(c).Kind(&User{})), p))
+	ids := make([]string, len(keys))
+	for i, k := range keys {
+		ids[i] = k.StringID()
+	}
+	return ids, cur, err
+}
+
+func (d datastoreStorage) CountUsers(c context.Context) (int, error) {
+	return datastore.NewQuery(d.goon(c).Kind(&User{})).Count(c)
+}
+
+func (d datastoreStorage) DeleteUser(c context.Context, id string) error {
+	q := datastore.NewQuery("").Ancestor(d.userKey(c, id))
+	keys, _, err := d.keys(c, q)
+	if err != nil {
+		return err
+	}
+	return d.goon(c).DeleteMulti(keys)
+}
+
+func (d datastoreStorage) GetUserData(c context.Context, uid string) (*UserData, error) {
+	ud := &UserData{Id: "data", Parent: d.userKey(c, uid)}
+	return ud, d.goon(c).Get(ud)
+}
+
+func (d datastoreStorage) PutUserData(c context.Context, uid string, ud *UserData) error {
+	ud.Id = "data"
+	ud.Parent = d.userKey(c, uid)
+	_, err := d.goon(c).Put(ud)
+	return err
+}
+
+func (d datastoreStorage) GetUserOpml(c context.Context, uid string, id int64) (*UserOpml, error) {
+	uo := &UserOpml{Id: id, Parent: d.userKey(c, uid)}
+	return uo, d.goon(c).Get(uo)
+}
+
+func (d datastoreStorage) PutUserOpml(c context.Context, uid string, uo *UserOpml) error {
+	uo.Parent = d.userKey(c, uid)
+	_, err := d.goon(c).Put(uo)
+	return err
+}
+
+func (d datastoreStorage) UserOpmls(c context.Context, uid string) ([]int64, error) {
+	q := datastore.NewQuery(d.goon(c).Kind(&UserOpml{})).Ancestor(d.userKey(c, uid))
+	keys, _, err := d.keys(c, q)
+	ids := make([]int64, len(keys))
+	for i, k := range keys {
+		ids[i] = k.IntID()
+	}
+	return ids, err
+}
+
+// starKey returns the key-only star of story for the user uid.
+func (d datastoreStorage) starKey(c context.Context, uid, feed, story string) *UserStar {
+	return &UserStar{
+		Parent: datastore.NewKey(c, "USF", feed, 0, d.userKey(c, uid)),
+		Id:     story,
+		Feed:   feed,
+		Story:  story,
+	}
+}
+
+func (d datastoreStorage) PutStar(c context.Context, uid string, us *UserStar) error {
+	k := d.starKey(c, uid, us.Feed, us.Story)
+	us.Id, us.Parent = k.Id, k.Parent
+	_, err := d.goon(c).Put(us)
+	return err
+}
+
+func (d datastoreStorage) DeleteStar(c context.Context, uid, feed, story string) error {
+	gn := d.goon(c)
+	return gn.Delete(gn.Key(d.starKey(c, uid, feed, story)))
+}
+
+func (d datastoreStorage) Stars(c context.Context, uid string, sq StarQuery) ([]*UserStar, string, error) {
+	gn := d.goon(c)
+	q := datastore.NewQuery(gn.Kind(&UserStar{}))
+	if sq.Feed != "" {
+		q = q.Ancestor(gn.Key(d.starKey(c, uid, sq.Feed, "")).Parent())
+	} else {
+		q = q.Ancestor(d.userKey(c, uid)).Order("-c")
+	}
+	if !sq.Since.IsZero() {
+		q = q.Filter("c >=", sq.Since)
+	}
+	var stars []*UserStar
+	it := gn.Run(pageQuery(q, sq.Page))
+	for {
+		var us UserStar
+		k, err := it.Next(&us)
+		if err == datastore.Done {
+			break
+		} else if err != nil {
+			return nil, "", err
+		}
+		us.Feed = k.Parent().StringID()
+		us.Story = k.StringID()
+		stars = append(stars, &us)
+	}
+	cur := ""
+	if ic, err := it.Cursor(); err == nil {
+		cur = ic.String()
+	}
+	return stars, cur, nil
+}
+
+// readKey returns the key-only read of story for the user uid.
+func (d datastoreStorage) readKey(c context.Context, uid, feed, story string) *UserRead {
+	return &UserRead{
+		Parent: datastore.NewKey(c, "URF", feed, 0, d.userKey(c, uid)),
+		Id:     story,
+		Feed:   feed,
+		Story:  story,
+	}
+}
+
+func (d datastoreStorage) PutReads(c context.Context, uid string, reads []*UserRead) error {
+	if len(reads) == 0 {
+		return nil
+	}
+	for _, r := range reads {
+		k := d.readKey(c, uid, r.Feed, r.Story)
+		r.Id, r.Parent = k.Id, k.Parent
+	}
+	_, err := d.goon(c).PutMulti(reads)
+	return err
+}
+
+func (d datastoreStorage) DeleteReads(c context.Context, uid string, ids []readStory) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	gn := d.goon(c)
+	keys := make([]*datastore.Key, len(ids))
+	for i, id := range ids {
+		keys[i] = gn.Key(d.readKey(c, uid, id.Feed, id.Story))
+	}
+	return gn.DeleteMulti(keys)
+}
+
+func (d datastoreStorage) FeedReads(c context.Context, uid, feed string, since time.Time) ([]*UserRead, error) {
+	gn := d.goon(c)
+	q := datastore.NewQuery(gn.Kind(&UserRead{})).
+		Ancestor(d.readKey(c, uid, feed, "").Parent)
+	if !since.IsZero() {
+		q = q.Filter("c >=", since)
+	}
+	var reads []*UserRead
+	if _, err := gn.GetAll(q, &reads); err != nil {
+		return nil, err
+	}
+	for _, r := range reads {
+		r.Feed = r.Parent.StringID()
+		r.Story = r.Id
+	}
+	return reads, nil
+}
+
+func (d datastoreStorage) DeleteReadsBefore(c context.Context, uid string, t time.Time) error {
+	gn := d.goon(c)
+	q := datastore.NewQuery(gn.Kind(&UserRead{})).Ancestor(d.userKey(c, uid))
+	if !t.IsZero() {
+		q = q.Filter("c <", t)
+	}
+	keys, _, err := d.keys(c, q)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+	return gn.DeleteMulti(keys)
+}
+
+func (d datastoreStorage) playbackKey(c context.Context, uid, feed, story string) *UserPlayback {
+	return &UserPlayback{
+		Parent: datastore.NewKey(c, "UPF", feed, 0, d.userKey(c, uid)),
+		Id:     story,
+		Feed:   feed,
+		Story:  story,
+	}
+}
+
+func (d datastoreStorage) GetPlayback(c context.Context, uid, feed, story string) (*UserPlayback, error) {
+	p := d.playbackKey(c, uid, feed, story)
+	return p, d.goon(c).Get(p)
+}
+
+func (d datastoreStorage) PutPlayback(c context.Context, uid string, p *UserPlayback) error {
+	k := d.playbackKey(c, uid, p.Feed, p.Story)
+	p.Id, p.Parent = k.Id, k.Parent
+	_, err := d.goon(c).Put(p)
+	return err
+}
+
+func (d datastoreStorage) Playbacks(c context.Context, uid string, since time.Time, limit int) ([]*UserPlayback, error) {
+	gn := d.goon(c)
+	q := datastore.NewQuery(gn.Kind(&UserPlayback{})).
+		Ancestor(d.userKey(c, uid)).
+		Order("-u").
+		Limit(limit)
+	if !since.IsZero() {
+		q = q.Filter("u >=", since)
+	}
+	var playback []*UserPlayback
+	if _, err := gn.GetAll(q, &playback); err != nil {
+		return nil, err
+	}
+	for _, p := range playback {
+		p.setIds()
+	}
+	return playback, nil
+}
+
+func (d datastoreStorage) FeedPlaybacks(c context.Context, uid, feed string) ([]*UserPlayback, error) {
+	gn := d.goon(c)
+	q := datastore.NewQuery(gn.Kind(&UserPlayback{})).
+		Ancestor(d.playbackKey(c, uid, feed, "").Parent)
+	var playback []*UserPlayback
+	if _, err := gn.GetAll(q, &playback); err != nil {
+		return nil, err
+	}
+	for _, p := range playback {
+		p.setIds()
+	}
+	return playback, nil
+}
+
+func (d datastoreStorage) DeletePlayback(c context.Context, uid, feed, story string) error {
+	gn := d.goon(c)
+	return gn.Delete(gn.Key(d.playbackKey(c, uid, feed, story)))
+}
+
+func (d datastoreStorage) GetCharge(c context.Context, uid string) (*UserCharge, error) {
+	uc := &UserCharge{Id: 1, Parent: d.userKey(c, uid)}
+	return uc, d.goon(c).Get(uc)
+}
+
+func (d datastoreStorage) PutCharge(c context.Context, uid string, uc *UserCharge) error {
+	uc.Id = 1
+	uc.Parent = d.userKey(c, uid)
+	_, err := d.goon(c).Put(uc)
+	return err
+}
+
+func (d datastoreStorage) DeleteCharge(c context.Context, uid string) error {
+	gn := d.goon(c)
+	return gn.Delete(gn.Key(&UserCharge{Id: 1, Parent: d.userKey(c, uid)}))
+}
+
+func (d datastoreStorage) GetDateFailures(c context.Context, ids []string) ([]*DateFailure, error) {
+	dfs := make([]*DateFailure, len(ids))
+	for i, id := range ids {
+		dfs[i] = &DateFailure{Id: id}
+	}
+	err := d.goon(c).GetMulti(dfs)
+	for i := range dfs {
+		if nf, err := notFound(err, i); err != nil {
+			return nil, err
+		} else if nf {
+			dfs[i] = nil
+		}
+	}
+	return dfs, nil
+}
+
+func (d datastoreStorage) PutDateFailures(c context.Context, dfs []*DateFailure) error {
+	_, err := d.goon(c).PutMulti(dfs)
+	return err
+}
+
+func (d datastoreStorage) DateFailures(c context.Context, limit int) ([]*DateFailure, error) {
+	gn := d.goon(c)
+	var dfs []*DateFailure
+	q := datastore.NewQuery(gn.Kind(&DateFailure{})).Order("-l").Limit(limit)
+	_, err := gn.GetAll(q, &dfs)
+	return dfs, err
+}
+
+func (d datastoreStorage) GetImage(c context.Context, id string) (*Image, error) {
+	img := &Image{Id: id}
+	return img, d.goon(c).Get(img)
+}
+
+func (d datastoreStorage) PutImage(c context.Context, img *Image) error {
+	_, err := d.goon(c).Put(img)
+	return err
+}
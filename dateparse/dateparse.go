@@ -0,0 +1,530 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package dateparse parses the dates found in feeds. The input is tokenized
+// once and the tokens are read as RFC 822, RFC 1123, RFC 3339 or ISO 8601
+// dates, along with the many variants feeds produce. Month and day names are
+// recognized in several languages.
+package dateparse
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type kind int
+
+const (
+	space kind = iota
+	number
+	word
+	punct
+)
+
+type token struct {
+	kind kind
+	s    string
+	v    int // value of numbers up to 9 digits
+}
+
+func tokenize(s string) []token {
+	var toks []token
+	rs := []rune(s)
+	for i := 0; i < len(rs); {
+		j := i + 1
+		k := punct
+		switch r := rs[i]; {
+		case r >= '0' && r <= '9':
+			k = number
+			for j < len(rs) && rs[j] >= '0' && rs[j] <= '9' {
+				j++
+			}
+		case unicode.IsLetter(r):
+			k = word
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.Is(unicode.Mn, rs[j])) {
+				j++
+			}
+		case unicode.IsSpace(r):
+			k = space
+			for j < len(rs) && unicode.IsSpace(rs[j]) {
+				j++
+			}
+		}
+		t := token{kind: k, s: string(rs[i:j])}
+		switch k {
+		case number:
+			if len(t.s) <= 9 {
+				t.v, _ = strconv.Atoi(t.s)
+			} else {
+				t.v = -1
+			}
+		case word:
+			t.s = fold(t.s)
+		}
+		toks = append(toks, t)
+		i = j
+	}
+	return toks
+}
+
+var folds = map[rune]rune{
+	'à': 'a', 'á': 'a', 'â': 'a', 'ã': 'a', 'ä': 'a', 'å': 'a', 'ą': 'a',
+	'ç': 'c', 'ć': 'c', 'č': 'c',
+	'è': 'e', 'é': 'e', 'ê': 'e', 'ë': 'e', 'ę': 'e', 'ě': 'e',
+	'ì': 'i', 'í': 'i', 'î': 'i', 'ï': 'i', 'ı': 'i',
+	'ğ': 'g', 'ł': 'l', 'ñ': 'n', 'ń': 'n', 'ř': 'r',
+	'ò': 'o', 'ó': 'o', 'ô': 'o', 'õ': 'o', 'ö': 'o', 'ø': 'o',
+	'ś': 's', 'ş': 's', 'š': 's',
+	'ù': 'u', 'ú': 'u', 'û': 'u', 'ü': 'u', 'ů': 'u',
+	'ý': 'y', 'ÿ': 'y', 'ź': 'z', 'ż': 'z', 'ž': 'z',
+}
+
+// fold lower-cases a word and strips the diacritics commonly left off in
+// abbreviations.
+func fold(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.Is(unicode.Mn, r) {
+			return -1
+		}
+		r = unicode.ToLower(r)
+		if f, ok := folds[r]; ok {
+			return f
+		}
+		return r
+	}, s)
+}
+
+// Month names in English, German, French, Spanish, Italian, Portuguese,
+// Dutch, Swedish, Danish, Norwegian, Polish, Russian and Turkish. Any prefix
+// of at least three letters that names a single month is accepted, so
+// abbreviations need only be listed when they are not prefixes.
+var monthNames = [12][]string{
+	{"january", "januar", "janvier", "enero", "gennaio", "janeiro", "januari", "styczeń", "stycznia", "январь", "января", "ocak"},
+	{"february", "februar", "février", "febrero", "febbraio", "fevereiro", "februari", "luty", "lutego", "февраль", "февраля", "şubat"},
+	{"march", "märz", "mrz", "mars", "marzo", "março", "maart", "mrt", "marzec", "marca", "март", "марта", "mart"},
+	{"april", "avril", "abril", "aprile", "kwiecień", "kwietnia", "апрель", "апреля", "nisan"},
+	{"may", "mai", "mayo", "maggio", "maio", "mei", "maj", "maja", "май", "мая", "mayıs"},
+	{"june", "juni", "juin", "junio", "giugno", "junho", "czerwiec", "czerwca", "июнь", "июня", "haziran"},
+	{"july", "juli", "juillet", "julio", "luglio", "julho", "lipiec", "lipca", "июль", "июля", "temmuz"},
+	{"august", "août", "agosto", "augusti", "augustus", "sierpień", "sierpnia", "август", "августа", "ağustos"},
+	{"september", "septembre", "septiembre", "settembre", "setembro", "wrzesień", "września", "сентябрь", "сентября", "eylül"},
+	{"october", "oktober", "octobre", "octubre", "ottobre", "outubro", "październik", "października", "октябрь", "октября", "ekim"},
+	{"november", "novembre", "noviembre", "novembro", "listopad", "listopada", "ноябрь", "ноября", "kasım"},
+	{"december", "dezember", "décembre", "diciembre", "dicembre", "dezembro", "grudzień", "grudnia", "декабрь", "декабря", "aralık"},
+}
+
+// Day names in the same languages. Day names carry no information once the
+// date is known, so any prefix of two letters or more is skipped.
+var dayNames = []string{
+	"monday", "tuesday", "wednesday", "thursday", "friday", "saturday", "sunday",
+	"montag", "dienstag", "mittwoch", "donnerstag", "freitag", "samstag", "sonnabend", "sonntag",
+	"lundi", "mardi", "mercredi", "jeudi", "vendredi", "samedi", "dimanche",
+	"lunes", "martes", "miércoles", "jueves", "viernes", "sábado", "domingo",
+	"lunedì", "martedì", "mercoledì", "giovedì", "venerdì", "sabato", "domenica",
+	"segunda", "terça", "quarta", "quinta", "sexta",
+	"maandag", "dinsdag", "woensdag", "donderdag", "vrijdag", "zaterdag", "zondag",
+	"måndag", "tisdag", "onsdag", "torsdag", "fredag", "lördag", "söndag",
+	"mandag", "tirsdag", "lørdag", "søndag",
+	"poniedziałek", "wtorek", "środa", "czwartek", "piątek", "sobota", "niedziela", "pt",
+	"понедельник", "вторник", "среда", "четверг", "пятница", "суббота", "воскресенье",
+	"пн", "вт", "ср", "чт", "пт", "сб", "вс",
+	"pazartesi", "salı", "çarşamba", "perşembe", "cuma", "cumartesi", "pazar",
+}
+
+// Words that may separate the parts of a date without changing it.
+var fillers = map[string]bool{
+	"a": true, "as": true, "at": true, "de": true, "del": true,
+	"den": true, "der": true, "e": true, "el": true, "er": true, "feira": true,
+	"h": true, "kl": true, "klo": true, "la": true, "le": true, "nd": true,
+	"o": true, "of": true, "om": true, "on": true, "posted": true,
+	"published": true, "rd": true, "st": true, "t": true, "th": true,
+	"the": true, "uhr": true, "um": true, "updated": true, "y": true,
+	"в": true, "г": true, "года": true,
+}
+
+// Time zone abbreviations and their offsets in minutes east of UTC. Where an
+// abbreviation is ambiguous the most common use in feeds wins.
+var zones = map[string]int{
+	"z": 0, "ut": 0, "utc": 0, "gmt": 0, "wet": 0,
+	"bst": 60, "cet": 60, "met": 60, "west": 60, "wat": 60,
+	"cest": 120, "mest": 120, "eet": 120, "cat": 120, "sast": 120,
+	"eest": 180, "msk": 180, "eat": 180,
+	"ist": 330, "pkt": 300, "ict": 420, "wib": 420,
+	"awst": 480, "sgt": 480, "hkt": 480, "pht": 480,
+	"jst": 540, "kst": 540, "acst": 570, "aest": 600, "acdt": 630,
+	"aedt": 660, "nzst": 720, "nzdt": 780,
+	"ndt": -150, "nst": -210, "adt": -180, "brt": -180, "art": -180,
+	"ast": -240, "edt": -240, "est": -300, "cdt": -300, "cst": -360,
+	"mdt": -360, "mst": -420, "pdt": -420, "pst": -480,
+	"akdt": -480, "akst": -540, "hst": -600,
+}
+
+var months, days = func() (map[string]int, map[string]bool) {
+	m := make(map[string]int)
+	for i, names := range monthNames {
+		for _, n := range names {
+			rs := []rune(fold(n))
+			for j := 3; j <= len(rs); j++ {
+				p := string(rs[:j])
+				if o, ok := m[p]; !ok {
+					m[p] = i + 1
+				} else if o != i+1 {
+					// ambiguous, such as jui for juin and juillet
+					m[p] = 0
+				}
+			}
+		}
+	}
+	d := make(map[string]bool)
+	for _, n := range dayNames {
+		rs := []rune(fold(n))
+		for j := 2; j <= len(rs); j++ {
+			d[string(rs[:j])] = true
+		}
+	}
+	return m, d
+}()
+
+type num struct {
+	v, digits int
+	sep       string // punctuation right before the number
+}
+
+type monthWord struct {
+	m   int
+	day bool // also a day name
+}
+
+type parser struct {
+	toks   []token
+	nums   []num
+	months []monthWord
+
+	hasTime            bool
+	hour, min, sec, ns int
+	clockEnd           int // index of the last token of the time
+	meridiem           string
+
+	hasZone   bool
+	zone      int // minutes
+	hasOffset bool
+	offset    int // seconds
+}
+
+// Parse parses a date. Dates without a time zone are in UTC.
+func Parse(s string) (time.Time, error) {
+	p := parser{toks: tokenize(s), clockEnd: -1}
+	if err := p.scan(); err != nil {
+		return time.Time{}, fmt.Errorf("dateparse: %q: %v", s, err)
+	}
+	t, err := p.date()
+	if err != nil {
+		return time.Time{}, fmt.Errorf("dateparse: %q: %v", s, err)
+	}
+	return t, nil
+}
+
+func (p *parser) tok(i int) token {
+	if i < 0 || i >= len(p.toks) {
+		return token{kind: space}
+	}
+	return p.toks[i]
+}
+
+func (p *parser) scan() error {
+	for i := 0; i < len(p.toks); i++ {
+		t := p.toks[i]
+		switch t.kind {
+		case number:
+			if j, ok := p.clock(i); ok {
+				i = j
+				continue
+			}
+			if p.compact(i) {
+				continue
+			}
+			if t.v < 0 || len(t.s) > 4 {
+				return fmt.Errorf("unexpected number %s", t.s)
+			}
+			n := num{v: t.v, digits: len(t.s)}
+			if prev := p.tok(i - 1); prev.kind == punct {
+				n.sep = prev.s
+			}
+			p.nums = append(p.nums, n)
+		case punct:
+			if t.s == "+" || t.s == "-" {
+				if j, ok := p.zoneOffset(i); ok {
+					i = j
+				}
+			}
+		case word:
+			j, err := p.word(i)
+			if err != nil {
+				return err
+			}
+			i = j
+		}
+	}
+	return nil
+}
+
+// clock reads a time such as 15:04, 15:04:05.999 or 15h04 starting at i.
+func (p *parser) clock(i int) (int, bool) {
+	sep := p.tok(i + 1)
+	if len(p.toks[i].s) > 2 || !(sep.kind == punct && sep.s == ":" || sep.kind == word && sep.s == "h") {
+		return i, false
+	}
+	min := p.tok(i + 2)
+	if min.kind != number || len(min.s) > 2 {
+		return i, false
+	}
+	p.hasTime = true
+	p.hour, p.min, p.sec, p.ns = p.toks[i].v, min.v, 0, 0
+	j := i + 2
+	if p.tok(j+1).s == ":" && p.tok(j+2).kind == number && len(p.tok(j+2).s) <= 2 {
+		p.sec = p.tok(j + 2).v
+		j += 2
+		if s := p.tok(j + 1).s; (s == "." || s == ",") && p.tok(j+2).kind == number {
+			f := p.tok(j + 2).s
+			if len(f) > 9 {
+				f = f[:9]
+			}
+			p.ns, _ = strconv.Atoi(f + strings.Repeat("0", 9-len(f)))
+			j += 2
+		}
+		// a trailing :00, as in 15:04:05:00
+		if p.tok(j+1).s == ":" && p.tok(j+2).kind == number && p.tok(j+2).v == 0 && len(p.tok(j+2).s) == 2 {
+			j += 2
+		}
+	}
+	p.clockEnd = j
+	return j, true
+}
+
+// compact reads the basic ISO 8601 forms 20060102 and T150405.
+func (p *parser) compact(i int) bool {
+	t := p.toks[i]
+	switch {
+	case len(t.s) == 8 && len(p.nums) == 0 && len(p.months) == 0:
+		p.nums = append(p.nums, num{v: t.v / 10000, digits: 4}, num{v: t.v / 100 % 100, digits: 2}, num{v: t.v % 100, digits: 2})
+	case (len(t.s) == 6 || len(t.s) == 4) && p.tok(i-1).kind == word && p.tok(i-1).s == "t" && len(p.nums) >= 3 && !p.hasTime:
+		v := t.v
+		if len(t.s) == 4 {
+			v *= 100
+		}
+		p.hasTime = true
+		p.hour, p.min, p.sec = v/10000, v/100%100, v%100
+		p.clockEnd = i
+	default:
+		return false
+	}
+	return true
+}
+
+// zoneOffset reads a numeric time zone such as +0100, -07:00 or -7 starting
+// at the sign at i.
+func (p *parser) zoneOffset(i int) (int, bool) {
+	j := i
+	for p.tok(j+1).s == "+" || p.tok(j+1).s == "-" {
+		j++
+	}
+	sign := p.toks[j].s
+	n := p.tok(j + 1)
+	if n.kind != number {
+		return i, false
+	}
+	if sign == "-" {
+		prev := p.tok(i - 1)
+		if prev.kind == number && i-1 != p.clockEnd || prev.kind == punct && prev.s != ":" {
+			return i, false
+		}
+		if !p.hasTime && len(p.nums)+len(p.months) < 3 {
+			return i, false
+		}
+	}
+	var h, m, s int
+	switch len(n.s) {
+	case 1, 2:
+		h = n.v
+	case 3, 4:
+		h, m = n.v/100, n.v%100
+	default:
+		return i, false
+	}
+	j++
+	if len(n.s) <= 2 && p.tok(j+1).s == ":" && len(p.tok(j+2).s) == 2 && p.tok(j+2).kind == number {
+		m = p.tok(j + 2).v
+		j += 2
+	}
+	if p.tok(j+1).s == ":" && len(p.tok(j+2).s) == 2 && p.tok(j+2).kind == number {
+		s = p.tok(j + 2).v
+		j += 2
+	}
+	if h > 23 || m > 59 || s > 59 {
+		return i, false
+	}
+	p.hasOffset = true
+	p.offset = h*3600 + m*60 + s
+	if sign == "-" {
+		p.offset = -p.offset
+	}
+	return j, true
+}
+
+func (p *parser) word(i int) (int, error) {
+	w := p.toks[i].s
+	if (w == "a" || w == "p") && p.tok(i+1).s == "." && p.tok(i+2).s == "m" {
+		p.meridiem = w + "m"
+		return i + 2, nil
+	}
+	if m := months[w]; m > 0 {
+		p.months = append(p.months, monthWord{m: m, day: days[w]})
+		return i, nil
+	}
+	if z, ok := zones[w]; ok {
+		p.hasZone = true
+		p.zone = z
+		return i, nil
+	}
+	switch {
+	case w == "am" || w == "pm":
+		p.meridiem = w
+	case days[w] || fillers[w]:
+	case p.hasTime:
+		// An unknown time zone. Like time.Parse, treat it as UTC.
+	default:
+		return i, fmt.Errorf("unknown word %s", w)
+	}
+	return i, nil
+}
+
+func year(n num) (int, error) {
+	switch n.digits {
+	case 2:
+		if n.v >= 69 {
+			return 1900 + n.v, nil
+		}
+		return 2000 + n.v, nil
+	case 4:
+		return n.v, nil
+	}
+	return 0, fmt.Errorf("bad year %d", n.v)
+}
+
+func (p *parser) date() (time.Time, error) {
+	if len(p.months) > 1 {
+		var ms []monthWord
+		for _, m := range p.months {
+			if !m.day {
+				ms = append(ms, m)
+			}
+		}
+		p.months = ms
+	}
+	var y, m, d int
+	var extra []num
+	var err error
+	switch {
+	case len(p.months) > 1:
+		return time.Time{}, fmt.Errorf("several months")
+	case len(p.months) == 1:
+		m = p.months[0].m
+		yi := -1
+		for i, n := range p.nums {
+			if n.digits > 2 {
+				yi = i
+				break
+			}
+		}
+		if yi < 0 && len(p.nums) >= 2 {
+			yi = 1
+		}
+		if yi < 0 {
+			return time.Time{}, fmt.Errorf("no year")
+		}
+		if y, err = year(p.nums[yi]); err != nil {
+			return time.Time{}, err
+		}
+		rest := append(append([]num{}, p.nums[:yi]...), p.nums[yi+1:]...)
+		if len(rest) == 0 {
+			return time.Time{}, fmt.Errorf("no day")
+		}
+		d, extra = rest[0].v, rest[1:]
+	case len(p.nums) >= 3:
+		a, b, c := p.nums[0], p.nums[1], p.nums[2]
+		extra = p.nums[3:]
+		switch {
+		case a.digits == 4:
+			y, m, d = a.v, b.v, c.v
+		case c.digits == 4:
+			y = c.v
+			if b.sep == "." || a.v > 12 {
+				d, m = a.v, b.v
+			} else {
+				m, d = a.v, b.v
+			}
+		case a.digits <= 2 && b.digits <= 2 && c.digits <= 2:
+			if y, err = year(a); err != nil {
+				return time.Time{}, err
+			}
+			m, d = b.v, c.v
+		default:
+			return time.Time{}, fmt.Errorf("no year")
+		}
+	default:
+		return time.Time{}, fmt.Errorf("no date")
+	}
+	for _, n := range extra {
+		switch {
+		case !p.hasTime && n.digits <= 2:
+			// only an hour, as in "02 Jan 2006 15 -0700"
+			p.hasTime = true
+			p.hour = n.v
+		case n.v != 0:
+			return time.Time{}, fmt.Errorf("unexpected number %d", n.v)
+		}
+	}
+	if m < 1 || m > 12 {
+		return time.Time{}, fmt.Errorf("bad month %d", m)
+	}
+	if d < 1 || d > time.Date(y, time.Month(m)+1, 0, 0, 0, 0, 0, time.UTC).Day() {
+		return time.Time{}, fmt.Errorf("bad day %d", d)
+	}
+	switch p.meridiem {
+	case "am", "pm":
+		if p.hour < 1 || p.hour > 12 {
+			return time.Time{}, fmt.Errorf("bad hour %d", p.hour)
+		}
+		p.hour %= 12
+		if p.meridiem == "pm" {
+			p.hour += 12
+		}
+	}
+	if p.hour > 23 || p.min > 59 || p.sec > 59 {
+		return time.Time{}, fmt.Errorf("bad time %02d:%02d:%02d", p.hour, p.min, p.sec)
+	}
+	loc := time.UTC
+	switch {
+	case p.hasOffset && p.offset != 0:
+		loc = time.FixedZone("", p.offset)
+	case !p.hasOffset && p.hasZone && p.zone != 0:
+		loc = time.FixedZone("", p.zone*60)
+	}
+	return time.Date(y, time.Month(m), d, p.hour, p.min, p.sec, p.ns, loc), nil
+}
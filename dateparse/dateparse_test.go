@@ -0,0 +1,326 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package dateparse
+
+import (
+	"testing"
+	"time"
+)
+
+// layouts is the list of formats dates used to be tried against, in order.
+// It is kept as a regression corpus.
+var layouts = []string{
+	"01-02-2006",
+	"01/02/2006",
+	"01/02/2006 - 15:04",
+	"01/02/2006 15:04:05 MST",
+	"01/02/2006 3:04 PM",
+	"02-01-2006",
+	"02/01/2006",
+	"02.01.2006 -0700",
+	"02/01/2006 - 15:04",
+	"02.01.2006 15:04",
+	"02/01/2006 15:04:05",
+	"02.01.2006 15:04:05",
+	"02-01-2006 15:04:05 MST",
+	"02/01/2006 15:04 MST",
+	"02 Jan 2006",
+	"02 Jan 2006 15:04:05",
+	"02 Jan 2006 15:04:05 -0700",
+	"02 Jan 2006 15:04:05 MST",
+	"02 Jan 2006 15:04:05 UT",
+	"02 Jan 2006 15:04 MST",
+	"02 Monday, Jan 2006 15:04",
+	"06-1-2 15:04",
+	"06/1/2 15:04",
+	"1/2/2006",
+	"1/2/2006 15:04:05 MST",
+	"1/2/2006 3:04:05 PM",
+	"1/2/2006 3:04:05 PM MST",
+	"15:04 02.01.2006 -0700",
+	"2006-01-02",
+	"2006/01/02",
+	"2006-01-02 00:00:00.0 15:04:05.0 -0700",
+	"2006-01-02 15:04",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05-07:00",
+	"2006-01-02 15:04:05-0700",
+	"2006-01-02 15:04:05 MST",
+	"2006-01-02 15:04:05Z",
+	"2006-01-02 at 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04:05:00",
+	"2006-01-02T15:04:05 -0700",
+	"2006-01-02T15:04:05-07:00",
+	"2006-01-02T15:04:05-0700",
+	"2006-01-02T15:04:05:-0700",
+	"2006-01-02T15:04:05-07:00:00",
+	"2006-01-02T15:04:05Z",
+	"2006-01-02T15:04-07:00",
+	"2006-01-02T15:04Z",
+	"2006-1-02T15:04:05Z",
+	"2006-1-2",
+	"2006-1-2 15:04:05",
+	"2006-1-2T15:04:05Z",
+	"2006 January 02",
+	"2-1-2006",
+	"2/1/2006",
+	"2.1.2006 15:04:05",
+	"2 Jan 2006",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 Z",
+	"2 January 2006",
+	"2 January 2006 15:04:05 -0700",
+	"2 January 2006 15:04:05 MST",
+	"6-1-2 15:04",
+	"6/1/2 15:04",
+	"Jan 02, 2006",
+	"Jan 02 2006 03:04:05PM",
+	"Jan 2, 2006",
+	"Jan 2, 2006 15:04:05 MST",
+	"Jan 2, 2006 3:04:05 PM",
+	"Jan 2, 2006 3:04:05 PM MST",
+	"January 02, 2006",
+	"January 02, 2006 03:04 PM",
+	"January 02, 2006 15:04",
+	"January 02, 2006 15:04:05 MST",
+	"January 2, 2006",
+	"January 2, 2006 03:04 PM",
+	"January 2, 2006 15:04:05",
+	"January 2, 2006 15:04:05 MST",
+	"January 2, 2006, 3:04 p.m.",
+	"January 2, 2006 3:04 PM",
+	"Mon, 02 Jan 06 15:04:05 MST",
+	"Mon, 02 Jan 2006",
+	"Mon, 02 Jan 2006 15:04:05",
+	"Mon, 02 Jan 2006 15:04:05 00",
+	"Mon, 02 Jan 2006 15:04:05 -07",
+	"Mon 02 Jan 2006 15:04:05 -0700",
+	"Mon, 02 Jan 2006 15:04:05 --0700",
+	"Mon, 02 Jan 2006 15:04:05 -07:00",
+	"Mon, 02 Jan 2006 15:04:05 -0700",
+	"Mon,02 Jan 2006 15:04:05 -0700",
+	"Mon, 02 Jan 2006 15:04:05 GMT-0700",
+	"Mon , 02 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04:05MST",
+	"Mon, 02 Jan 2006, 15:04:05 MST",
+	"Mon, 02 Jan 2006 15:04:05 MST -0700",
+	"Mon, 02 Jan 2006 15:04:05 MST-07:00",
+	"Mon, 02 Jan 2006 15:04:05 UT",
+	"Mon, 02 Jan 2006 15:04:05 Z",
+	"Mon, 02 Jan 2006 15:04 -0700",
+	"Mon, 02 Jan 2006 15:04 MST",
+	"Mon,02 Jan 2006 15:04 MST",
+	"Mon, 02 Jan 2006 15 -0700",
+	"Mon, 02 Jan 2006 3:04:05 PM MST",
+	"Mon, 02 January 2006",
+	"Mon,02 January 2006 14:04:05 MST",
+	"Mon, 2006-01-02 15:04",
+	"Mon, 2 Jan 06 15:04:05 -0700",
+	"Mon, 2 Jan 06 15:04:05 MST",
+	"Mon, 2 Jan 15:04:05 MST",
+	"Mon, 2 Jan 2006",
+	"Mon,2 Jan 2006",
+	"Mon, 2 Jan 2006 15:04",
+	"Mon, 2 Jan 2006 15:04:05",
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05-0700",
+	"Mon, 2 Jan 2006 15:04:05 -0700 MST",
+	"mon,2 Jan 2006 15:04:05 MST",
+	"Mon 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04:05MST",
+	"Mon, 2 Jan 2006 15:04:05 UT",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006, 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"Mon, 2, Jan 2006 15:4",
+	"Mon, 2 Jan 2006 15:4:5 -0700 GMT",
+	"Mon, 2 Jan 2006 15:4:5 MST",
+	"Mon, 2 Jan 2006 3:04:05 PM -0700",
+	"Mon, 2 January 2006",
+	"Mon, 2 January 2006 15:04:05 -0700",
+	"Mon, 2 January 2006 15:04:05 MST",
+	"Mon, 2 January 2006, 15:04:05 MST",
+	"Mon, 2 January 2006, 15:04 -0700",
+	"Mon, 2 January 2006 15:04 MST",
+	"Monday, 02 January 2006 15:04:05",
+	"Monday, 02 January 2006 15:04:05 -0700",
+	"Monday, 02 January 2006 15:04:05 MST",
+	"Monday, 2 Jan 2006 15:04:05 -0700",
+	"Monday, 2 Jan 2006 15:04:05 MST",
+	"Monday, 2 January 2006 15:04:05 -0700",
+	"Monday, 2 January 2006 15:04:05 MST",
+	"Monday, January 02, 2006",
+	"Monday, January 2, 2006",
+	"Monday, January 2, 2006 03:04 PM",
+	"Monday, January 2, 2006 15:04:05 MST",
+	"Mon Jan 02 2006 15:04:05 -0700",
+	"Mon, Jan 02,2006 15:04:05 MST",
+	"Mon Jan 02, 2006 3:04 pm",
+	"Mon Jan 2 15:04:05 2006 MST",
+	"Mon Jan 2 15:04 2006",
+	"Mon, Jan 2 2006 15:04:05 -0700",
+	"Mon, Jan 2 2006 15:04:05 -700",
+	"Mon, Jan 2, 2006 15:04:05 MST",
+	"Mon, Jan 2 2006 15:04 MST",
+	"Mon, Jan 2, 2006 15:04 MST",
+	"Mon, January 02, 2006 15:04:05 MST",
+	"Mon, January 02, 2006, 15:04:05 MST",
+	"Mon, January 2 2006 15:04:05 -0700",
+	time.ANSIC,
+	time.RFC1123,
+	time.RFC1123Z,
+	time.RFC3339,
+	time.RFC822,
+	time.RFC822Z,
+	time.RFC850,
+	time.RubyDate,
+	time.UnixDate,
+	"Updated January 2, 2006",
+}
+
+// scan parses s the old way, with the first layout that matches.
+func scan(s string) (time.Time, error) {
+	var err error
+	for _, l := range layouts {
+		var t time.Time
+		if t, err = time.Parse(l, s); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, err
+}
+
+// literal holds layouts whose "zone" or "meridiem" is not a layout element
+// and so was matched as text, where Parse reads it.
+var literal = map[string]bool{
+	"January 2, 2006, 3:04 p.m.":    true,
+	"Mon, Jan 2 2006 15:04:05 -700": true,
+}
+
+type sample struct {
+	layout, s string
+}
+
+func corpus() []sample {
+	refs := []time.Time{
+		time.Date(2013, 5, 6, 7, 8, 9, 0, time.UTC),
+		time.Date(2013, 11, 23, 19, 45, 30, 0, time.FixedZone("", -7*3600)),
+		time.Date(1999, 12, 31, 12, 0, 0, 0, time.FixedZone("", 5*3600+30*60)),
+	}
+	var c []sample
+	for _, ref := range refs {
+		for _, l := range layouts {
+			c = append(c, sample{l, ref.Format(l)})
+		}
+	}
+	return c
+}
+
+func TestCorpus(t *testing.T) {
+	for _, c := range corpus() {
+		s := c.s
+		want, err := scan(s)
+		if err != nil || literal[c.layout] {
+			continue
+		}
+		got, err := Parse(s)
+		if err != nil {
+			if want.Year() == 0 {
+				// The layout had no year.
+				continue
+			}
+			t.Errorf("%q: %v", s, err)
+			continue
+		}
+		if got.Equal(want) {
+			continue
+		}
+		// The layouts disagree on whether 05/06/2013 is in May or June.
+		// Parse always reads it as month first.
+		swapped := time.Date(got.Year(), time.Month(got.Day()), int(got.Month()), got.Hour(), got.Minute(), got.Second(), got.Nanosecond(), got.Location())
+		if swapped.Equal(want) && got.Day() <= 12 {
+			continue
+		}
+		t.Errorf("%q: got %v, want %v", s, got, want)
+	}
+}
+
+func TestParse(t *testing.T) {
+	ts := time.Date(2013, 5, 6, 7, 8, 9, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2013-05-06T07:08:09Z", ts},
+		{"2013-05-06T09:08:09+02:00", ts},
+		{"2013-05-06T07:08:09.123456789Z", ts.Add(123456789)},
+		{"20130506T070809Z", ts},
+		{"Mon, 06 May 2013 03:08:09 EDT", ts},
+		{"Mon, 6 May 2013 07:08:09 GMT+0000", ts},
+		{"6 May 2013 7:08:09 am", ts},
+		{"May 6th, 2013 at 7:08:09", ts},
+		{"lun., 6 mai 2013 09:08:09 +0200", ts},
+		{"Montag, 6. Mai 2013 07:08:09 Uhr", ts},
+		{"Mo, 06 Mär 2013 07:08:09 GMT", time.Date(2013, 3, 6, 7, 8, 9, 0, time.UTC)},
+		{"6 de mayo de 2013 07:08:09", ts},
+		{"mar, 6 maggio 2013 07:08:09", ts},
+		{"6 мая 2013 г. 07:08:09", ts},
+		{"6 juil. 2013 07h08", time.Date(2013, 7, 6, 7, 8, 0, 0, time.UTC)},
+		{"Paz, 6 Eki 2013 07:08:09", time.Date(2013, 10, 6, 7, 8, 9, 0, time.UTC)},
+		{"6.5.2013", time.Date(2013, 5, 6, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		got, err := Parse(test.in)
+		if err != nil {
+			t.Errorf("%q: %v", test.in, err)
+		} else if !got.Equal(test.want) {
+			t.Errorf("%q: got %v, want %v", test.in, got, test.want)
+		}
+	}
+	for _, s := range []string{
+		"",
+		"yesterday",
+		"6 jui 2013",
+		"2013-02-30",
+		"1367824089",
+		"13:61 6 May 2013",
+	} {
+		if got, err := Parse(s); err == nil {
+			t.Errorf("%q: expected error, got %v", s, got)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	c := corpus()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Parse(c[i%len(c)].s)
+	}
+}
+
+func BenchmarkLayouts(b *testing.B) {
+	c := corpus()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		scan(c[i%len(c)].s)
+	}
+}
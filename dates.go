@@ -0,0 +1,195 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/msde/goread/dateparse"
+	"github.com/msde/goread/platform/log"
+)
+
+const (
+	// Most date failures recorded per parsed feed.
+	dateFailuresPerFeed = 10
+
+	// Most recent date failures shown on the admin page.
+	dateFailuresShown = 1000
+)
+
+func dateFailureId(feed, raw string) string {
+	h := sha1.Sum([]byte(feed + "|" + raw))
+	return hex.EncodeToString(h[:])
+}
+
+var dateWords = func() map[string]string {
+	m := make(map[string]string)
+	for i := time.January; i <= time.December; i++ {
+		m[strings.ToLower(i.String())] = "Mon"
+		m[strings.ToLower(i.String()[:3])] = "Mon"
+	}
+	for i := time.Sunday; i <= time.Saturday; i++ {
+		m[strings.ToLower(i.String())] = "Day"
+		m[strings.ToLower(i.String()[:3])] = "Day"
+	}
+	return m
+}()
+
+// dateShape normalizes a date string so that dates written the same way
+// group together: digits become 0 and English month and day names become
+// Mon and Day. Other words, such as time zones or foreign month names, are
+// kept.
+func dateShape(raw string) string {
+	var b strings.Builder
+	rs := []rune(raw)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsDigit(r):
+			b.WriteRune('0')
+			i++
+		case unicode.IsLetter(r):
+			j := i
+			for j < len(rs) && unicode.IsLetter(rs[j]) {
+				j++
+			}
+			w := string(rs[i:j])
+			if s, ok := dateWords[strings.ToLower(w)]; ok {
+				w = s
+			}
+			b.WriteString(w)
+			i = j
+		default:
+			b.WriteRune(r)
+			i++
+		}
+	}
+	return b.String()
+}
+
+// recordDateFailures stores dates of feedUrl that parseDate couldn't parse,
+// counting repeats. Callers pass only the failures of newly stored stories,
+// so each story counts once rather than once per poll.
+func recordDateFailures(c context.Context, feedUrl string, failures []string) {
+	if len(failures) == 0 || feedUrl == "" {
+		return
+	}
+	seen := make(map[string]bool)
+	var dfs []*DateFailure
+	for _, d := range failures {
+		if seen[d] || len(dfs) >= dateFailuresPerFeed {
+			continue
+		}
+		seen[d] = true
+		dfs = append(dfs, &DateFailure{Id: dateFailureId(feedUrl, d), Raw: d})
+	}
+	ids := make([]string, len(dfs))
+	for i, df := range dfs {
+		ids[i] = df.Id
+	}
+	stored, err := Store.GetDateFailures(c, ids)
+	if err != nil {
+		log.Warningf(c, "date failures get: %v", err)
+		return
+	}
+	now := time.Now()
+	for i, df := range dfs {
+		if stored[i] == nil {
+			df.First = now
+		} else {
+			dfs[i], df = stored[i], stored[i]
+		}
+		df.Feed = feedUrl
+		df.Shape = dateShape(df.Raw)
+		df.Count++
+		df.Last = now
+	}
+	if err := Store.PutDateFailures(c, dfs); err != nil {
+		log.Warningf(c, "date failures put: %v", err)
+	}
+}
+
+type dateSample struct {
+	*DateFailure
+
+	// Known is set if dateparse parses the sample by now.
+	Known bool
+
+	// Result of parsing the sample with a candidate layout.
+	Parsed time.Time
+	Err    string
+}
+
+type dateShapeGroup struct {
+	Shape   string
+	Count   int
+	Matched int
+	Samples []*dateSample
+}
+
+// dateFailureGroups loads the most recent date failures grouped by shape,
+// largest group first.
+func dateFailureGroups(c context.Context) ([]*dateShapeGroup, error) {
+	dfs, err := Store.DateFailures(c, dateFailuresShown)
+	if err != nil {
+		return nil, err
+	}
+	groups := make(map[string]*dateShapeGroup)
+	var gs []*dateShapeGroup
+	for _, df := range dfs {
+		g := groups[df.Shape]
+		if g == nil {
+			g = &dateShapeGroup{Shape: df.Shape}
+			groups[df.Shape] = g
+			gs = append(gs, g)
+		}
+		g.Count += df.Count
+		sample := &dateSample{DateFailure: df}
+		if _, err := dateparse.Parse(df.Raw); err == nil {
+			sample.Known = true
+		}
+		g.Samples = append(g.Samples, sample)
+	}
+	sort.SliceStable(gs, func(i, j int) bool {
+		return gs[i].Count > gs[j].Count
+	})
+	return gs, nil
+}
+
+// testDateLayout parses every sample with layout, and returns how many
+// samples it parsed.
+func testDateLayout(groups []*dateShapeGroup, layout string) int {
+	n := 0
+	for _, g := range groups {
+		for _, s := range g.Samples {
+			if t, err := time.Parse(layout, strings.TrimSpace(s.Raw)); err == nil {
+				s.Parsed = t
+				g.Matched++
+				n++
+			} else {
+				s.Err = err.Error()
+			}
+		}
+	}
+	return n
+}
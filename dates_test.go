@@ -0,0 +1,59 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRecordDateFailures(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := newFeedServer(testItem{"1", time.Time{}}, testItem{"2", time.Now()})
+		defer s.Close()
+		subscribe(t, s)
+		count := func() int {
+			dfs, err := Store.GetDateFailures(context.Background(), []string{dateFailureId(s.feedUrl(), testBadDate)})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dfs[0] == nil {
+				return 0
+			}
+			if dfs[0].Raw != testBadDate || dfs[0].Feed != s.feedUrl() {
+				t.Errorf("failure: %+v", dfs[0])
+			}
+			return dfs[0].Count
+		}
+		if n := count(); n != 1 {
+			t.Fatalf("count after subscribing: %v", n)
+		}
+
+		// Polls that find nothing new don't count the same story again.
+		update(t, s)
+		update(t, s)
+		if n := count(); n != 1 {
+			t.Errorf("count after polls: %v", n)
+		}
+		s.add(testItem{"3", time.Time{}})
+		update(t, s)
+		if n := count(); n != 2 {
+			t.Errorf("count after a new story: %v", n)
+		}
+	})
+}
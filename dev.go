@@ -22,10 +22,10 @@ import (
 	"time"
 
 	"github.com/mjibson/goon"
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/user"
 
 	"google.golang.org/appengine/datastore"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/user"
 )
 
 func ClearRead(w http.ResponseWriter, r *http.Request) {
@@ -46,6 +46,7 @@ func ClearRead(w http.ResponseWriter, r *http.Request) {
 	u.Read = time.Time{}
 	ud.Read = nil
 	gn.PutMulti([]interface{}{u, ud})
+	Store.DeleteReadsBefore(c, cu.ID, time.Time{})
 	http.Redirect(w, r, "/", http.StatusFound)
 }
 
@@ -71,6 +72,7 @@ func ClearFeeds(w http.ResponseWriter, r *http.Request) {
 		ud.Read = nil
 		ud.Opml = nil
 		gn.PutMulti([]interface{}{u, ud})
+		Store.DeleteReadsBefore(c, cu.ID, time.Time{})
 		log.Infof(c, "%v cleared", u.Email)
 	}()
 	del := func(kind string) {
@@ -4,9 +4,12 @@ go 1.14
 
 require (
 	github.com/gorilla/mux v1.7.4
+	github.com/lib/pq v1.10.9
+	github.com/mattn/go-sqlite3 v1.14.6
 	github.com/mjibson/goon v1.0.0
 	github.com/msde/go-charset v0.0.0-20190617161244-0dc95cdf6f31
 	golang.org/x/net v0.0.0-20200501053045-e0ff5e5a1de5
 	golang.org/x/text v0.3.2
 	google.golang.org/appengine v1.6.6
+	gopkg.in/yaml.v2 v2.4.0
 )
@@ -0,0 +1,309 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/memcache"
+)
+
+const (
+	// A host that rate-limits us hostOffenseLimit times within
+	// hostOffenseWindow has all its feeds put on cooldown.
+	hostOffenseLimit  = 3
+	hostOffenseWindow = time.Hour
+	hostCooldownMin   = time.Hour
+	hostCooldownMax   = time.Hour * 24
+
+	// Upper bound on how far a Retry-After header can push back a feed.
+	retryAfterMax = time.Hour * 24 * 7
+
+	// Politeness limits: at most hostConcurrency fetches in flight and
+	// hostRate fetches per minute against any one host. Feeds of a busy
+	// host are pushed back by hostPushback plus some jitter.
+	hostConcurrency = 2
+	hostRate        = 30
+	hostPushback    = time.Minute * 2
+
+	// A crashed fetch never releases its slot; the counter expires instead.
+	hostActiveExpiration = time.Minute * 10
+
+	// Number of busiest hosts remembered for the admin page.
+	hostListSize = 100
+)
+
+// feedHost returns the lower-cased host name of a feed URL.
+func feedHost(feedUrl string) string {
+	u, err := url.Parse(feedUrl)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+// parseRetryAfter parses a Retry-After header, which is either a number
+// of seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) (time.Time, bool) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return time.Time{}, false
+	}
+	var t time.Time
+	if secs, err := strconv.ParseInt(v, 10, 64); err == nil {
+		if secs < 0 {
+			return time.Time{}, false
+		}
+		if secs > int64(retryAfterMax/time.Second) {
+			secs = int64(retryAfterMax / time.Second)
+		}
+		t = now.Add(time.Duration(secs) * time.Second)
+	} else if d, err := http.ParseTime(v); err == nil {
+		t = d
+	} else {
+		return time.Time{}, false
+	}
+	if t.Before(now) {
+		t = now
+	}
+	if max := now.Add(retryAfterMax); t.After(max) {
+		t = max
+	}
+	return t, true
+}
+
+func hostCooldownKey(host string) string {
+	return "_hostcooldown-" + host
+}
+
+func hostOffenseKey(host string) string {
+	return "_hostoffense-" + host
+}
+
+// hostCooldown returns the time until which fetches from host should be
+// deferred. It is zero if the host is not on cooldown.
+func hostCooldown(c context.Context, host string) time.Time {
+	if host == "" {
+		return time.Time{}
+	}
+	item, err := memcache.Get(c, hostCooldownKey(host))
+	if err != nil {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.RFC3339, string(item.Value))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+// noteRateLimited records that host answered with 429 or 503, asking us
+// to come back at retry (which may be zero). Repeat offenders are put on
+// a cooldown that grows with each further offense.
+func noteRateLimited(c context.Context, host string, retry time.Time) {
+	if host == "" {
+		return
+	}
+	key := hostOffenseKey(host)
+	memcache.Add(c, &memcache.Item{
+		Key:        key,
+		Value:      []byte("0"),
+		Expiration: hostOffenseWindow,
+	})
+	n, err := memcache.Increment(c, key, 1, 0)
+	if err != nil {
+		log.Warningf(c, "host offense count %v: %v", host, err)
+		return
+	}
+	if n < hostOffenseLimit {
+		return
+	}
+	d := hostCooldownMin * time.Duration(n-hostOffenseLimit+1)
+	if d > hostCooldownMax {
+		d = hostCooldownMax
+	}
+	until := time.Now().Add(d)
+	if retry.After(until) {
+		until = retry
+	}
+	log.Warningf(c, "host %v rate limited us %v times, cooling down until %v", host, n, until)
+	memcache.Set(c, &memcache.Item{
+		Key:        hostCooldownKey(host),
+		Value:      []byte(until.UTC().Format(time.RFC3339)),
+		Expiration: time.Until(until),
+	})
+}
+
+func hostActiveKey(host string) string {
+	return "_hostactive-" + host
+}
+
+func hostRateKey(host string, t time.Time) string {
+	return fmt.Sprintf("_hostrate-%v-%v", host, t.Unix()/60)
+}
+
+// acquireHost reserves a fetch slot for host. It returns false if the host
+// is at its concurrency or rate limit. Otherwise release must be called
+// when the fetch is done. Memcache failures let the fetch through.
+func acquireHost(c context.Context, host string) (release func(), ok bool) {
+	release = func() {}
+	if host == "" {
+		return release, true
+	}
+	ak := hostActiveKey(host)
+	memcache.Add(c, &memcache.Item{
+		Key:        ak,
+		Value:      []byte("0"),
+		Expiration: hostActiveExpiration,
+	})
+	n, err := memcache.Increment(c, ak, 1, 0)
+	if err != nil {
+		log.Warningf(c, "host active count %v: %v", host, err)
+		return release, true
+	}
+	release = func() {
+		memcache.Increment(c, ak, -1, 0)
+	}
+	if n > hostConcurrency {
+		release()
+		return func() {}, false
+	}
+	rk := hostRateKey(host, time.Now())
+	memcache.Add(c, &memcache.Item{
+		Key:        rk,
+		Value:      []byte("0"),
+		Expiration: time.Minute * 2,
+	})
+	if n, err := memcache.Increment(c, rk, 1, 0); err == nil && n > hostRate {
+		release()
+		return func() {}, false
+	}
+	return release, true
+}
+
+// hostPushbackTime returns when a feed whose host is busy should be
+// retried.
+func hostPushbackTime() time.Time {
+	return time.Now().Add(hostPushback + time.Duration(rand.Int63n(int64(hostPushback))))
+}
+
+// hostDelay returns how long the n-th (zero-based) feed from one host
+// queued in a single UpdateFeeds run should wait so the host's rate
+// limit is not exceeded.
+func hostDelay(n int) time.Duration {
+	return time.Minute * time.Duration(n/hostRate)
+}
+
+const hostListKey = "_hostlist"
+
+type hostCount struct {
+	Host   string
+	Queued int
+}
+
+// saveHostList remembers the hosts with the most feeds queued by the last
+// UpdateFeeds run.
+func saveHostList(c context.Context, hosts map[string]int) {
+	var hl []hostCount
+	for h, n := range hosts {
+		hl = append(hl, hostCount{h, n})
+	}
+	sort.Slice(hl, func(i, j int) bool {
+		if hl[i].Queued != hl[j].Queued {
+			return hl[i].Queued > hl[j].Queued
+		}
+		return hl[i].Host < hl[j].Host
+	})
+	if len(hl) > hostListSize {
+		hl = hl[:hostListSize]
+	}
+	b, err := json.Marshal(hl)
+	if err != nil {
+		return
+	}
+	memcache.Set(c, &memcache.Item{Key: hostListKey, Value: b})
+}
+
+type hostBudget struct {
+	Host     string
+	Queued   int
+	Active   int
+	Rate     int
+	Offenses int
+	Cooldown time.Time
+}
+
+// hostBudgets reports the current limiter state of the hosts saved by
+// saveHostList.
+func hostBudgets(c context.Context) ([]*hostBudget, error) {
+	item, err := memcache.Get(c, hostListKey)
+	if err == memcache.ErrCacheMiss {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var hl []hostCount
+	if err := json.Unmarshal(item.Value, &hl); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	var keys []string
+	for _, h := range hl {
+		keys = append(keys,
+			hostActiveKey(h.Host),
+			hostRateKey(h.Host, now),
+			hostOffenseKey(h.Host),
+			hostCooldownKey(h.Host),
+		)
+	}
+	items, err := memcache.GetMulti(c, keys)
+	if err != nil {
+		return nil, err
+	}
+	count := func(key string) int {
+		if i, ok := items[key]; ok {
+			n, _ := strconv.Atoi(string(i.Value))
+			return n
+		}
+		return 0
+	}
+	var budgets []*hostBudget
+	for _, h := range hl {
+		b := &hostBudget{
+			Host:     h.Host,
+			Queued:   h.Queued,
+			Active:   count(hostActiveKey(h.Host)),
+			Rate:     count(hostRateKey(h.Host, now)),
+			Offenses: count(hostOffenseKey(h.Host)),
+		}
+		if i, ok := items[hostCooldownKey(h.Host)]; ok {
+			b.Cooldown, _ = time.Parse(time.RFC3339, string(i.Value))
+		}
+		budgets = append(budgets, b)
+	}
+	return budgets, nil
+}
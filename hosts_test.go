@@ -0,0 +1,46 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, test := range []struct {
+		v  string
+		t  time.Time
+		ok bool
+	}{
+		{"", time.Time{}, false},
+		{"soon", time.Time{}, false},
+		{"-5", time.Time{}, false},
+		{"0", now, true},
+		{" 120 ", now.Add(time.Minute * 2), true},
+		{"999999999999", now.Add(retryAfterMax), true},
+		{"Thu, 02 Jan 2020 04:04:05 GMT", now.Add(time.Hour), true},
+		{"Thu, 02 Jan 2020 02:04:05 GMT", now, true},
+		{"Sat, 02 Jan 2021 03:04:05 GMT", now.Add(retryAfterMax), true},
+	} {
+		got, ok := parseRetryAfter(test.v, now)
+		if ok != test.ok || !got.Equal(test.t) {
+			t.Errorf("%q: got %v, %v; want %v, %v", test.v, got, ok, test.t, test.ok)
+		}
+	}
+}
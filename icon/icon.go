@@ -0,0 +1,233 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package icon decodes site icons, including the ICO format, and scales
+// them to a fixed size.
+package icon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+)
+
+// MaxDimension is the largest width or height Decode accepts.
+const MaxDimension = 2048
+
+var (
+	ErrFormat = errors.New("icon: unknown format")
+	ErrSize   = errors.New("icon: image too large")
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n")
+
+// Decode decodes an ICO, PNG, GIF or JPEG image. For ICO files the largest
+// image is used.
+func Decode(b []byte) (image.Image, error) {
+	if len(b) >= 6 && b[0] == 0 && b[1] == 0 && b[2] == 1 && b[3] == 0 {
+		return decodeICO(b)
+	}
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(b))
+	if err != nil {
+		return nil, ErrFormat
+	}
+	if cfg.Width > MaxDimension || cfg.Height > MaxDimension {
+		return nil, ErrSize
+	}
+	m, _, err := image.Decode(bytes.NewReader(b))
+	return m, err
+}
+
+func decodeICO(b []byte) (image.Image, error) {
+	n := int(binary.LittleEndian.Uint16(b[4:]))
+	best, bestSize := -1, 0
+	for i := 0; i < n; i++ {
+		e := 6 + i*16
+		if e+16 > len(b) {
+			break
+		}
+		w := int(b[e])
+		if w == 0 {
+			w = 256
+		}
+		if w > bestSize {
+			best, bestSize = e, w
+		}
+	}
+	if best < 0 {
+		return nil, ErrFormat
+	}
+	size := int(binary.LittleEndian.Uint32(b[best+8:]))
+	off := int(binary.LittleEndian.Uint32(b[best+12:]))
+	if off < 0 || size < 0 || off+size > len(b) || off+size < off {
+		return nil, ErrFormat
+	}
+	data := b[off : off+size]
+	if bytes.HasPrefix(data, pngHeader) {
+		return Decode(data)
+	}
+	return decodeDIB(data)
+}
+
+// decodeDIB decodes the headerless bitmap of an ICO entry: a
+// BITMAPINFOHEADER, an optional palette, the pixels and an AND mask, all
+// stored bottom-up.
+func decodeDIB(b []byte) (image.Image, error) {
+	if len(b) < 40 {
+		return nil, ErrFormat
+	}
+	le := binary.LittleEndian
+	hdr := int(le.Uint32(b))
+	w := int(int32(le.Uint32(b[4:])))
+	h := int(int32(le.Uint32(b[8:]))) / 2 // includes the mask
+	bpp := int(le.Uint16(b[14:]))
+	compression := le.Uint32(b[16:])
+	colors := int(le.Uint32(b[32:]))
+	if hdr < 40 || hdr > len(b) || w <= 0 || h <= 0 || w > 256 || h > 256 || compression != 0 {
+		return nil, ErrFormat
+	}
+	var palette []color.NRGBA
+	p := hdr
+	switch bpp {
+	case 1, 4, 8:
+		if colors == 0 || colors > 1<<uint(bpp) {
+			colors = 1 << uint(bpp)
+		}
+		if p+colors*4 > len(b) {
+			return nil, ErrFormat
+		}
+		for i := 0; i < colors; i++ {
+			c := b[p+i*4:]
+			palette = append(palette, color.NRGBA{c[2], c[1], c[0], 0xff})
+		}
+		p += colors * 4
+	case 24, 32:
+	default:
+		return nil, ErrFormat
+	}
+	stride := (w*bpp + 31) / 32 * 4
+	maskStride := (w + 31) / 32 * 4
+	if p+stride*h > len(b) {
+		return nil, ErrFormat
+	}
+	mask := b[p+stride*h:]
+	hasMask := len(mask) >= maskStride*h
+	m := image.NewNRGBA(image.Rect(0, 0, w, h))
+	anyAlpha := false
+	for y := 0; y < h; y++ {
+		row := b[p+(h-1-y)*stride:]
+		for x := 0; x < w; x++ {
+			var c color.NRGBA
+			switch bpp {
+			case 32:
+				c = color.NRGBA{row[x*4+2], row[x*4+1], row[x*4], row[x*4+3]}
+				anyAlpha = anyAlpha || c.A != 0
+			case 24:
+				c = color.NRGBA{row[x*3+2], row[x*3+1], row[x*3], 0xff}
+			default:
+				bit := x * bpp
+				i := int(row[bit/8]>>uint(8-bpp-bit%8)) & (1<<uint(bpp) - 1)
+				if i >= len(palette) {
+					return nil, ErrFormat
+				}
+				c = palette[i]
+			}
+			m.SetNRGBA(x, y, c)
+		}
+	}
+	// The AND mask marks transparent pixels unless the image has an alpha
+	// channel of its own.
+	if hasMask && !anyAlpha {
+		for y := 0; y < h; y++ {
+			row := mask[(h-1-y)*maskStride:]
+			for x := 0; x < w; x++ {
+				c := m.NRGBAAt(x, y)
+				c.A = 0xff
+				if row[x/8]&(0x80>>uint(x%8)) != 0 {
+					c.A = 0
+				}
+				m.SetNRGBA(x, y, c)
+			}
+		}
+	}
+	return m, nil
+}
+
+// Resize scales m to fit in a size by size square, keeping its aspect
+// ratio. Each destination pixel is the average of the source pixels it
+// covers.
+func Resize(m image.Image, size int) image.Image {
+	sb := m.Bounds()
+	sw, sh := sb.Dx(), sb.Dy()
+	dw, dh := size, size
+	if sw > sh {
+		dh = max(1, size*sh/sw)
+	} else if sh > sw {
+		dw = max(1, size*sw/sh)
+	}
+	src := image.NewRGBA(image.Rect(0, 0, sw, sh))
+	draw.Draw(src, src.Bounds(), m, sb.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		y0, y1 := y*sh/dh, max((y+1)*sh/dh, y*sh/dh+1)
+		for x := 0; x < dw; x++ {
+			x0, x1 := x*sw/dw, max((x+1)*sw/dw, x*sw/dw+1)
+			var r, g, b, a, n int
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					i := src.PixOffset(sx, sy)
+					r += int(src.Pix[i])
+					g += int(src.Pix[i+1])
+					b += int(src.Pix[i+2])
+					a += int(src.Pix[i+3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
+
+func max(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// Convert decodes an icon, scales it to size and encodes it as PNG.
+func Convert(b []byte, size int) ([]byte, error) {
+	m, err := Decode(b)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, Resize(m, size)); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
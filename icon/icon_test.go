@@ -0,0 +1,126 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package icon
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// ico wraps entries, each a width byte followed by image data, in an ICO
+// header.
+func ico(entries ...[]byte) []byte {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	binary.Write(&b, le, []uint16{0, 1, uint16(len(entries))})
+	off := 6 + 16*len(entries)
+	for _, e := range entries {
+		binary.Write(&b, le, []uint8{e[0], e[0], 0, 0})
+		binary.Write(&b, le, []uint16{1, 32})
+		binary.Write(&b, le, []uint32{uint32(len(e) - 1), uint32(off)})
+		off += len(e) - 1
+	}
+	for _, e := range entries {
+		b.Write(e[1:])
+	}
+	return b.Bytes()
+}
+
+// dib returns a 4bpp w by w bitmap whose pixels are all palette entry 1
+// (red), with the top-left pixel masked out.
+func dib(w int) []byte {
+	var b bytes.Buffer
+	le := binary.LittleEndian
+	binary.Write(&b, le, []uint32{40, uint32(w), uint32(2 * w)})
+	binary.Write(&b, le, []uint16{1, 4})
+	binary.Write(&b, le, []uint32{0, 0, 0, 0, 2, 0})
+	b.Write([]byte{0, 0, 0, 0, 0, 0, 0xff, 0})
+	stride := (w*4 + 31) / 32 * 4
+	for y := 0; y < w; y++ {
+		row := make([]byte, stride)
+		for x := 0; x < w/2; x++ {
+			row[x] = 0x11
+		}
+		b.Write(row)
+	}
+	maskStride := (w + 31) / 32 * 4
+	for y := 0; y < w; y++ {
+		row := make([]byte, maskStride)
+		if y == w-1 {
+			row[0] = 0x80
+		}
+		b.Write(row)
+	}
+	return append([]byte{byte(w)}, b.Bytes()...)
+}
+
+func TestDecodeICO(t *testing.T) {
+	m, err := Decode(ico(dib(16), dib(32)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds().Dx() != 32 {
+		t.Errorf("got width %d, want the largest entry", m.Bounds().Dx())
+	}
+	if _, _, _, a := m.At(0, 0).RGBA(); a != 0 {
+		t.Errorf("masked pixel is not transparent")
+	}
+	if c := color.NRGBAModel.Convert(m.At(1, 1)).(color.NRGBA); c != (color.NRGBA{0xff, 0, 0, 0xff}) {
+		t.Errorf("got %v, want red", c)
+	}
+
+	var p bytes.Buffer
+	png.Encode(&p, image.NewGray(image.Rect(0, 0, 48, 48)))
+	m, err = Decode(ico(append([]byte{48}, p.Bytes()...)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds().Dx() != 48 {
+		t.Errorf("png entry: got width %d", m.Bounds().Dx())
+	}
+
+	if _, err := Decode([]byte("<svg></svg>")); err != ErrFormat {
+		t.Errorf("svg: got %v", err)
+	}
+}
+
+func TestResize(t *testing.T) {
+	src := image.NewRGBA(image.Rect(0, 0, 64, 32))
+	for x := 0; x < 64; x++ {
+		for y := 0; y < 32; y++ {
+			if x%2 == 0 {
+				src.Set(x, y, color.White)
+			} else {
+				src.Set(x, y, color.Black)
+			}
+		}
+	}
+	m := Resize(src, 16)
+	if b := m.Bounds(); b.Dx() != 16 || b.Dy() != 8 {
+		t.Fatalf("got %v, want 16x8", b)
+	}
+	if r, _, _, _ := m.At(3, 3).RGBA(); r>>8 != 0x7f {
+		t.Errorf("got %x, want an average grey", r>>8)
+	}
+	if m := Resize(image.NewRGBA(image.Rect(0, 0, 8, 8)), 32); m.Bounds().Dx() != 32 {
+		t.Errorf("upscale: got %v", m.Bounds())
+	}
+}
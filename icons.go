@@ -0,0 +1,165 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/msde/goread/icon"
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/urlfetch"
+)
+
+const (
+	// Width and height of stored icons.
+	iconPixels = 32
+
+	// Largest icon, page or manifest downloaded while looking for an icon.
+	iconMaxBytes = 1 << 20
+
+	// Most candidate icons fetched per feed.
+	iconTries = 5
+
+	// How often a feed's icon is looked for, and how soon again when the
+	// site couldn't be reached.
+	iconInterval = time.Hour * 24 * 7
+	iconRetry    = time.Hour * 24
+
+	// How long browsers may cache an icon.
+	iconMaxAge = time.Hour * 24
+)
+
+// fetchLimited gets u. The response is also returned with a status error.
+func fetchLimited(client *http.Client, u string) (*http.Response, []byte, error) {
+	r, err := client.Get(u)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer r.Body.Close()
+	if r.StatusCode != http.StatusOK {
+		return r, nil, fmt.Errorf("%s: %s", u, r.Status)
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(r.Body, iconMaxBytes))
+	return r, b, err
+}
+
+// fetchMayPass reports whether a fetchLimited error may go away when
+// retried, unlike a missing page.
+func fetchMayPass(r *http.Response) bool {
+	return r == nil || r.StatusCode >= 500 || r.StatusCode == http.StatusTooManyRequests
+}
+
+// loadImage looks for the icon of f's site once every iconInterval. The
+// best icon that decodes is resized, stored as an Image and served by Icon.
+// It runs in scheduleNextUpdate, so a feed update waits for up to
+// iconTries+2 fetches about once a week. If the site couldn't be reached,
+// the icon found before is kept and another look is taken after iconRetry.
+func loadImage(c context.Context, f *Feed) {
+	if f.ImageDate.After(time.Now()) {
+		return
+	}
+	f.ImageDate = time.Now().Add(iconInterval)
+	unreachable := false
+	s := f.Link
+	if s == "" {
+		s = f.Url
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return
+	}
+	u.RawQuery = ""
+	u.Fragment = ""
+	client := urlfetch.Client(c)
+	var icons []*IconLink
+	if r, b, err := fetchLimited(client, u.String()); err == nil {
+		var manifest string
+		icons, manifest, _ = FindIcon(r.Request.URL, b, iconPixels)
+		if manifest != "" {
+			if r, b, err := fetchLimited(client, manifest); err == nil {
+				icons = sortIcons(append(icons, manifestIcons(r.Request.URL, b)...), iconPixels)
+			}
+		}
+	} else if fetchMayPass(r) {
+		unreachable = true
+	}
+	if fu, err := u.Parse("/favicon.ico"); err == nil {
+		icons = append(icons, &IconLink{Url: fu.String()})
+	}
+	if len(icons) > iconTries {
+		icons = icons[:iconTries]
+	}
+	for _, i := range icons {
+		r, b, err := fetchLimited(client, i.Url)
+		if err != nil && fetchMayPass(r) {
+			unreachable = true
+		} else if err == nil {
+			b, err = icon.Convert(b, iconPixels)
+		}
+		if err != nil {
+			log.Debugf(c, "icon %v: %v", i.Url, err)
+			continue
+		}
+		img := &Image{
+			Id:      f.Url,
+			Url:     i.Url,
+			Data:    b,
+			Type:    "image/png",
+			Updated: time.Now(),
+		}
+		if err := Store.PutImage(c, img); err != nil {
+			log.Errorf(c, "icon put %v: %v", f.Url, err)
+			f.ImageDate = time.Now().Add(iconRetry)
+			return
+		}
+		f.Image = f.IconURL()
+		return
+	}
+	if unreachable {
+		f.ImageDate = time.Now().Add(iconRetry)
+		return
+	}
+	f.Image = ""
+}
+
+// Icon serves the stored icon of a feed.
+func Icon(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	b, err := base64.URLEncoding.DecodeString(mux.Vars(r)["feed"])
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	img, err := Store.GetImage(c, string(b))
+	if err != nil || len(img.Data) == 0 {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", img.Type)
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(iconMaxAge.Seconds())))
+	w.Header().Set("ETag", fmt.Sprintf(`"%x"`, img.Updated.UnixNano()))
+	http.ServeContent(w, r, "", img.Updated, bytes.NewReader(img.Data))
+}
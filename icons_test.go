@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLoadImageFailures(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := newFeedServer(testItem{"1", time.Now()})
+		defer s.Close()
+		subscribe(t, s)
+		f, _ := Store.GetFeed(context.Background(), s.feedUrl())
+		icon := f.Image
+		if icon == "" {
+			t.Fatal("no icon")
+		}
+		load := func(status int) time.Duration {
+			s.mu.Lock()
+			s.status = status
+			s.mu.Unlock()
+			f.ImageDate = time.Time{}
+			loadImage(context.Background(), f)
+			return time.Until(f.ImageDate)
+		}
+
+		// A site that's down keeps its icon for now.
+		if d := load(http.StatusServiceUnavailable); f.Image != icon || d > iconRetry {
+			t.Errorf("after 503: icon %q, next look in %v", f.Image, d)
+		}
+		// A site without icons has none.
+		if d := load(http.StatusNotFound); f.Image != "" || d < iconInterval-time.Minute {
+			t.Errorf("after 404: icon %q, next look in %v", f.Image, d)
+		}
+	})
+}
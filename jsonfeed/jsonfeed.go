@@ -0,0 +1,107 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package jsonfeed defines JSON data structures for a JSON Feed,
+// versions 1.0 and 1.1: https://jsonfeed.org/version/1.1
+package jsonfeed
+
+import (
+	"strings"
+)
+
+const VersionPrefix = "https://jsonfeed.org/version/"
+
+type Feed struct {
+	Version     string    `json:"version"`
+	Title       string    `json:"title"`
+	HomePageURL string    `json:"home_page_url"`
+	FeedURL     string    `json:"feed_url"`
+	Description string    `json:"description"`
+	NextURL     string    `json:"next_url"`
+	Icon        string    `json:"icon"`
+	Favicon     string    `json:"favicon"`
+	Language    string    `json:"language"`
+	Author      *Author   `json:"author"`
+	Authors     []*Author `json:"authors"`
+	Expired     bool      `json:"expired"`
+	Hubs        []*Hub    `json:"hubs"`
+	Items       []*Item   `json:"items"`
+}
+
+// Valid reports whether f declares a JSON Feed version.
+func (f *Feed) Valid() bool {
+	return strings.HasPrefix(f.Version, VersionPrefix)
+}
+
+// Hub returns the URL of the first WebSub hub, if any.
+func (f *Feed) Hub() string {
+	for _, h := range f.Hubs {
+		if h.URL != "" && (h.Type == "" || strings.EqualFold(h.Type, "WebSub")) {
+			return h.URL
+		}
+	}
+	return ""
+}
+
+type Item struct {
+	ID            string        `json:"id"`
+	URL           string        `json:"url"`
+	ExternalURL   string        `json:"external_url"`
+	Title         string        `json:"title"`
+	ContentHTML   string        `json:"content_html"`
+	ContentText   string        `json:"content_text"`
+	Summary       string        `json:"summary"`
+	Image         string        `json:"image"`
+	BannerImage   string        `json:"banner_image"`
+	DatePublished string        `json:"date_published"`
+	DateModified  string        `json:"date_modified"`
+	Author        *Author       `json:"author"`
+	Authors       []*Author     `json:"authors"`
+	Tags          []string      `json:"tags"`
+	Language      string        `json:"language"`
+	Attachments   []*Attachment `json:"attachments"`
+}
+
+// AllAuthors returns the 1.1 authors list, falling back to the
+// 1.0 author object.
+func (i *Item) AllAuthors() []*Author {
+	if len(i.Authors) > 0 {
+		return i.Authors
+	}
+	if i.Author != nil {
+		return []*Author{i.Author}
+	}
+	return nil
+}
+
+type Author struct {
+	Name   string `json:"name"`
+	URL    string `json:"url"`
+	Avatar string `json:"avatar"`
+}
+
+type Attachment struct {
+	URL               string  `json:"url"`
+	MimeType          string  `json:"mime_type"`
+	Title             string  `json:"title"`
+	SizeInBytes       int64   `json:"size_in_bytes"`
+	DurationInSeconds float64 `json:"duration_in_seconds"`
+}
+
+type Hub struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
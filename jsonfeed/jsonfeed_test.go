@@ -0,0 +1,92 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package jsonfeed
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	var f Feed
+	if err := json.Unmarshal([]byte(JSON_FEED), &f); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Valid() {
+		t.Error("bad version", f.Version)
+	}
+	if f.HomePageURL != "https://example.org/" {
+		t.Error("bad home page", f.HomePageURL)
+	}
+	if f.Hub() != "https://hub.example.org/" {
+		t.Error("bad hub", f.Hub())
+	}
+	if len(f.Items) != 2 {
+		t.Fatal("bad items", len(f.Items))
+	}
+	if a := f.Items[0].AllAuthors(); len(a) != 2 || a[1].Name != "Bob" {
+		t.Error("bad 1.1 authors", a)
+	}
+	if a := f.Items[1].AllAuthors(); len(a) != 1 || a[0].Name != "Carol" {
+		t.Error("bad 1.0 author", a)
+	}
+	if at := f.Items[1].Attachments; len(at) != 1 || at[0].MimeType != "audio/mpeg" || at[0].SizeInBytes != 1234 {
+		t.Error("bad attachment", at)
+	}
+}
+
+func TestVersion(t *testing.T) {
+	var f Feed
+	if err := json.Unmarshal([]byte(`{"title": "not a feed"}`), &f); err != nil {
+		t.Fatal(err)
+	}
+	if f.Valid() {
+		t.Error("expected invalid feed")
+	}
+}
+
+const JSON_FEED = `
+{
+	"version": "https://jsonfeed.org/version/1.1",
+	"title": "Example",
+	"home_page_url": "https://example.org/",
+	"feed_url": "https://example.org/feed.json",
+	"hubs": [
+		{"type": "rssCloud", "url": "https://cloud.example.org/"},
+		{"type": "WebSub", "url": "https://hub.example.org/"}
+	],
+	"items": [
+		{
+			"id": "2",
+			"url": "https://example.org/2",
+			"title": "Second",
+			"content_html": "<p>Hello</p>",
+			"date_published": "2020-05-02T10:00:00Z",
+			"authors": [{"name": "Alice"}, {"name": "Bob"}]
+		},
+		{
+			"id": "1",
+			"content_text": "Plain",
+			"date_published": "2020-05-01T10:00:00-07:00",
+			"author": {"name": "Carol"},
+			"attachments": [
+				{"url": "https://example.org/1.mp3", "mime_type": "audio/mpeg", "size_in_bytes": 1234}
+			]
+		}
+	]
+}
+`
@@ -0,0 +1,170 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package lang guesses the language of short texts and the direction they
+// are written in.
+package lang
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Normalize lower-cases a language tag and uses - as separator.
+func Normalize(tag string) string {
+	tag = strings.ToLower(strings.TrimSpace(tag))
+	return strings.Replace(tag, "_", "-", -1)
+}
+
+var rtl = map[string]bool{
+	"ar":  true,
+	"arc": true,
+	"ckb": true,
+	"dv":  true,
+	"fa":  true,
+	"he":  true,
+	"iw":  true,
+	"ji":  true,
+	"ku":  true,
+	"ps":  true,
+	"sd":  true,
+	"ug":  true,
+	"ur":  true,
+	"yi":  true,
+}
+
+// Dir returns "rtl" for languages written right-to-left, and "" otherwise.
+func Dir(tag string) string {
+	tag = Normalize(tag)
+	parts := strings.Split(tag, "-")
+	for _, p := range parts[1:] {
+		// script subtags override the language default
+		switch p {
+		case "arab", "hebr", "thaa", "syrc":
+			return "rtl"
+		case "latn", "cyrl":
+			return ""
+		}
+	}
+	if rtl[parts[0]] {
+		return "rtl"
+	}
+	return ""
+}
+
+var scripts = []struct {
+	table *unicode.RangeTable
+	lang  string
+}{
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+	{unicode.Thai, "th"},
+	{unicode.Devanagari, "hi"},
+	{unicode.Armenian, "hy"},
+	{unicode.Georgian, "ka"},
+}
+
+// Common words of Latin script languages, used to tell them apart.
+var stopwords = map[string][]string{
+	"en": {"the", "and", "of", "to", "is", "in", "that", "it", "for", "with", "was", "this"},
+	"es": {"el", "la", "de", "que", "y", "en", "los", "las", "por", "con", "una", "para"},
+	"fr": {"le", "la", "les", "de", "et", "des", "est", "une", "que", "pour", "dans", "pas"},
+	"de": {"der", "die", "und", "das", "ist", "nicht", "mit", "den", "ein", "zu", "auf", "sich"},
+	"pt": {"o", "de", "que", "e", "do", "da", "em", "um", "para", "com", "não", "uma"},
+	"it": {"il", "di", "che", "e", "la", "per", "un", "non", "sono", "del", "della", "con"},
+	"nl": {"de", "het", "een", "en", "van", "is", "dat", "niet", "op", "te", "zijn", "voor"},
+}
+
+var stopwordLangs = func() map[string][]string {
+	m := make(map[string][]string)
+	for l, words := range stopwords {
+		for _, w := range words {
+			m[w] = append(m[w], l)
+		}
+	}
+	return m
+}()
+
+// Minimum number of letters or words needed for a guess.
+const minLetters = 20
+
+// Detect guesses the language of text, returning "" if unsure. Non-Latin
+// scripts are detected by script alone; Latin script text by counting
+// common words.
+func Detect(text string) string {
+	counts := make(map[string]int)
+	letters, latin := 0, 0
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		if unicode.Is(unicode.Latin, r) {
+			latin++
+			continue
+		}
+		for _, s := range scripts {
+			if unicode.Is(s.table, r) {
+				counts[s.lang]++
+				break
+			}
+		}
+	}
+	if letters < minLetters {
+		return ""
+	}
+	// Japanese mixes Han with kana
+	if counts["ja"] > 0 && counts["ja"]+counts["zh"] > letters/2 {
+		return "ja"
+	}
+	if l, n := best(counts); n > letters/2 {
+		return l
+	}
+	if latin <= letters/2 {
+		return ""
+	}
+	words := make(map[string]int)
+	total := 0
+	for _, w := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r)
+	}) {
+		total++
+		for _, l := range stopwordLangs[w] {
+			words[l]++
+		}
+	}
+	if l, n := best(words); n >= 2 && n*10 >= total {
+		return l
+	}
+	return ""
+}
+
+func best(counts map[string]int) (string, int) {
+	var lang string
+	n := 0
+	for l, c := range counts {
+		if c > n || (c == n && l < lang) {
+			lang, n = l, c
+		}
+	}
+	return lang, n
+}
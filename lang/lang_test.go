@@ -0,0 +1,55 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package lang
+
+import "testing"
+
+func TestDetect(t *testing.T) {
+	for _, tc := range []struct {
+		text, lang string
+	}{
+		{"The quick brown fox jumps over the lazy dog, and that is the end of this story.", "en"},
+		{"El perro de la casa come con los niños en el parque para que la familia descanse.", "es"},
+		{"Le chat est dans la maison et les enfants ne sont pas contents de cette situation.", "fr"},
+		{"Der Hund ist nicht mit den Kindern auf der Straße, und das ist sehr gut so.", "de"},
+		{"هذا نص باللغة العربية لاختبار اكتشاف اللغة واتجاه الكتابة", "ar"},
+		{"זהו טקסט בעברית כדי לבדוק את זיהוי השפה ואת כיוון הכתיבה", "he"},
+		{"Это текст на русском языке для проверки определения языка", "ru"},
+		{"これは言語検出をテストするための日本語のテキストです。ひらがなとカタカナ", "ja"},
+		{"short", ""},
+	} {
+		if l := Detect(tc.text); l != tc.lang {
+			t.Errorf("%q: got %q, expected %q", tc.text, l, tc.lang)
+		}
+	}
+}
+
+func TestDir(t *testing.T) {
+	for tag, dir := range map[string]string{
+		"ar":      "rtl",
+		"he-IL":   "rtl",
+		"fa_IR":   "rtl",
+		"en-US":   "",
+		"az-Arab": "rtl",
+		"ku-Latn": "",
+		"":        "",
+	} {
+		if d := Dir(tag); d != dir {
+			t.Errorf("%q: got %q, expected %q", tag, d, dir)
+		}
+	}
+}
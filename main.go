@@ -27,10 +27,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/mjibson/goon"
-
-	"google.golang.org/appengine/datastore"
-	"google.golang.org/appengine/log"
+	"github.com/msde/goread/platform/log"
 )
 
 var router = new(mux.Router)
@@ -41,9 +38,11 @@ func init() {
 	if templates, err = template.New("").Funcs(funcs).
 		ParseFiles(
 			"templates/base.html",
+			"templates/add-subscription.html",
 			"templates/admin-all-feeds.html",
 			"templates/admin-date-formats.html",
 			"templates/admin-feed.html",
+			"templates/admin-hosts.html",
 			"templates/admin-stats.html",
 			"templates/admin-user.html",
 		); err != nil {
@@ -59,9 +58,13 @@ func RegisterHandlers(r *mux.Router) {
 	router.HandleFunc("/", Main).Name("main")
 	router.HandleFunc("/login/google", LoginGoogle).Name("login-google")
 	router.HandleFunc("/logout", Logout).Name("logout")
+	router.HandleFunc("/icon/{feed}", Icon).Name("icon")
 	router.HandleFunc("/push", SubscribeCallback).Name("subscribe-callback")
+	router.HandleFunc("/tasks/backfill-feed", BackfillFeed).Name("backfill-feed")
 	router.HandleFunc("/tasks/datastore-cleanup", DatastoreCleanup).Name("datastore-cleanup")
 	router.HandleFunc("/tasks/import-opml", ImportOpmlTask).Name("import-opml-task")
+	router.HandleFunc("/tasks/migrate-feed", MigrateFeed).Name("migrate-feed")
+	router.HandleFunc("/tasks/migrate-read", MigrateRead).Name("migrate-read")
 	router.HandleFunc("/tasks/subscribe-feed", SubscribeFeed).Name("subscribe-feed")
 	router.HandleFunc("/tasks/update-feed-last", UpdateFeedLast).Name("update-feed-last")
 	router.HandleFunc("/tasks/update-feed-manual", UpdateFeed).Name("update-feed-manual")
@@ -73,15 +76,22 @@ func RegisterHandlers(r *mux.Router) {
 	router.HandleFunc("/user/delete-account", DeleteAccount).Name("delete-account")
 	router.HandleFunc("/user/export-opml", ExportOpml).Name("export-opml")
 	router.HandleFunc("/user/feed-history", FeedHistory).Name("feed-history")
+	router.HandleFunc("/user/get-author", GetAuthor).Name("get-author")
+	router.HandleFunc("/user/get-comments", GetComments).Name("get-comments")
 	router.HandleFunc("/user/get-contents", GetContents).Name("get-contents")
 	router.HandleFunc("/user/get-feed", GetFeed).Name("get-feed")
+	router.HandleFunc("/user/get-playback", GetPlayback).Name("get-playback")
 	router.HandleFunc("/user/get-stars", GetStars).Name("get-stars")
 	router.HandleFunc("/user/import/opml", ImportOpml).Name("import-opml")
 	router.HandleFunc("/user/list-feeds", ListFeeds).Name("list-feeds")
+	router.HandleFunc("/user/mark-all-read", MarkAllRead).Name("mark-all-read")
 	router.HandleFunc("/user/mark-read", MarkRead).Name("mark-read")
 	router.HandleFunc("/user/mark-unread", MarkUnread).Name("mark-unread")
 	router.HandleFunc("/user/save-options", SaveOptions).Name("save-options")
+	router.HandleFunc("/user/set-playback", SetPlayback).Name("set-playback")
 	router.HandleFunc("/user/set-star", SetStar).Name("set-star")
+	router.HandleFunc("/user/undo-mark-all-read", UndoMarkAllRead).Name("undo-mark-all-read")
+	router.HandleFunc("/user/unread-counts", UnreadCounts).Name("unread-counts")
 	router.HandleFunc("/user/upload-opml", UploadOpml).Name("upload-opml")
 	router.HandleFunc("/user/upload-url", UploadUrl).Name("upload-url")
 
@@ -92,6 +102,7 @@ func RegisterHandlers(r *mux.Router) {
 	router.HandleFunc("/admin/feed", AdminFeed).Name("admin-feed")
 	router.HandleFunc("/admin/subhub", AdminSubHub).Name("admin-subhub-feed")
 	router.HandleFunc("/admin/stats", AdminStats).Name("admin-stats")
+	router.HandleFunc("/admin/hosts", AdminHosts).Name("admin-hosts")
 	router.HandleFunc("/admin/update-feed", AdminUpdateFeed).Name("admin-update-feed")
 	router.HandleFunc("/user/charge", Charge).Name("charge")
 	router.HandleFunc("/user/account", Account).Name("account")
@@ -127,7 +138,12 @@ func Main(w http.ResponseWriter, r *http.Request) {
 }
 
 func addFeed(c context.Context, userid string, outline *OpmlOutline) error {
-	gn := goon.FromContext(c)
+	return addFetchedFeed(c, userid, outline, nil, nil)
+}
+
+// addFetchedFeed is addFeed with the feed, if not nil, already fetched from
+// the outline's URL.
+func addFetchedFeed(c context.Context, userid string, outline *OpmlOutline, fetched *Feed, fetchedStories []*Story) error {
 	o := outline.Outline[0]
 	log.Infof(c, "adding feed %v to user %s", o.XmlUrl, userid)
 	fu, ferr := url.Parse(o.XmlUrl)
@@ -137,29 +153,40 @@ func addFeed(c context.Context, userid string, outline *OpmlOutline) error {
 	fu.Fragment = ""
 	o.XmlUrl = fu.String()
 
-	f := Feed{Url: o.XmlUrl}
-	if err := gn.Get(&f); err == datastore.ErrNoSuchEntity {
-		if feed, stories, err := fetchFeed(c, o.XmlUrl, o.XmlUrl); err != nil {
-			return fmt.Errorf("could not add feed %s: %v", o.XmlUrl, err)
-		} else {
-			f = *feed
-			f.Updated = time.Time{}
-			f.Checked = f.Updated
-			f.NextUpdate = f.Updated
-			f.LastViewed = time.Now()
-			gn.Put(&f)
-			for _, s := range stories {
-				s.Created = s.Published
-			}
-			if err := updateFeed(c, f.Url, feed, stories, false, false, false); err != nil {
-				return err
+	f, err := Store.GetFeed(c, o.XmlUrl)
+	if err == nil && f.Migrated && f.MovedTo != "" {
+		log.Infof(c, "feed %v migrated to %v", f.Url, f.MovedTo)
+		o.XmlUrl = f.MovedTo
+		f, err = Store.GetFeed(c, o.XmlUrl)
+	}
+	if err == ErrNotFound {
+		feed, stories := fetched, fetchedStories
+		if feed == nil || feed.Url != o.XmlUrl {
+			if feed, stories, err = fetchFeed(c, o.XmlUrl, o.XmlUrl, nil); err != nil {
+				return fmt.Errorf("could not add feed %s: %v", o.XmlUrl, err)
 			}
+		}
+		nf := *feed
+		f = &nf
+		f.Updated = time.Time{}
+		f.Checked = f.Updated
+		f.NextUpdate = f.Updated
+		f.LastViewed = time.Now()
+		Store.PutFeed(c, f)
+		for _, s := range stories {
+			s.Created = s.Published
+		}
+		if err := updateFeed(c, f.Url, feed, stories, false, false, false); err != nil {
+			return err
+		}
+		if feed.ArchiveLink != "" {
+			queueBackfill(c, f.Url, feed.ArchiveLink, 0, 0, 0)
+		}
 
-			o.XmlUrl = feed.Url
-			o.HtmlUrl = feed.Link
-			if o.Title == "" {
-				o.Title = feed.Title
-			}
+		o.XmlUrl = feed.Url
+		o.HtmlUrl = feed.Link
+		if o.Title == "" {
+			o.Title = feed.Title
 		}
 	} else if err != nil {
 		return err
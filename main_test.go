@@ -0,0 +1,247 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/msde/goread/platform"
+	"github.com/msde/goread/platform/taskqueue"
+	"github.com/msde/goread/platform/user"
+)
+
+// testRouter routes requests to goread's handlers, as in the standalone
+// server.
+var testRouter = mux.NewRouter()
+
+// TestMain serves goread as the standalone server does. Tests set Store
+// with forEachStore.
+func TestMain(m *testing.M) {
+	platform.Standalone = true
+	RegisterHandlers(testRouter)
+	os.Exit(m.Run())
+}
+
+// testStores are the Storage implementations handlers are tested with.
+var testStores = []struct {
+	name string
+	new  func(t *testing.T) Storage
+}{
+	{"memory", func(*testing.T) Storage { return NewMemoryStorage() }},
+	{"sqlite3", func(t *testing.T) Storage { return newSQLiteStorage(t) }},
+}
+
+// forEachStore runs f as a subtest with an empty Store of each of
+// testStores, and with tasks recorded instead of run.
+func forEachStore(t *testing.T, f func(t *testing.T, tasks *taskRecorder)) {
+	for _, ts := range testStores {
+		t.Run(ts.name, func(t *testing.T) {
+			tasks := &taskRecorder{}
+			Store, taskqueue.Default = ts.new(t), tasks
+			defer func() {
+				Store, taskqueue.Default = datastoreStorage{}, nil
+			}()
+			f(t, tasks)
+		})
+	}
+}
+
+// taskRecorder is a taskqueue.Service that keeps the tasks it is given.
+type taskRecorder struct {
+	sync.Mutex
+	tasks []*taskqueue.Task
+}
+
+func (q *taskRecorder) Add(c context.Context, t *taskqueue.Task, queueName string) (*taskqueue.Task, error) {
+	q.Lock()
+	defer q.Unlock()
+	q.tasks = append(q.tasks, t)
+	return t, nil
+}
+
+func (q *taskRecorder) AddMulti(c context.Context, tasks []*taskqueue.Task, queueName string) ([]*taskqueue.Task, error) {
+	for _, t := range tasks {
+		q.Add(c, t, queueName)
+	}
+	return tasks, nil
+}
+
+// count returns the number of recorded tasks to path.
+func (q *taskRecorder) count(path string) int {
+	q.Lock()
+	defer q.Unlock()
+	n := 0
+	for _, t := range q.tasks {
+		if t.Path == path {
+			n++
+		}
+	}
+	return n
+}
+
+const testUser = "me@example.com"
+
+// userContext returns a context whose signed in user is uid.
+func userContext(uid string) context.Context {
+	return user.NewContext(context.Background(), &user.User{Email: uid, ID: uid})
+}
+
+// serve calls h with a request from the user uid, whose form is posted if
+// form isn't nil. It fails t unless h answers with an OK status.
+func serve(t *testing.T, h http.HandlerFunc, uid, target string, form url.Values) *httptest.ResponseRecorder {
+	t.Helper()
+	w := serveStatus(h, uid, target, form)
+	if w.Code >= 400 {
+		t.Fatalf("%v: %v %v", target, w.Code, w.Body)
+	}
+	return w
+}
+
+func serveStatus(h http.HandlerFunc, uid, target string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	if form != nil {
+		r = httptest.NewRequest("POST", target, strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+	if uid != "" {
+		r = r.WithContext(userContext(uid))
+	}
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// serveJSON posts v as JSON to h.
+func serveJSON(t *testing.T, h http.HandlerFunc, uid, target string, v interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	b, _ := json.Marshal(v)
+	r := httptest.NewRequest("POST", target, strings.NewReader(string(b))).WithContext(userContext(uid))
+	w := httptest.NewRecorder()
+	h(w, r)
+	if w.Code >= 400 {
+		t.Fatalf("%v: %v %v", target, w.Code, w.Body)
+	}
+	return w
+}
+
+// decode decodes the JSON response of w into v.
+func decode(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("%v: %s", err, w.Body)
+	}
+}
+
+// testPNG is a red 16x16 icon.
+var testPNG = func() []byte {
+	m := image.NewRGBA(image.Rect(0, 0, 16, 16))
+	for i := 0; i < len(m.Pix); i += 4 {
+		copy(m.Pix[i:], []byte{0xff, 0, 0, 0xff})
+	}
+	var b bytes.Buffer
+	png.Encode(&b, m)
+	return b.Bytes()
+}()
+
+// testItem is a feed item. A zero date is served as one that doesn't parse.
+type testItem struct {
+	id   string
+	date time.Time
+}
+
+const testBadDate = "the day after tomorrow"
+
+// feedServer serves an RSS feed of its items at /feed, and a page linking
+// an icon at /. It counts requests by path.
+type feedServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	items []testItem
+	hits  map[string]int
+	// status, if set, is the answer to everything but the feed.
+	status int
+}
+
+func newFeedServer(items ...testItem) *feedServer {
+	s := &feedServer{items: items, hits: make(map[string]int)}
+	s.Server = httptest.NewServer(s)
+	return s
+}
+
+func (s *feedServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.hits[r.URL.Path]++
+	if s.status != 0 && r.URL.Path != "/feed" {
+		w.WriteHeader(s.status)
+		return
+	}
+	switch r.URL.Path {
+	case "/feed":
+		w.Header().Set("Content-Type", "application/rss+xml")
+		fmt.Fprintf(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Test</title><link>%s/</link>`, s.URL)
+		for _, it := range s.items {
+			date := testBadDate
+			if !it.date.IsZero() {
+				date = it.date.UTC().Format(time.RFC1123Z)
+			}
+			fmt.Fprintf(w, `<item><title>%[1]s</title><link>%[2]s/%[1]s</link><guid>%[1]s</guid><pubDate>%[3]s</pubDate><description>story %[1]s</description></item>`,
+				it.id, s.URL, date)
+		}
+		fmt.Fprint(w, `</channel></rss>`)
+	case "/":
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, `<html><head><link rel="icon" href="/icon.png"></head></html>`)
+	case "/icon.png":
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(testPNG)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// add adds items to the feed.
+func (s *feedServer) add(items ...testItem) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.items = append(s.items, items...)
+}
+
+// count returns the number of requests for path.
+func (s *feedServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+func (s *feedServer) feedUrl() string {
+	return s.URL + "/feed"
+}
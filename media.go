@@ -0,0 +1,131 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/msde/goread/atom"
+	"github.com/msde/goread/rss"
+)
+
+// mediaImage is a Media RSS thumbnail or image content candidate.
+type mediaImage struct {
+	url           string
+	width, height int
+}
+
+func newMediaImage(url, width, height string) mediaImage {
+	w, _ := strconv.Atoi(strings.TrimSpace(width))
+	h, _ := strconv.Atoi(strings.TrimSpace(height))
+	return mediaImage{strings.TrimSpace(url), w, h}
+}
+
+func isImage(typ, medium string) bool {
+	return medium == "image" || strings.HasPrefix(typ, "image/")
+}
+
+// bestImage returns the URL of the largest image, preferring earlier
+// ones when sizes are unknown or equal.
+func bestImage(images []mediaImage) string {
+	best := -1
+	var u string
+	for _, m := range images {
+		if m.url == "" {
+			continue
+		}
+		if a := m.width * m.height; a > best {
+			best = a
+			u = m.url
+		}
+	}
+	return u
+}
+
+// rssThumbnail picks a thumbnail from an item's media:thumbnail elements,
+// falling back to image media:content, including those in media:group.
+func rssThumbnail(i *rss.Item) string {
+	var thumbs, images []mediaImage
+	addContent := func(mc []*rss.MediaContent) {
+		for _, m := range mc {
+			if m != nil && isImage(m.Type, m.Medium) {
+				images = append(images, newMediaImage(m.URL, m.Width, m.Height))
+			}
+		}
+	}
+	addThumbs := func(mt []*rss.MediaThumbnail) {
+		for _, m := range mt {
+			if m != nil {
+				thumbs = append(thumbs, newMediaImage(m.URL, m.Width, m.Height))
+			}
+		}
+	}
+	addThumbs(i.MediaThumbnails)
+	addContent(i.Media)
+	for _, g := range i.MediaGroups {
+		if g != nil {
+			addThumbs(g.Thumbnails)
+			addContent(g.Contents)
+		}
+	}
+	if t := bestImage(thumbs); t != "" {
+		return t
+	}
+	return bestImage(images)
+}
+
+// atomThumbnail is rssThumbnail for Atom entries.
+func atomThumbnail(e *atom.Entry) string {
+	var thumbs, images []mediaImage
+	addContent := func(mc []*atom.Content) {
+		for _, m := range mc {
+			if m != nil && isImage(m.Type, m.Medium) {
+				images = append(images, newMediaImage(m.URL, m.Width, m.Height))
+			}
+		}
+	}
+	addThumbs := func(mt []*atom.MediaThumbnail) {
+		for _, m := range mt {
+			if m != nil {
+				thumbs = append(thumbs, newMediaImage(m.URL, m.Width, m.Height))
+			}
+		}
+	}
+	addThumbs(e.MediaThumbnails)
+	addContent(e.MediaContents())
+	for _, g := range e.MediaGroups {
+		if g != nil {
+			addThumbs(g.Thumbnails)
+			addContent(g.Contents)
+		}
+	}
+	if t := bestImage(thumbs); t != "" {
+		return t
+	}
+	return bestImage(images)
+}
+
+// enclosureImage returns the first image enclosure of st.
+func enclosureImage(st *Story) string {
+	for _, e := range st.Enclosures {
+		if isImage(e.Type, "") {
+			return e.Url
+		}
+	}
+	return ""
+}
@@ -0,0 +1,641 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// memStorage keeps entities in memory. It is meant for tests and
+// development, and loses everything when the process exits.
+type memStorage struct {
+	tx sync.Mutex
+	mu sync.Mutex
+
+	feeds    map[string]*Feed
+	stories  map[readStory]*Story
+	contents map[readStory]string
+	users    map[string]*User
+	data     map[string]*UserData
+	opmls    map[memKey]*UserOpml
+	stars    map[memKey]*UserStar
+	reads    map[memKey]*UserRead
+	playback map[memKey]*UserPlayback
+	charges  map[string]*UserCharge
+	dates    map[string]*DateFailure
+	images   map[string]*Image
+}
+
+// memKey identifies an entity belonging to a user.
+type memKey struct {
+	User, Feed, Story string
+	Id                int64
+}
+
+type memTxKey struct{}
+
+// NewMemoryStorage returns an empty Storage that lives in memory.
+func NewMemoryStorage() Storage {
+	return &memStorage{
+		feeds:    make(map[string]*Feed),
+		stories:  make(map[readStory]*Story),
+		contents: make(map[readStory]string),
+		users:    make(map[string]*User),
+		data:     make(map[string]*UserData),
+		opmls:    make(map[memKey]*UserOpml),
+		stars:    make(map[memKey]*UserStar),
+		reads:    make(map[memKey]*UserRead),
+		playback: make(map[memKey]*UserPlayback),
+		charges:  make(map[string]*UserCharge),
+		dates:    make(map[string]*DateFailure),
+		images:   make(map[string]*Image),
+	}
+}
+
+// RunInTransaction runs transactions one at a time. If f fails, the user
+// entities are restored to what they were before.
+func (m *memStorage) RunInTransaction(c context.Context, f func(c context.Context) error) error {
+	if c.Value(memTxKey{}) != nil {
+		return f(c)
+	}
+	m.tx.Lock()
+	defer m.tx.Unlock()
+	m.mu.Lock()
+	users, data, charges := m.users, m.data, m.charges
+	opmls, stars, reads, playback := m.opmls, m.stars, m.reads, m.playback
+	m.users = make(map[string]*User, len(users))
+	for k, v := range users {
+		m.users[k] = v
+	}
+	m.data = make(map[string]*UserData, len(data))
+	for k, v := range data {
+		m.data[k] = v
+	}
+	m.charges = make(map[string]*UserCharge, len(charges))
+	for k, v := range charges {
+		m.charges[k] = v
+	}
+	m.opmls = make(map[memKey]*UserOpml, len(opmls))
+	for k, v := range opmls {
+		m.opmls[k] = v
+	}
+	m.stars = make(map[memKey]*UserStar, len(stars))
+	for k, v := range stars {
+		m.stars[k] = v
+	}
+	m.reads = make(map[memKey]*UserRead, len(reads))
+	for k, v := range reads {
+		m.reads[k] = v
+	}
+	m.playback = make(map[memKey]*UserPlayback, len(playback))
+	for k, v := range playback {
+		m.playback[k] = v
+	}
+	m.mu.Unlock()
+	err := f(context.WithValue(c, memTxKey{}, true))
+	if err != nil {
+		m.mu.Lock()
+		m.users, m.data, m.charges = users, data, charges
+		m.opmls, m.stars, m.reads, m.playback = opmls, stars, reads, playback
+		m.mu.Unlock()
+	}
+	return err
+}
+
+// lockUser locks m for user entities. Outside a transaction, it waits for
+// running transactions so a rollback can't lose other changes.
+func (m *memStorage) lockUser(c context.Context) func() {
+	inTx := c.Value(memTxKey{}) != nil
+	if !inTx {
+		m.tx.Lock()
+	}
+	m.mu.Lock()
+	return func() {
+		m.mu.Unlock()
+		if !inTx {
+			m.tx.Unlock()
+		}
+	}
+}
+
+// bounds returns the bounds of p within n results, and the cursor of the
+// following page.
+func (p Page) bounds(n int) (int, int, string) {
+	start, _ := strconv.Atoi(p.Cursor)
+	if start < 0 || start > n {
+		start = n
+	}
+	end := n
+	if p.Limit > 0 && start+p.Limit < n {
+		end = start + p.Limit
+	}
+	return start, end, strconv.Itoa(end)
+}
+
+func (m *memStorage) GetFeed(c context.Context, url string) (*Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if f, ok := m.feeds[url]; ok {
+		nf := *f
+		return &nf, nil
+	}
+	return &Feed{Url: url}, ErrNotFound
+}
+
+func (m *memStorage) GetFeeds(c context.Context, urls []string) ([]*Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fs := make([]*Feed, len(urls))
+	for i, u := range urls {
+		if f, ok := m.feeds[u]; ok {
+			nf := *f
+			fs[i] = &nf
+		}
+	}
+	return fs, nil
+}
+
+func (m *memStorage) PutFeed(c context.Context, f *Feed) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nf := *f
+	m.feeds[f.Url] = &nf
+	return nil
+}
+
+func (m *memStorage) DueFeeds(c context.Context, t time.Time, limit int) ([]*Feed, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var fs []*Feed
+	for _, f := range m.feeds {
+		if !f.NextUpdate.After(t) {
+			nf := *f
+			fs = append(fs, &nf)
+		}
+	}
+	sort.Slice(fs, func(i, j int) bool { return fs[i].NextUpdate.Before(fs[j].NextUpdate) })
+	if limit > 0 && len(fs) > limit {
+		fs = fs[:limit]
+	}
+	return fs, nil
+}
+
+func (m *memStorage) FeedUrls(c context.Context, next time.Time, p Page) ([]string, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var urls []string
+	for u, f := range m.feeds {
+		if next.IsZero() || f.NextUpdate.Equal(next) {
+			urls = append(urls, u)
+		}
+	}
+	sort.Strings(urls)
+	start, end, cur := p.bounds(len(urls))
+	return urls[start:end], cur, nil
+}
+
+func (m *memStorage) GetStories(c context.Context, ids []readStory) ([]*Story, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ss := make([]*Story, len(ids))
+	for i, id := range ids {
+		if s, ok := m.stories[id]; ok {
+			ns := *s
+			ss[i] = &ns
+		}
+	}
+	return ss, nil
+}
+
+func (m *memStorage) PutStories(c context.Context, stories []*Story, content bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, s := range stories {
+		id := readStory{Feed: s.Feed, Story: s.Id}
+		ns := *s
+		ns.content = ""
+		m.stories[id] = &ns
+		if content {
+			m.contents[id] = s.content
+		}
+	}
+	return nil
+}
+
+func (m *memStorage) FeedStories(c context.Context, feed string, q StoryQuery) ([]*Story, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ck := categoryKey(q.Category)
+	var ss []*Story
+	for id, s := range m.stories {
+		if id.Feed != feed || s.Created.Before(q.Since) {
+			continue
+		}
+		if q.Category != "" {
+			found := false
+			for _, k := range s.CategoryKeys {
+				found = found || k == ck
+			}
+			if !found {
+				continue
+			}
+		}
+		ns := *s
+		ss = append(ss, &ns)
+	}
+	sort.Sort(sort.Reverse(Stories(ss)))
+	start, end, cur := q.bounds(len(ss))
+	return ss[start:end], cur, nil
+}
+
+func (m *memStorage) StoryContents(c context.Context, ids []readStory) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	ret := make([]string, len(ids))
+	for i, id := range ids {
+		ret[i] = m.contents[id]
+	}
+	return ret, nil
+}
+
+func (m *memStorage) DeleteStories(c context.Context, feed string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id := range m.stories {
+		if id.Feed == feed {
+			delete(m.stories, id)
+			delete(m.contents, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memStorage) AuthorStories(c context.Context, author string, p Page) ([]readStory, []string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var ss []*Story
+	for _, s := range m.stories {
+		for _, k := range s.AuthorKeys {
+			if k == author {
+				ss = append(ss, s)
+				break
+			}
+		}
+	}
+	sort.Sort(sort.Reverse(Stories(ss)))
+	start, end, _ := p.bounds(len(ss))
+	ids := make([]readStory, 0, end-start)
+	curs := make([]string, 0, end-start)
+	for i, s := range ss[start:end] {
+		ids = append(ids, readStory{Feed: s.Feed, Story: s.Id})
+		curs = append(curs, strconv.Itoa(start+i+1))
+	}
+	return ids, curs, nil
+}
+
+func (m *memStorage) CountStories(c context.Context, feed string, since time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n := 0
+	for id, s := range m.stories {
+		if id.Feed == feed && !s.Created.Before(since) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (m *memStorage) GetUser(c context.Context, id string) (*User, error) {
+	defer m.lockUser(c)()
+	if u, ok := m.users[id]; ok {
+		nu := *u
+		return &nu, nil
+	}
+	return &User{Id: id}, ErrNotFound
+}
+
+func (m *memStorage) FindUser(c context.Context, email string) (*User, error) {
+	defer m.lockUser(c)()
+	for _, u := range m.users {
+		if u.Email == email {
+			nu := *u
+			return &nu, nil
+		}
+	}
+	return &User{}, ErrNotFound
+}
+
+func (m *memStorage) PutUser(c context.Context, u *User) error {
+	defer m.lockUser(c)()
+	nu := *u
+	m.users[u.Id] = &nu
+	return nil
+}
+
+func (m *memStorage) UserIds(c context.Context, p Page) ([]string, string, error) {
+	defer m.lockUser(c)()
+	var ids []string
+	for id := range m.users {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	start, end, cur := p.bounds(len(ids))
+	return ids[start:end], cur, nil
+}
+
+func (m *memStorage) CountUsers(c context.Context) (int, error) {
+	defer m.lockUser(c)()
+	return len(m.users), nil
+}
+
+func (m *memStorage) DeleteUser(c context.Context, id string) error {
+	defer m.lockUser(c)()
+	delete(m.users, id)
+	delete(m.data, id)
+	delete(m.charges, id)
+	for k := range m.opmls {
+		if k.User == id {
+			delete(m.opmls, k)
+		}
+	}
+	for k := range m.stars {
+		if k.User == id {
+			delete(m.stars, k)
+		}
+	}
+	for k := range m.reads {
+		if k.User == id {
+			delete(m.reads, k)
+		}
+	}
+	for k := range m.playback {
+		if k.User == id {
+			delete(m.playback, k)
+		}
+	}
+	return nil
+}
+
+func (m *memStorage) GetUserData(c context.Context, uid string) (*UserData, error) {
+	defer m.lockUser(c)()
+	if ud, ok := m.data[uid]; ok {
+		nud := *ud
+		return &nud, nil
+	}
+	return &UserData{Id: "data"}, ErrNotFound
+}
+
+func (m *memStorage) PutUserData(c context.Context, uid string, ud *UserData) error {
+	defer m.lockUser(c)()
+	ud.Id = "data"
+	nud := *ud
+	m.data[uid] = &nud
+	return nil
+}
+
+func (m *memStorage) GetUserOpml(c context.Context, uid string, id int64) (*UserOpml, error) {
+	defer m.lockUser(c)()
+	if uo, ok := m.opmls[memKey{User: uid, Id: id}]; ok {
+		nuo := *uo
+		return &nuo, nil
+	}
+	return &UserOpml{Id: id}, ErrNotFound
+}
+
+func (m *memStorage) PutUserOpml(c context.Context, uid string, uo *UserOpml) error {
+	defer m.lockUser(c)()
+	nuo := *uo
+	m.opmls[memKey{User: uid, Id: uo.Id}] = &nuo
+	return nil
+}
+
+func (m *memStorage) UserOpmls(c context.Context, uid string) ([]int64, error) {
+	defer m.lockUser(c)()
+	var ids []int64
+	for k := range m.opmls {
+		if k.User == uid {
+			ids = append(ids, k.Id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids, nil
+}
+
+func (m *memStorage) PutStar(c context.Context, uid string, us *UserStar) error {
+	defer m.lockUser(c)()
+	us.Id = us.Story
+	nus := *us
+	m.stars[memKey{User: uid, Feed: us.Feed, Story: us.Story}] = &nus
+	return nil
+}
+
+func (m *memStorage) DeleteStar(c context.Context, uid, feed, story string) error {
+	defer m.lockUser(c)()
+	delete(m.stars, memKey{User: uid, Feed: feed, Story: story})
+	return nil
+}
+
+func (m *memStorage) Stars(c context.Context, uid string, q StarQuery) ([]*UserStar, string, error) {
+	defer m.lockUser(c)()
+	var stars []*UserStar
+	for k, us := range m.stars {
+		if k.User != uid || (q.Feed != "" && k.Feed != q.Feed) || us.Created.Before(q.Since) {
+			continue
+		}
+		nus := *us
+		stars = append(stars, &nus)
+	}
+	sort.Slice(stars, func(i, j int) bool { return stars[i].Created.After(stars[j].Created) })
+	start, end, cur := q.bounds(len(stars))
+	return stars[start:end], cur, nil
+}
+
+func (m *memStorage) PutReads(c context.Context, uid string, reads []*UserRead) error {
+	defer m.lockUser(c)()
+	for _, r := range reads {
+		r.Id = r.Story
+		nr := *r
+		m.reads[memKey{User: uid, Feed: r.Feed, Story: r.Story}] = &nr
+	}
+	return nil
+}
+
+func (m *memStorage) DeleteReads(c context.Context, uid string, ids []readStory) error {
+	defer m.lockUser(c)()
+	for _, id := range ids {
+		delete(m.reads, memKey{User: uid, Feed: id.Feed, Story: id.Story})
+	}
+	return nil
+}
+
+func (m *memStorage) FeedReads(c context.Context, uid, feed string, since time.Time) ([]*UserRead, error) {
+	defer m.lockUser(c)()
+	var reads []*UserRead
+	for k, r := range m.reads {
+		if k.User == uid && k.Feed == feed && !r.Created.Before(since) {
+			nr := *r
+			reads = append(reads, &nr)
+		}
+	}
+	return reads, nil
+}
+
+func (m *memStorage) DeleteReadsBefore(c context.Context, uid string, t time.Time) error {
+	defer m.lockUser(c)()
+	for k, r := range m.reads {
+		if k.User == uid && (t.IsZero() || r.Created.Before(t)) {
+			delete(m.reads, k)
+		}
+	}
+	return nil
+}
+
+func (m *memStorage) GetPlayback(c context.Context, uid, feed, story string) (*UserPlayback, error) {
+	defer m.lockUser(c)()
+	if p, ok := m.playback[memKey{User: uid, Feed: feed, Story: story}]; ok {
+		np := *p
+		return &np, nil
+	}
+	return &UserPlayback{Id: story, Feed: feed, Story: story}, ErrNotFound
+}
+
+func (m *memStorage) PutPlayback(c context.Context, uid string, p *UserPlayback) error {
+	defer m.lockUser(c)()
+	p.Id = p.Story
+	np := *p
+	m.playback[memKey{User: uid, Feed: p.Feed, Story: p.Story}] = &np
+	return nil
+}
+
+func (m *memStorage) Playbacks(c context.Context, uid string, since time.Time, limit int) ([]*UserPlayback, error) {
+	defer m.lockUser(c)()
+	var playback []*UserPlayback
+	for k, p := range m.playback {
+		if k.User == uid && !p.Updated.Before(since) {
+			np := *p
+			playback = append(playback, &np)
+		}
+	}
+	sort.Slice(playback, func(i, j int) bool { return playback[i].Updated.After(playback[j].Updated) })
+	if limit > 0 && len(playback) > limit {
+		playback = playback[:limit]
+	}
+	return playback, nil
+}
+
+func (m *memStorage) FeedPlaybacks(c context.Context, uid, feed string) ([]*UserPlayback, error) {
+	defer m.lockUser(c)()
+	var playback []*UserPlayback
+	for k, p := range m.playback {
+		if k.User == uid && k.Feed == feed {
+			np := *p
+			playback = append(playback, &np)
+		}
+	}
+	return playback, nil
+}
+
+func (m *memStorage) DeletePlayback(c context.Context, uid, feed, story string) error {
+	defer m.lockUser(c)()
+	delete(m.playback, memKey{User: uid, Feed: feed, Story: story})
+	return nil
+}
+
+func (m *memStorage) GetCharge(c context.Context, uid string) (*UserCharge, error) {
+	defer m.lockUser(c)()
+	if uc, ok := m.charges[uid]; ok {
+		nuc := *uc
+		return &nuc, nil
+	}
+	return &UserCharge{Id: 1}, ErrNotFound
+}
+
+func (m *memStorage) PutCharge(c context.Context, uid string, uc *UserCharge) error {
+	defer m.lockUser(c)()
+	uc.Id = 1
+	nuc := *uc
+	m.charges[uid] = &nuc
+	return nil
+}
+
+func (m *memStorage) DeleteCharge(c context.Context, uid string) error {
+	defer m.lockUser(c)()
+	delete(m.charges, uid)
+	return nil
+}
+
+func (m *memStorage) GetDateFailures(c context.Context, ids []string) ([]*DateFailure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dfs := make([]*DateFailure, len(ids))
+	for i, id := range ids {
+		if df, ok := m.dates[id]; ok {
+			ndf := *df
+			dfs[i] = &ndf
+		}
+	}
+	return dfs, nil
+}
+
+func (m *memStorage) PutDateFailures(c context.Context, dfs []*DateFailure) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, df := range dfs {
+		ndf := *df
+		m.dates[df.Id] = &ndf
+	}
+	return nil
+}
+
+func (m *memStorage) DateFailures(c context.Context, limit int) ([]*DateFailure, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var dfs []*DateFailure
+	for _, df := range m.dates {
+		ndf := *df
+		dfs = append(dfs, &ndf)
+	}
+	sort.Slice(dfs, func(i, j int) bool { return dfs[i].Last.After(dfs[j].Last) })
+	if limit > 0 && len(dfs) > limit {
+		dfs = dfs[:limit]
+	}
+	return dfs, nil
+}
+
+func (m *memStorage) GetImage(c context.Context, id string) (*Image, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if img, ok := m.images[id]; ok {
+		nimg := *img
+		return &nimg, nil
+	}
+	return &Image{Id: id}, ErrNotFound
+}
+
+func (m *memStorage) PutImage(c context.Context, img *Image) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	nimg := *img
+	m.images[img.Id] = &nimg
+	return nil
+}
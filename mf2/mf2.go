@@ -0,0 +1,452 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package mf2 parses microformats2 items from HTML:
+// http://microformats.org/wiki/microformats2-parsing
+package mf2
+
+import (
+	"bytes"
+	"io"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Data is the result of parsing a document.
+type Data struct {
+	Items []*Item
+
+	// Title is the document's <title>, used when an h-feed has no name.
+	Title string
+}
+
+// Item is a microformat such as an h-entry. Property values are strings,
+// *Item for nested microformats, or Embedded for e-* properties.
+type Item struct {
+	Type       []string
+	Properties map[string][]interface{}
+	Children   []*Item
+
+	// Value is the item's plain value when it is itself a property.
+	Value string
+
+	// set if the item has p-* or e-* properties, or nested items
+	explicit bool
+}
+
+// Embedded is the value of an e-* property.
+type Embedded struct {
+	Html  string
+	Value string
+}
+
+type parser struct {
+	base *url.URL
+}
+
+// Parse parses the microformats in an HTML document. Relative URLs are
+// resolved against base, or the document's <base> element.
+func Parse(r io.Reader, base *url.URL) (*Data, error) {
+	doc, err := html.Parse(r)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{base: base}
+	d := &Data{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.DataAtom {
+			case atom.Base:
+				if u, err := p.base.Parse(attr(n, "href")); err == nil && attr(n, "href") != "" {
+					p.base = u
+				}
+			case atom.Title:
+				if d.Title == "" {
+					d.Title = text(n)
+				}
+			case atom.Body:
+				return
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	d.Items = p.roots(doc)
+	return d, nil
+}
+
+// Feed returns the first h-feed, or one made of the top level h-entry
+// items if there is none. It returns nil if there are no entries.
+func (d *Data) Feed() *Item {
+	var find func([]*Item) *Item
+	find = func(items []*Item) *Item {
+		for _, i := range items {
+			if i.Is("h-feed") {
+				return i
+			}
+			if f := find(i.Children); f != nil {
+				return f
+			}
+		}
+		return nil
+	}
+	if f := find(d.Items); f != nil {
+		return f
+	}
+	f := &Item{Type: []string{"h-feed"}, Properties: make(map[string][]interface{})}
+	for _, i := range d.Items {
+		if i.Is("h-entry") {
+			f.Children = append(f.Children, i)
+		}
+	}
+	if len(f.Children) == 0 {
+		return nil
+	}
+	return f
+}
+
+// Is reports whether i is of type typ, such as h-entry.
+func (i *Item) Is(typ string) bool {
+	for _, t := range i.Type {
+		if t == typ {
+			return true
+		}
+	}
+	return false
+}
+
+// Strings returns the plain values of a property.
+func (i *Item) Strings(prop string) []string {
+	var s []string
+	for _, v := range i.Properties[prop] {
+		switch v := v.(type) {
+		case string:
+			s = append(s, v)
+		case *Item:
+			s = append(s, v.Value)
+		case Embedded:
+			s = append(s, v.Value)
+		}
+	}
+	return s
+}
+
+// String returns the first plain value of a property, or "".
+func (i *Item) String(prop string) string {
+	if s := i.Strings(prop); len(s) > 0 {
+		return s[0]
+	}
+	return ""
+}
+
+// Html returns the first value of a property as HTML.
+func (i *Item) Html(prop string) string {
+	if vs := i.Properties[prop]; len(vs) > 0 {
+		if e, ok := vs[0].(Embedded); ok {
+			return e.Html
+		}
+	}
+	return html.EscapeString(i.String(prop))
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return strings.TrimSpace(a.Val)
+		}
+	}
+	return ""
+}
+
+func classes(n *html.Node) []string {
+	return strings.Fields(attr(n, "class"))
+}
+
+// rootClasses returns the h-* classes of n.
+func rootClasses(n *html.Node) []string {
+	var types []string
+	for _, c := range classes(n) {
+		if isName(c, "h-") {
+			types = append(types, c)
+		}
+	}
+	return types
+}
+
+type property struct {
+	prefix, name string
+}
+
+// propClasses returns the p-*, u-*, dt-* and e-* classes of n.
+func propClasses(n *html.Node) []property {
+	var props []property
+	for _, c := range classes(n) {
+		for _, prefix := range []string{"p-", "u-", "dt-", "e-"} {
+			if isName(c, prefix) {
+				props = append(props, property{prefix[:len(prefix)-1], c[len(prefix):]})
+			}
+		}
+	}
+	return props
+}
+
+// isName reports whether c is prefix followed by lower case letters and
+// hyphens.
+func isName(c, prefix string) bool {
+	if !strings.HasPrefix(c, prefix) || len(c) == len(prefix) {
+		return false
+	}
+	for _, r := range c[len(prefix):] {
+		if (r < 'a' || r > 'z') && r != '-' {
+			return false
+		}
+	}
+	return true
+}
+
+// roots returns the items below n that are not properties of another.
+func (p *parser) roots(n *html.Node) []*Item {
+	var items []*Item
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if types := rootClasses(c); len(types) > 0 {
+			items = append(items, p.item(c, types))
+		} else {
+			items = append(items, p.roots(c)...)
+		}
+	}
+	return items
+}
+
+func (p *parser) item(n *html.Node, types []string) *Item {
+	i := &Item{Type: types, Properties: make(map[string][]interface{})}
+	p.properties(n, i)
+	p.implied(n, i)
+	return i
+}
+
+// properties adds the properties found below n to i.
+func (p *parser) properties(n *html.Node, i *Item) {
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		props := propClasses(c)
+		if types := rootClasses(c); len(types) > 0 {
+			child := p.item(c, types)
+			if len(props) == 0 {
+				i.Children = append(i.Children, child)
+				continue
+			}
+			i.explicit = true
+			for _, prop := range props {
+				if prop.prefix == "e" {
+					i.Properties[prop.name] = append(i.Properties[prop.name], p.value(c, "e"))
+					continue
+				}
+				nested := *child
+				switch prop.prefix {
+				case "p":
+					nested.Value = child.String("name")
+				case "u":
+					nested.Value = child.String("url")
+				}
+				if nested.Value == "" {
+					nested.Value = p.value(c, prop.prefix).(string)
+				}
+				i.Properties[prop.name] = append(i.Properties[prop.name], &nested)
+			}
+			continue
+		}
+		for _, prop := range props {
+			if prop.prefix == "p" || prop.prefix == "e" {
+				i.explicit = true
+			}
+			i.Properties[prop.name] = append(i.Properties[prop.name], p.value(c, prop.prefix))
+		}
+		p.properties(c, i)
+	}
+}
+
+// value parses the value of a property of type prefix on n.
+func (p *parser) value(n *html.Node, prefix string) interface{} {
+	switch prefix {
+	case "e":
+		var b bytes.Buffer
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			html.Render(&b, c)
+		}
+		return Embedded{Html: strings.TrimSpace(b.String()), Value: text(n)}
+	case "u":
+		var v string
+		switch n.DataAtom {
+		case atom.A, atom.Area, atom.Link:
+			v = attr(n, "href")
+		case atom.Img, atom.Audio, atom.Source, atom.Iframe:
+			v = attr(n, "src")
+		case atom.Video:
+			if v = attr(n, "src"); v == "" {
+				v = attr(n, "poster")
+			}
+		case atom.Object:
+			v = attr(n, "data")
+		}
+		if v == "" {
+			v = p.plain(n, prefix)
+		}
+		if u, err := p.base.Parse(v); err == nil && v != "" {
+			v = u.String()
+		}
+		return v
+	}
+	return p.plain(n, prefix)
+}
+
+// plain parses p-* and dt-* values, and u-* values without a URL attribute.
+func (p *parser) plain(n *html.Node, prefix string) string {
+	if vs := valueClass(n); len(vs) > 0 {
+		sep := ""
+		if prefix == "dt" {
+			sep = " "
+		}
+		return strings.Join(vs, sep)
+	}
+	switch n.DataAtom {
+	case atom.Time, atom.Ins, atom.Del:
+		if prefix == "dt" && attr(n, "datetime") != "" {
+			return attr(n, "datetime")
+		}
+	case atom.Abbr, atom.Link:
+		if v := attr(n, "title"); v != "" {
+			return v
+		}
+	case atom.Data, atom.Input:
+		if v := attr(n, "value"); v != "" {
+			return v
+		}
+	case atom.Img, atom.Area:
+		if prefix == "p" && attr(n, "alt") != "" {
+			return attr(n, "alt")
+		}
+	}
+	return text(n)
+}
+
+// valueClass returns the values of the elements below n with class value.
+func valueClass(n *html.Node) []string {
+	var vs []string
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode || len(rootClasses(c)) > 0 {
+			continue
+		}
+		isValue := false
+		for _, cl := range classes(c) {
+			isValue = isValue || cl == "value"
+		}
+		if !isValue {
+			vs = append(vs, valueClass(c)...)
+			continue
+		}
+		switch {
+		case c.DataAtom == atom.Img || c.DataAtom == atom.Area:
+			vs = append(vs, attr(c, "alt"))
+		case c.DataAtom == atom.Data:
+			vs = append(vs, attr(c, "value"))
+		case c.DataAtom == atom.Abbr && attr(c, "title") != "":
+			vs = append(vs, attr(c, "title"))
+		case (c.DataAtom == atom.Time || c.DataAtom == atom.Ins || c.DataAtom == atom.Del) && attr(c, "datetime") != "":
+			vs = append(vs, attr(c, "datetime"))
+		default:
+			vs = append(vs, text(c))
+		}
+	}
+	return vs
+}
+
+// implied sets the name and url of i if they are not explicit.
+func (p *parser) implied(n *html.Node, i *Item) {
+	if _, ok := i.Properties["name"]; !ok && !i.explicit && len(i.Children) == 0 {
+		name := text(n)
+		switch {
+		case n.DataAtom == atom.Img || n.DataAtom == atom.Area:
+			name = attr(n, "alt")
+		case n.DataAtom == atom.Abbr && attr(n, "title") != "":
+			name = attr(n, "title")
+		}
+		if name != "" {
+			i.Properties["name"] = []interface{}{name}
+		}
+	}
+	if _, ok := i.Properties["url"]; !ok {
+		// n itself, or its only child or grandchild, if it is a link
+		for c, depth := n, 0; c != nil && depth < 3; c, depth = onlyChild(c), depth+1 {
+			if (c.DataAtom == atom.A || c.DataAtom == atom.Area) && attr(c, "href") != "" {
+				if depth > 0 && len(rootClasses(c)) > 0 {
+					break
+				}
+				i.Properties["url"] = []interface{}{p.value(c, "u")}
+				break
+			}
+		}
+	}
+}
+
+// onlyChild returns the single element child of n, or nil.
+func onlyChild(n *html.Node) *html.Node {
+	var only *html.Node
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type != html.ElementNode {
+			continue
+		}
+		if only != nil {
+			return nil
+		}
+		only = c
+	}
+	return only
+}
+
+// text returns the text content of n without scripts and styles, with
+// white space collapsed.
+func text(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.DataAtom == atom.Script || n.DataAtom == atom.Style:
+			return
+		case n.DataAtom == atom.Img:
+			b.WriteString(" " + attr(n, "alt") + " ")
+		case n.DataAtom == atom.Br || n.DataAtom == atom.P:
+			b.WriteString(" ")
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
@@ -0,0 +1,110 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package mf2
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+const page = `<html><head><title>Example Site</title></head><body>
+<div class="h-feed">
+	<h1 class="p-name">Notes</h1>
+	<a class="p-author h-card" href="/">Alice</a>
+	<article class="h-entry">
+		<h2 class="p-name">First post</h2>
+		<a class="u-url" href="/2013/first"><time class="dt-published" datetime="2013-05-06T07:08:09Z">May 6</time></a>
+		<div class="p-author h-card"><a class="p-name u-url" href="https://bob.example/">Bob</a></div>
+		<a class="p-category" href="/tag/go">go</a>
+		<div class="e-content"><p>Hello <b>world</b></p></div>
+	</article>
+	<article class="h-entry">
+		<div class="e-content">A note</div>
+		<a class="u-url" href="note"><span class="dt-published"><span class="value">2013-05-07</span> <span class="value">10:00</span></span></a>
+		<div class="h-cite"><a class="u-url" href="/other">another post</a></div>
+	</article>
+</div>
+</body></html>`
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/notes/")
+	d, err := Parse(strings.NewReader(page), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Title != "Example Site" {
+		t.Errorf("title: %q", d.Title)
+	}
+	f := d.Feed()
+	if f == nil {
+		t.Fatal("no feed")
+	}
+	if f.String("name") != "Notes" || f.String("author") != "Alice" {
+		t.Errorf("feed: %q by %q", f.String("name"), f.String("author"))
+	}
+	if len(f.Children) != 2 {
+		t.Fatalf("got %d entries", len(f.Children))
+	}
+	e := f.Children[0]
+	for prop, want := range map[string]string{
+		"name":      "First post",
+		"url":       "https://example.com/2013/first",
+		"published": "2013-05-06T07:08:09Z",
+		"author":    "Bob",
+		"category":  "go",
+		"content":   "Hello world",
+	} {
+		if got := e.String(prop); got != want {
+			t.Errorf("%s: got %q, want %q", prop, got, want)
+		}
+	}
+	if got := e.Html("content"); got != "<p>Hello <b>world</b></p>" {
+		t.Errorf("content html: %q", got)
+	}
+	if a, ok := e.Properties["author"][0].(*Item); !ok || a.String("url") != "https://bob.example/" {
+		t.Errorf("author: %#v", e.Properties["author"][0])
+	}
+
+	e = f.Children[1]
+	if e.String("name") != "" {
+		t.Errorf("note has an implied name: %q", e.String("name"))
+	}
+	if got := e.String("published"); got != "2013-05-07 10:00" {
+		t.Errorf("value class: %q", got)
+	}
+	if e.String("url") != "https://example.com/notes/note" {
+		t.Errorf("note url: %q", e.String("url"))
+	}
+	if len(e.Children) != 1 || e.Children[0].String("url") != "https://example.com/other" {
+		t.Errorf("implied url of child: %#v", e.Children)
+	}
+}
+
+func TestImpliedFeed(t *testing.T) {
+	d, err := Parse(strings.NewReader(`<div class="h-entry"><a href="/a">Only a link</a></div><p class="h-card">Me</p>`), &url.URL{Scheme: "http", Host: "example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := d.Feed()
+	if f == nil || len(f.Children) != 1 {
+		t.Fatalf("got %#v", f)
+	}
+	if e := f.Children[0]; e.String("name") != "Only a link" || e.String("url") != "http://example.com/a" {
+		t.Errorf("got %q %q", e.String("name"), e.String("url"))
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/msde/goread/mf2"
+	"github.com/msde/goread/sanitizer"
+)
+
+// Notes have no name, so their title is the start of their text.
+const noteTitleLen = 100
+
+// mf2Person converts a p-author value, either a name or an h-card.
+func mf2Person(v interface{}) Person {
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "http://") || strings.HasPrefix(v, "https://") {
+			return Person{Uri: v}
+		}
+		return Person{Name: v}
+	case *mf2.Item:
+		p := Person{Name: v.String("name"), Uri: v.String("url")}
+		if p.Name == "" && p.Uri == "" {
+			p.Name = v.Value
+		}
+		return p
+	}
+	return Person{}
+}
+
+// parseMF2 reads the h-feed, or the h-entry items, of an HTML page.
+func parseMF2(c context.Context, body []byte, fetchUrl string) (*Feed, []*Story, error) {
+	base, err := url.Parse(fetchUrl)
+	if err != nil {
+		return nil, nil, err
+	}
+	d, err := mf2.Parse(bytes.NewReader(body), base)
+	if err != nil {
+		return nil, nil, err
+	}
+	hf := d.Feed()
+	if hf == nil {
+		return nil, nil, fmt.Errorf("no h-feed or h-entry")
+	}
+	var f Feed
+	var s []*Story
+	f.Title = hf.String("name")
+	if f.Title == "" {
+		f.Title = d.Title
+	}
+	f.Link = hf.String("url")
+	if f.Link == "" {
+		f.Link = fetchUrl
+	}
+	if a := hf.Properties["author"]; len(a) > 0 {
+		f.Author = mf2Person(a[0])
+	}
+
+	for _, e := range hf.Children {
+		if !e.Is("h-entry") {
+			continue
+		}
+		st := Story{
+			Id:      e.String("uid"),
+			Title:   e.String("name"),
+			Link:    e.String("url"),
+			Summary: e.String("summary"),
+		}
+		st.content = e.Html("content")
+		if st.content == "" {
+			st.content = e.Html("summary")
+		}
+		if text := e.String("content"); st.Title == "" || st.Title == text {
+			st.Title = sanitizer.SnipText(text, noteTitleLen)
+		}
+		authors := e.Properties["author"]
+		if len(authors) == 0 {
+			authors = hf.Properties["author"]
+		}
+		for _, a := range authors {
+			addAuthor(&st, mf2Person(a))
+		}
+		st.Author = authorNames(&st)
+		for _, cat := range e.Strings("category") {
+			addCategory(&st, cat)
+		}
+		st.Thumbnail = e.String("photo")
+		if t, err := parseDate(c, &st.dateFailures, e.String("published")); err == nil {
+			st.Published = t
+		}
+		if t, err := parseDate(c, &st.dateFailures, e.String("updated")); err == nil {
+			st.Updated = t
+		}
+		s = append(s, &st)
+	}
+	return &f, s, nil
+}
@@ -0,0 +1,339 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/taskqueue"
+
+	"google.golang.org/appengine"
+)
+
+// Number of consecutive fetches that must permanently redirect to the same
+// URL before a feed is migrated there.
+const feedMovedThreshold = 3
+
+// Number of users whose subscriptions are rewritten per migrate-feed task.
+const migrateUserBatch = 100
+
+// noteRedirect records that a fetch of f was permanently redirected to
+// movedTo, or was not redirected if movedTo is empty. Once the same target
+// has been seen feedMovedThreshold times in a row a migration is queued.
+func noteRedirect(c context.Context, f *Feed, movedTo string) {
+	if movedTo == "" || movedTo == f.Url {
+		f.MovedTo = ""
+		f.MovedCount = 0
+		return
+	}
+	if movedTo == f.MovedTo {
+		f.MovedCount++
+	} else {
+		f.MovedTo = movedTo
+		f.MovedCount = 1
+	}
+	log.Infof(c, "feed %v moved to %v (%v)", f.Url, f.MovedTo, f.MovedCount)
+	if f.MovedCount < feedMovedThreshold {
+		return
+	}
+	t := taskqueue.NewPOSTTask(routeUrl("migrate-feed"), url.Values{
+		"from": {f.Url},
+		"to":   {f.MovedTo},
+	})
+	t.Name = fmt.Sprintf("migrate_%v", taskNameEscape(f.Url))
+	if _, err := taskqueue.Add(c, t, ""); err == taskqueue.ErrTaskAlreadyAdded {
+		log.Debugf(c, "migration already queued: %v", f.Url)
+	} else if err != nil {
+		log.Errorf(c, "taskqueue error: %v", err.Error())
+	}
+}
+
+// MigrateFeed moves a permanently redirected feed to its new URL. The first
+// run copies the Feed and its stories; it then walks all users in batches,
+// rewriting subscriptions, read state and stars, and finally retires the
+// old feed.
+func MigrateFeed(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	from := r.FormValue("from")
+	to := r.FormValue("to")
+	old, err := Store.GetFeed(c, from)
+	if err != nil {
+		log.Errorf(c, "migrate %v: %v", from, err)
+		return
+	}
+	if old.Migrated {
+		log.Infof(c, "feed %v already migrated to %v", from, old.MovedTo)
+		return
+	}
+	if to == "" || old.MovedTo != to || old.MovedCount < feedMovedThreshold {
+		log.Warningf(c, "not migrating %v to %v: %v, %v", from, to, old.MovedTo, old.MovedCount)
+		return
+	}
+
+	cursor := r.FormValue("c")
+	if cursor == "" {
+		if err := copyFeed(c, old, to); err != nil {
+			log.Errorf(c, "migrate copy %v: %v", from, err)
+			serveError(w, err)
+			return
+		}
+	}
+
+	tctx, cancel := context.WithTimeout(c, time.Minute)
+	defer cancel()
+	uids, cur, err := Store.UserIds(tctx, Page{Cursor: cursor, Limit: migrateUserBatch})
+	if err != nil {
+		log.Errorf(c, "migrate next error: %v", err)
+		serveError(w, err)
+		return
+	}
+	for _, uid := range uids {
+		if err := migrateUser(c, uid, from, to); err != nil {
+			log.Errorf(c, "migrate user %v: %v", uid, err)
+			serveError(w, err)
+			return
+		}
+	}
+	if len(uids) == migrateUserBatch {
+		t := taskqueue.NewPOSTTask(routeUrl("migrate-feed"), url.Values{
+			"from": {from},
+			"to":   {to},
+			"c":    {cur},
+		})
+		if _, err := taskqueue.Add(c, t, ""); err != nil {
+			log.Errorf(c, "taskqueue error: %v", err.Error())
+			serveError(w, err)
+		}
+		return
+	}
+
+	// Stop polling the old URL. Its stories are removed by DeleteOldFeeds
+	// once nobody has viewed it for a while.
+	old.Migrated = true
+	old.NextUpdate = timeMax
+	if err := Store.PutFeed(c, old); err != nil {
+		log.Errorf(c, "migrate put err: %v", err)
+		serveError(w, err)
+		return
+	}
+	log.Infof(c, "migrated feed %v to %v", from, to)
+}
+
+// copyFeed creates the Feed at to from old if it does not already exist,
+// and copies any stories it is missing.
+func copyFeed(c context.Context, old *Feed, to string) error {
+	if _, err := Store.GetFeed(c, to); err == ErrNotFound {
+		nf := *old
+		nf.Url = to
+		nf.MovedTo = ""
+		nf.MovedCount = 0
+		nf.Subscribed = time.Time{}
+		nf.ETag = ""
+		nf.LastModified = ""
+		nf.ValidatorUrl = ""
+		if err := Store.PutFeed(c, &nf); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+
+	log.Infof(c, "copying stories from %v to %v", old.Url, to)
+	const batch = 100
+	cursor := ""
+	for {
+		stories, cur, err := Store.FeedStories(c, old.Url, StoryQuery{Page: Page{Cursor: cursor, Limit: batch}})
+		if err != nil {
+			return err
+		}
+		cursor = cur
+		ids := make([]readStory, len(stories))
+		for i, s := range stories {
+			ids[i] = readStory{Feed: to, Story: s.Id}
+		}
+		existing, err := Store.GetStories(c, ids)
+		if err != nil {
+			return err
+		}
+		var missing []*Story
+		var oids []readStory
+		for i, s := range stories {
+			if existing[i] == nil {
+				missing = append(missing, s)
+				oids = append(oids, readStory{Feed: old.Url, Story: s.Id})
+			}
+		}
+		if len(missing) > 0 {
+			// a missing StoryContent just leaves the copy without content
+			contents, err := Store.StoryContents(c, oids)
+			if err != nil {
+				return err
+			}
+			for i, s := range missing {
+				s.Feed = to
+				s.content = contents[i]
+			}
+			if err := Store.PutStories(c, missing, true); err != nil {
+				return err
+			}
+		}
+		if len(stories) < batch {
+			return nil
+		}
+	}
+}
+
+// migrateUser rewrites one user's subscriptions, read state, stars and
+// playback positions from the feed at from to the feed at to.
+func migrateUser(c context.Context, uid, from, to string) error {
+	return Store.RunInTransaction(c, func(c context.Context) error {
+		ud, err := Store.GetUserData(c, uid)
+		if err == ErrNotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		changed, err := moveOpmlFeed(ud, from, to)
+		if err != nil || !changed {
+			return err
+		}
+		if ud.Read != nil {
+			read := make(Read)
+			gob.NewDecoder(bytes.NewReader(ud.Read)).Decode(&read)
+			for rs := range read {
+				if rs.Feed == from {
+					delete(read, rs)
+					read[readStory{Feed: to, Story: rs.Story}] = true
+				}
+			}
+			var b bytes.Buffer
+			gob.NewEncoder(&b).Encode(&read)
+			ud.Read = b.Bytes()
+		}
+		if err := Store.PutUserData(c, uid, ud); err != nil {
+			return err
+		}
+
+		reads, err := Store.FeedReads(c, uid, from, time.Time{})
+		if err != nil {
+			return err
+		}
+		ids := make([]readStory, len(reads))
+		for i, r := range reads {
+			ids[i] = readStory{Feed: from, Story: r.Story}
+			r.Feed = to
+		}
+		if err := Store.PutReads(c, uid, reads); err != nil {
+			return err
+		}
+		if err := Store.DeleteReads(c, uid, ids); err != nil {
+			return err
+		}
+
+		stars, _, err := Store.Stars(c, uid, StarQuery{Feed: from})
+		if err != nil {
+			return err
+		}
+		for _, s := range stars {
+			if err := Store.PutStar(c, uid, &UserStar{
+				Feed:    to,
+				Story:   s.Story,
+				Created: s.Created,
+			}); err != nil {
+				return err
+			}
+			if err := Store.DeleteStar(c, uid, from, s.Story); err != nil {
+				return err
+			}
+		}
+
+		playback, err := Store.FeedPlaybacks(c, uid, from)
+		if err != nil {
+			return err
+		}
+		for _, p := range playback {
+			story := p.Story
+			p.Feed = to
+			if err := Store.PutPlayback(c, uid, p); err != nil {
+				return err
+			}
+			if err := Store.DeletePlayback(c, uid, from, story); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// moveOpmlFeed replaces subscriptions to from with to in ud's OPML. If the
+// user is already subscribed to to, the old outline is dropped instead.
+func moveOpmlFeed(ud *UserData, from, to string) (bool, error) {
+	var fs Opml
+	if err := json.Unmarshal(ud.Opml, &fs); err != nil {
+		return false, nil
+	}
+	has := false
+	for _, o := range fs.Outline {
+		if o.XmlUrl == to {
+			has = true
+		}
+		for _, so := range o.Outline {
+			if so.XmlUrl == to {
+				has = true
+			}
+		}
+	}
+	changed := false
+	move := func(outlines []*OpmlOutline) []*OpmlOutline {
+		n := outlines[:0]
+		for _, o := range outlines {
+			if o.XmlUrl == from {
+				changed = true
+				if has {
+					continue
+				}
+				o.XmlUrl = to
+				has = true
+			}
+			n = append(n, o)
+		}
+		return n
+	}
+	for _, o := range fs.Outline {
+		if o.XmlUrl == "" {
+			o.Outline = move(o.Outline)
+		}
+	}
+	fs.Outline = move(fs.Outline)
+	if !changed {
+		return false, nil
+	}
+	b, err := json.Marshal(&fs)
+	if err != nil {
+		return false, err
+	}
+	ud.Opml = b
+	return true, nil
+}
@@ -0,0 +1,163 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package blobstore keeps uploaded files in the App Engine blobstore, or in
+// Dir when standalone.
+package blobstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/msde/goread/platform"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/blobstore"
+)
+
+type (
+	BlobInfo         = blobstore.BlobInfo
+	Reader           = blobstore.Reader
+	UploadURLOptions = blobstore.UploadURLOptions
+)
+
+// Dir is where blobs are stored when standalone.
+var Dir = "blobs"
+
+// Largest upload kept in memory by ParseUpload when standalone.
+const maxMemory = 1 << 20
+
+var errBadKey = errors.New("blobstore: bad blob key")
+
+// path returns the file of key, which must be one returned by ParseUpload.
+func path(key appengine.BlobKey) (string, error) {
+	if _, err := hex.DecodeString(string(key)); err != nil || key == "" {
+		return "", errBadKey
+	}
+	return filepath.Join(Dir, string(key)), nil
+}
+
+// UploadURL returns the URL files are uploaded to, which then goes on to
+// successPath. When standalone, that's successPath itself.
+func UploadURL(c context.Context, successPath string, opts *UploadURLOptions) (*url.URL, error) {
+	if !platform.Standalone {
+		return blobstore.UploadURL(c, successPath, opts)
+	}
+	return url.Parse(successPath)
+}
+
+// ParseUpload stores the files uploaded with req and returns them by form
+// field, along with the other form values.
+func ParseUpload(req *http.Request) (map[string][]*BlobInfo, url.Values, error) {
+	if !platform.Standalone {
+		return blobstore.ParseUpload(req)
+	}
+	if err := req.ParseMultipartForm(maxMemory); err != nil {
+		return nil, nil, err
+	}
+	if err := os.MkdirAll(Dir, 0700); err != nil {
+		return nil, nil, err
+	}
+	blobs := make(map[string][]*BlobInfo)
+	for field, fhs := range req.MultipartForm.File {
+		for _, fh := range fhs {
+			f, err := fh.Open()
+			if err != nil {
+				return nil, nil, err
+			}
+			b, err := ioutil.ReadAll(f)
+			f.Close()
+			if err != nil {
+				return nil, nil, err
+			}
+			k := make([]byte, 16)
+			rand.Read(k)
+			bi := &BlobInfo{
+				BlobKey:      appengine.BlobKey(hex.EncodeToString(k)),
+				ContentType:  fh.Header.Get("Content-Type"),
+				CreationTime: time.Now(),
+				Filename:     fh.Filename,
+				Size:         int64(len(b)),
+			}
+			sum := md5.Sum(b)
+			bi.MD5 = hex.EncodeToString(sum[:])
+			p, _ := path(bi.BlobKey)
+			if err := ioutil.WriteFile(p, b, 0600); err != nil {
+				return nil, nil, err
+			}
+			blobs[field] = append(blobs[field], bi)
+		}
+	}
+	return blobs, url.Values(req.MultipartForm.Value), nil
+}
+
+// NewReader returns a reader for a blob. Like App Engine's, it always
+// succeeds, and reading fails if the blob doesn't exist.
+func NewReader(c context.Context, key appengine.BlobKey) Reader {
+	if !platform.Standalone {
+		return blobstore.NewReader(c, key)
+	}
+	p, err := path(key)
+	if err != nil {
+		return errReader{err}
+	}
+	b, err := ioutil.ReadFile(p)
+	if err != nil {
+		return errReader{err}
+	}
+	return bytes.NewReader(b)
+}
+
+func Delete(c context.Context, key appengine.BlobKey) error {
+	if !platform.Standalone {
+		return blobstore.Delete(c, key)
+	}
+	p, err := path(key)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func DeleteMulti(c context.Context, keys []appengine.BlobKey) error {
+	if !platform.Standalone {
+		return blobstore.DeleteMulti(c, keys)
+	}
+	for _, k := range keys {
+		if err := Delete(c, k); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error)          { return 0, r.err }
+func (r errReader) ReadAt([]byte, int64) (int, error) { return 0, r.err }
+func (r errReader) Seek(int64, int) (int64, error)    { return 0, r.err }
@@ -0,0 +1,75 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package log writes App Engine logs, or to the standard logger when
+// standalone.
+package log
+
+import (
+	"context"
+	_log "log"
+
+	"github.com/msde/goread/platform"
+
+	"google.golang.org/appengine/log"
+)
+
+// Debug enables Debugf output when standalone.
+var Debug bool
+
+func logf(level, format string, args []interface{}) {
+	_log.Printf(level+": "+format, args...)
+}
+
+func Debugf(c context.Context, format string, args ...interface{}) {
+	if !platform.Standalone {
+		log.Debugf(c, format, args...)
+	} else if Debug {
+		logf("DEBUG", format, args)
+	}
+}
+
+func Infof(c context.Context, format string, args ...interface{}) {
+	if !platform.Standalone {
+		log.Infof(c, format, args...)
+	} else {
+		logf("INFO", format, args)
+	}
+}
+
+func Warningf(c context.Context, format string, args ...interface{}) {
+	if !platform.Standalone {
+		log.Warningf(c, format, args...)
+	} else {
+		logf("WARNING", format, args)
+	}
+}
+
+func Errorf(c context.Context, format string, args ...interface{}) {
+	if !platform.Standalone {
+		log.Errorf(c, format, args...)
+	} else {
+		logf("ERROR", format, args)
+	}
+}
+
+func Criticalf(c context.Context, format string, args ...interface{}) {
+	if !platform.Standalone {
+		log.Criticalf(c, format, args...)
+	} else {
+		logf("CRITICAL", format, args)
+	}
+}
@@ -0,0 +1,183 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package memcache caches items in App Engine memcache, or in process
+// memory when standalone.
+package memcache
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/msde/goread/platform"
+
+	"google.golang.org/appengine/memcache"
+)
+
+type Item = memcache.Item
+
+var (
+	ErrCacheMiss = memcache.ErrCacheMiss
+	ErrNotStored = memcache.ErrNotStored
+
+	errNotNumber = errors.New("memcache: value is not a number")
+)
+
+// How often expired items are swept from the standalone cache.
+const sweepInterval = time.Minute
+
+type entry struct {
+	value   []byte
+	expires time.Time
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && now.After(e.expires)
+}
+
+var cache = struct {
+	sync.Mutex
+	items map[string]*entry
+	swept time.Time
+}{items: make(map[string]*entry)}
+
+// get returns the live entry for key. cache must be locked.
+func get(key string, now time.Time) *entry {
+	e := cache.items[key]
+	if e != nil && e.expired(now) {
+		delete(cache.items, key)
+		return nil
+	}
+	return e
+}
+
+// set stores item. cache must be locked.
+func set(item *Item, now time.Time) {
+	if now.Sub(cache.swept) > sweepInterval {
+		for k, e := range cache.items {
+			if e.expired(now) {
+				delete(cache.items, k)
+			}
+		}
+		cache.swept = now
+	}
+	e := &entry{value: append([]byte(nil), item.Value...)}
+	if item.Expiration > 0 {
+		e.expires = now.Add(item.Expiration)
+	}
+	cache.items[item.Key] = e
+}
+
+func Get(c context.Context, key string) (*Item, error) {
+	if !platform.Standalone {
+		return memcache.Get(c, key)
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	e := get(key, time.Now())
+	if e == nil {
+		return nil, ErrCacheMiss
+	}
+	return &Item{Key: key, Value: append([]byte(nil), e.value...)}, nil
+}
+
+// GetMulti returns the items of keys that are cached.
+func GetMulti(c context.Context, keys []string) (map[string]*Item, error) {
+	if !platform.Standalone {
+		return memcache.GetMulti(c, keys)
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	now := time.Now()
+	items := make(map[string]*Item)
+	for _, k := range keys {
+		if e := get(k, now); e != nil {
+			items[k] = &Item{Key: k, Value: append([]byte(nil), e.value...)}
+		}
+	}
+	return items, nil
+}
+
+func Set(c context.Context, item *Item) error {
+	if !platform.Standalone {
+		return memcache.Set(c, item)
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	set(item, time.Now())
+	return nil
+}
+
+// Add stores item unless its key is already cached, in which case it
+// returns ErrNotStored.
+func Add(c context.Context, item *Item) error {
+	if !platform.Standalone {
+		return memcache.Add(c, item)
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	now := time.Now()
+	if get(item.Key, now) != nil {
+		return ErrNotStored
+	}
+	set(item, now)
+	return nil
+}
+
+// Delete removes key, or returns ErrCacheMiss if it isn't cached.
+func Delete(c context.Context, key string) error {
+	if !platform.Standalone {
+		return memcache.Delete(c, key)
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	if get(key, time.Now()) == nil {
+		return ErrCacheMiss
+	}
+	delete(cache.items, key)
+	return nil
+}
+
+// Increment adds delta to the number stored at key, which starts at
+// initialValue if it isn't cached. Like memcache, it doesn't go below zero.
+func Increment(c context.Context, key string, delta int64, initialValue uint64) (uint64, error) {
+	if !platform.Standalone {
+		return memcache.Increment(c, key, delta, initialValue)
+	}
+	cache.Lock()
+	defer cache.Unlock()
+	e := get(key, time.Now())
+	n := initialValue
+	if e != nil {
+		var err error
+		if n, err = strconv.ParseUint(string(e.value), 10, 64); err != nil {
+			return 0, errNotNumber
+		}
+	} else {
+		e = &entry{}
+		cache.items[key] = e
+	}
+	if delta < 0 && uint64(-delta) > n {
+		n = 0
+	} else {
+		n += uint64(delta)
+	}
+	e.value = []byte(strconv.FormatUint(n, 10))
+	return n, nil
+}
@@ -0,0 +1,69 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package memcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/msde/goread/platform"
+)
+
+func TestStandalone(t *testing.T) {
+	platform.Standalone = true
+	defer func() { platform.Standalone = false }()
+	c := context.Background()
+
+	if _, err := Get(c, "a"); err != ErrCacheMiss {
+		t.Fatalf("get missing: %v", err)
+	}
+	Set(c, &Item{Key: "a", Value: []byte("1")})
+	if err := Add(c, &Item{Key: "a", Value: []byte("2")}); err != ErrNotStored {
+		t.Fatalf("add existing: %v", err)
+	}
+	if item, err := Get(c, "a"); err != nil || string(item.Value) != "1" {
+		t.Fatalf("get: %v, %v", item, err)
+	}
+
+	Add(c, &Item{Key: "old", Value: []byte("x"), Expiration: time.Millisecond})
+	time.Sleep(time.Millisecond * 5)
+	items, _ := GetMulti(c, []string{"a", "old"})
+	if len(items) != 1 || items["a"] == nil {
+		t.Fatalf("get multi: %v", items)
+	}
+
+	if err := Delete(c, "a"); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if err := Delete(c, "a"); err != ErrCacheMiss {
+		t.Fatalf("delete missing: %v", err)
+	}
+
+	for i, test := range []struct {
+		delta int64
+		want  uint64
+	}{
+		{1, 6},
+		{2, 8},
+		{-10, 0},
+	} {
+		if n, err := Increment(c, "n", test.delta, 5); err != nil || n != test.want {
+			t.Errorf("%v: got %v, %v; want %v", i, n, err, test.want)
+		}
+	}
+}
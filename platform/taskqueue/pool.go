@@ -0,0 +1,328 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package taskqueue
+
+import (
+	"bytes"
+	"container/heap"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	_log "log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"google.golang.org/appengine"
+)
+
+// How long task names are remembered for ErrTaskAlreadyAdded.
+const nameTTL = time.Hour * 24 * 7
+
+// Pool is a Service that runs tasks in-process by serving them with a
+// handler. Each queue starts tasks at its rate, and retries tasks whose
+// response status isn't 2xx up to its retry limit.
+type Pool struct {
+	handler http.Handler
+	sem     chan struct{}
+
+	mu      sync.Mutex
+	idle    *sync.Cond
+	queues  map[string]*queue
+	names   map[string]bool
+	added   []addedName
+	pending int
+}
+
+// addedName is a task name given by the caller, and when it was added.
+type addedName struct {
+	name string
+	at   time.Time
+}
+
+// NewPool returns a Pool serving tasks with h, at most workers at a time.
+// The default queue is added unless queues configures it.
+func NewPool(h http.Handler, workers int, queues []Queue) *Pool {
+	p := &Pool{
+		handler: h,
+		sem:     make(chan struct{}, workers),
+		queues:  make(map[string]*queue),
+		names:   make(map[string]bool),
+	}
+	p.idle = sync.NewCond(&p.mu)
+	for _, q := range append([]Queue{DefaultQueue}, queues...) {
+		p.queues[q.Name] = &queue{
+			Queue:  q,
+			pool:   p,
+			tokens: float64(q.BucketSize),
+			filled: time.Now(),
+			wake:   make(chan struct{}, 1),
+		}
+	}
+	for _, q := range p.queues {
+		go q.loop()
+	}
+	return p
+}
+
+func (p *Pool) Add(c context.Context, t *Task, queueName string) (*Task, error) {
+	if queueName == "" {
+		queueName = "default"
+	}
+	q := p.queues[queueName]
+	if q == nil {
+		return nil, fmt.Errorf("taskqueue: unknown queue %q", queueName)
+	}
+	nt := *t
+	if nt.Method == "" {
+		nt.Method = "POST"
+	}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if nt.Name == "" {
+		// Generated names are unique, so aren't remembered.
+		b := make([]byte, 16)
+		rand.Read(b)
+		nt.Name = hex.EncodeToString(b)
+	} else {
+		p.expireNames(now)
+		if p.names[nt.Name] {
+			return nil, ErrTaskAlreadyAdded
+		}
+		p.names[nt.Name] = true
+		p.added = append(p.added, addedName{nt.Name, now})
+	}
+	eta := nt.ETA
+	if eta.IsZero() {
+		eta = now.Add(nt.Delay)
+	}
+	ret := nt
+	p.pending++
+	heap.Push(&q.tasks, &pending{Task: &nt, eta: eta})
+	q.notify()
+	return &ret, nil
+}
+
+// expireNames forgets names added at least nameTTL before now. Names are
+// added in time order, so only the oldest are looked at. p.mu must be held.
+func (p *Pool) expireNames(now time.Time) {
+	n := 0
+	for ; n < len(p.added) && now.Sub(p.added[n].at) >= nameTTL; n++ {
+		delete(p.names, p.added[n].name)
+	}
+	p.added = p.added[n:]
+}
+
+func (p *Pool) AddMulti(c context.Context, tasks []*Task, queueName string) ([]*Task, error) {
+	ret := make([]*Task, len(tasks))
+	var merr appengine.MultiError
+	for i, t := range tasks {
+		nt, err := p.Add(c, t, queueName)
+		if err != nil {
+			if merr == nil {
+				merr = make(appengine.MultiError, len(tasks))
+			}
+			merr[i] = err
+		}
+		ret[i] = nt
+	}
+	if merr != nil {
+		return ret, merr
+	}
+	return ret, nil
+}
+
+// Wait waits until every task has succeeded or run out of retries,
+// including tasks added meanwhile.
+func (p *Pool) Wait() {
+	p.mu.Lock()
+	for p.pending > 0 {
+		p.idle.Wait()
+	}
+	p.mu.Unlock()
+}
+
+type queue struct {
+	Queue
+	pool *Pool
+
+	// The rest is guarded by pool.mu.
+	tasks   taskHeap
+	tokens  float64
+	filled  time.Time
+	running int
+	wake    chan struct{}
+}
+
+// notify wakes the loop of q.
+func (q *queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (q *queue) loop() {
+	for {
+		t, wait := q.next()
+		if t != nil {
+			go q.run(t)
+			continue
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-q.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// next removes and returns the next task if it may start, or returns how
+// long to wait otherwise.
+func (q *queue) next() (*pending, time.Duration) {
+	const forever = time.Hour
+	q.pool.mu.Lock()
+	defer q.pool.mu.Unlock()
+	now := time.Now()
+	if q.Rate > 0 {
+		q.tokens += now.Sub(q.filled).Seconds() * q.Rate
+		if max := float64(q.BucketSize); q.tokens > max {
+			q.tokens = max
+		}
+	}
+	q.filled = now
+	if len(q.tasks) == 0 {
+		return nil, forever
+	}
+	if d := q.tasks[0].eta.Sub(now); d > 0 {
+		return nil, d
+	}
+	if q.MaxConcurrent > 0 && q.running >= q.MaxConcurrent {
+		return nil, forever
+	}
+	if q.tokens < 1 {
+		if q.Rate <= 0 {
+			return nil, forever
+		}
+		return nil, time.Duration((1 - q.tokens) / q.Rate * float64(time.Second))
+	}
+	q.tokens--
+	q.running++
+	return heap.Pop(&q.tasks).(*pending), 0
+}
+
+// run serves t with the headers App Engine sets on tasks, and then retries
+// it or marks it done.
+func (q *queue) run(t *pending) {
+	p := q.pool
+	p.sem <- struct{}{}
+	status := q.serve(t.Task)
+	<-p.sem
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	q.running--
+	failed := status < 200 || status > 299
+	if failed && (q.RetryLimit < 0 || int(t.RetryCount) < q.RetryLimit) {
+		t.RetryCount++
+		t.eta = time.Now().Add(q.backoff(int(t.RetryCount)))
+		heap.Push(&q.tasks, t)
+	} else {
+		if failed {
+			_log.Printf("task %v %v failed: %v", t.Name, t.Path, status)
+		}
+		p.pending--
+		if p.pending == 0 {
+			p.idle.Broadcast()
+		}
+	}
+	q.notify()
+}
+
+func (q *queue) serve(t *Task) (status int) {
+	c := context.Background()
+	r, err := http.NewRequest(t.Method, t.Path, bytes.NewReader(t.Payload))
+	if err != nil {
+		_log.Printf("task %v: %v", t.Name, err)
+		return http.StatusBadRequest
+	}
+	r = r.WithContext(c)
+	for k, v := range t.Header {
+		r.Header[k] = v
+	}
+	r.Header.Set("X-AppEngine-QueueName", q.Name)
+	r.Header.Set("X-AppEngine-TaskName", t.Name)
+	r.Header.Set("X-AppEngine-TaskRetryCount", strconv.Itoa(int(t.RetryCount)))
+	w := &response{header: make(http.Header)}
+	defer func() {
+		if err := recover(); err != nil {
+			_log.Printf("task %v %v panic: %v", t.Name, t.Path, err)
+			status = http.StatusInternalServerError
+		}
+	}()
+	q.pool.handler.ServeHTTP(w, r)
+	if w.status == 0 {
+		return http.StatusOK
+	}
+	return w.status
+}
+
+// pending is a task waiting to run at eta.
+type pending struct {
+	*Task
+	eta time.Time
+}
+
+type taskHeap []*pending
+
+func (h taskHeap) Len() int            { return len(h) }
+func (h taskHeap) Less(i, j int) bool  { return h[i].eta.Before(h[j].eta) }
+func (h taskHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *taskHeap) Push(x interface{}) { *h = append(*h, x.(*pending)) }
+func (h *taskHeap) Pop() interface{} {
+	old := *h
+	t := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return t
+}
+
+// response discards what a task handler writes, keeping only the status.
+type response struct {
+	header http.Header
+	status int
+}
+
+func (w *response) Header() http.Header {
+	return w.header
+}
+
+func (w *response) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (w *response) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+}
@@ -0,0 +1,181 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package taskqueue
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+)
+
+const queueYAML = `
+queue:
+- name: update-feed
+  rate: 10/s
+  bucket_size: 20
+  retry_parameters:
+    task_retry_limit: 1
+- name: import-reader
+  rate: 20/s
+  retry_parameters:
+    task_retry_limit: 2
+- name: slow
+  rate: 30/m
+  max_concurrent_requests: 1
+`
+
+func TestParseQueues(t *testing.T) {
+	queues, err := ParseQueues([]byte(queueYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Queue{
+		{Name: "update-feed", Rate: 10, BucketSize: 20, RetryLimit: 1},
+		{Name: "import-reader", Rate: 20, BucketSize: defaultBucketSize, RetryLimit: 2},
+		{Name: "slow", Rate: 0.5, BucketSize: defaultBucketSize, MaxConcurrent: 1, RetryLimit: -1},
+	}
+	if len(queues) != len(want) {
+		t.Fatalf("got %v queues", len(queues))
+	}
+	for i, w := range want {
+		w.MinBackoff = defaultMinBackoff
+		w.MaxBackoff = defaultMaxBackoff
+		w.MaxDoublings = defaultMaxDoublings
+		if queues[i] != w {
+			t.Errorf("%v: got %+v, want %+v", i, queues[i], w)
+		}
+	}
+	if _, err := ParseQueues([]byte("queue:\n- name: x\n  rate: 5/w\n")); err == nil {
+		t.Error("expected rate error")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	q := Queue{MinBackoff: time.Second, MaxBackoff: time.Second * 10, MaxDoublings: 2}
+	for retry, want := range []time.Duration{1, 1, 2, 4, 4} {
+		if got := q.backoff(retry); got != want*time.Second {
+			t.Errorf("%v: got %v, want %v", retry, got, want*time.Second)
+		}
+	}
+}
+
+// counter is a task handler counting requests by path. Paths in fail
+// return errors, and /chain adds a task to /done.
+type counter struct {
+	sync.Mutex
+	pool *Pool
+	runs map[string]int
+	fail map[string]bool
+}
+
+func (h *counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.Lock()
+	h.runs[r.URL.Path]++
+	h.Unlock()
+	if h.fail[r.URL.Path] {
+		http.Error(w, "fail", http.StatusInternalServerError)
+		return
+	}
+	if r.URL.Path == "/chain" {
+		h.pool.Add(r.Context(), NewPOSTTask("/done", nil), "")
+	}
+}
+
+func newCounter(queues ...Queue) *counter {
+	h := &counter{
+		runs: make(map[string]int),
+		fail: map[string]bool{"/fail": true},
+	}
+	h.pool = NewPool(h, 4, queues)
+	return h
+}
+
+func TestPool(t *testing.T) {
+	h := newCounter(Queue{Name: "retry", Rate: 100, BucketSize: 10, RetryLimit: 2, MinBackoff: time.Millisecond})
+	c := context.Background()
+	p := h.pool
+
+	named := NewPOSTTask("/named", url.Values{"a": {"b"}})
+	named.Name = "once"
+	if _, err := p.Add(c, named, ""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Add(c, named, ""); err != ErrTaskAlreadyAdded {
+		t.Fatalf("got %v, want ErrTaskAlreadyAdded", err)
+	}
+	if _, err := p.Add(c, named, "missing"); err == nil {
+		t.Fatal("expected unknown queue error")
+	}
+	if _, err := p.AddMulti(c, []*Task{NewPOSTTask("/fail", nil), NewPOSTTask("/chain", nil)}, "retry"); err != nil {
+		t.Fatal(err)
+	}
+	p.Wait()
+	for path, want := range map[string]int{
+		"/named": 1,
+		"/fail":  3,
+		"/chain": 1,
+		"/done":  1,
+	} {
+		if got := h.runs[path]; got != want {
+			t.Errorf("%v: got %v runs, want %v", path, got, want)
+		}
+	}
+}
+
+func TestPoolNames(t *testing.T) {
+	p := newCounter().pool
+	c := context.Background()
+	for i := 0; i < 3; i++ {
+		if _, err := p.Add(c, NewPOSTTask("/unnamed", nil), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	named := NewPOSTTask("/named", nil)
+	named.Name = "once"
+	p.Add(c, named, "")
+	p.Wait()
+	p.mu.Lock()
+	if len(p.names) != 1 || len(p.added) != 1 {
+		t.Errorf("remembered %v names", len(p.names))
+	}
+	p.expireNames(time.Now().Add(nameTTL))
+	p.mu.Unlock()
+	if _, err := p.Add(c, named, ""); err != nil {
+		t.Errorf("expired name: %v", err)
+	}
+	p.Wait()
+}
+
+func TestPoolRate(t *testing.T) {
+	h := newCounter(Queue{Name: "rate", Rate: 50, BucketSize: 2})
+	c := context.Background()
+	start := time.Now()
+	for i := 0; i < 7; i++ {
+		h.pool.Add(c, NewPOSTTask("/rate", nil), "rate")
+	}
+	h.pool.Wait()
+	// the bucket starts 2 tasks at once, and the other 5 take 20ms each
+	if d := time.Since(start); d < time.Millisecond*100 {
+		t.Errorf("7 tasks ran in %v", d)
+	}
+	if h.runs["/rate"] != 7 {
+		t.Errorf("got %v runs", h.runs["/rate"])
+	}
+}
@@ -0,0 +1,159 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package taskqueue
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Queue configures a push queue of a Pool, as queue.yaml does on App
+// Engine.
+type Queue struct {
+	Name string
+
+	// Rate is how many tasks are started per second, and BucketSize how
+	// many may be started at once after the queue has been idle. A queue
+	// with no Rate is paused.
+	Rate       float64
+	BucketSize int
+
+	// MaxConcurrent limits how many tasks run at once, if not zero.
+	MaxConcurrent int
+
+	// RetryLimit is how often a failed task is retried, or unlimited if
+	// negative. Retries wait MinBackoff, doubled up to MaxDoublings times
+	// and at most MaxBackoff.
+	RetryLimit   int
+	MinBackoff   time.Duration
+	MaxBackoff   time.Duration
+	MaxDoublings int
+}
+
+// App Engine's defaults for what queue.yaml leaves out.
+const (
+	defaultBucketSize   = 5
+	defaultRate         = 5
+	defaultMinBackoff   = time.Second / 10
+	defaultMaxBackoff   = time.Hour
+	defaultMaxDoublings = 16
+)
+
+// DefaultQueue is the default queue when queue.yaml doesn't configure it.
+var DefaultQueue = Queue{
+	Name:         "default",
+	Rate:         defaultRate,
+	BucketSize:   defaultBucketSize,
+	RetryLimit:   -1,
+	MinBackoff:   defaultMinBackoff,
+	MaxBackoff:   defaultMaxBackoff,
+	MaxDoublings: defaultMaxDoublings,
+}
+
+type queueYaml struct {
+	Queue []struct {
+		Name                  string `yaml:"name"`
+		Rate                  string `yaml:"rate"`
+		BucketSize            int    `yaml:"bucket_size"`
+		MaxConcurrentRequests int    `yaml:"max_concurrent_requests"`
+		RetryParameters       struct {
+			TaskRetryLimit    *int     `yaml:"task_retry_limit"`
+			MinBackoffSeconds *float64 `yaml:"min_backoff_seconds"`
+			MaxBackoffSeconds *float64 `yaml:"max_backoff_seconds"`
+			MaxDoublings      *int     `yaml:"max_doublings"`
+		} `yaml:"retry_parameters"`
+	} `yaml:"queue"`
+}
+
+// ParseQueues reads the push queues of a queue.yaml file.
+func ParseQueues(b []byte) ([]Queue, error) {
+	var y queueYaml
+	if err := yaml.Unmarshal(b, &y); err != nil {
+		return nil, err
+	}
+	var queues []Queue
+	for _, yq := range y.Queue {
+		q := DefaultQueue
+		q.Name = yq.Name
+		if yq.Rate != "" {
+			rate, err := parseRate(yq.Rate)
+			if err != nil {
+				return nil, fmt.Errorf("queue %v: %v", yq.Name, err)
+			}
+			q.Rate = rate
+		}
+		if yq.BucketSize > 0 {
+			q.BucketSize = yq.BucketSize
+		}
+		q.MaxConcurrent = yq.MaxConcurrentRequests
+		rp := yq.RetryParameters
+		if rp.TaskRetryLimit != nil {
+			q.RetryLimit = *rp.TaskRetryLimit
+		}
+		if rp.MinBackoffSeconds != nil {
+			q.MinBackoff = time.Duration(*rp.MinBackoffSeconds * float64(time.Second))
+		}
+		if rp.MaxBackoffSeconds != nil {
+			q.MaxBackoff = time.Duration(*rp.MaxBackoffSeconds * float64(time.Second))
+		}
+		if rp.MaxDoublings != nil {
+			q.MaxDoublings = *rp.MaxDoublings
+		}
+		queues = append(queues, q)
+	}
+	return queues, nil
+}
+
+// parseRate parses a queue.yaml rate, such as 10/s, 5/m or 1/d, to tasks
+// per second.
+func parseRate(s string) (float64, error) {
+	i := strings.Index(s, "/")
+	if i < 0 {
+		return 0, fmt.Errorf("bad rate: %q", s)
+	}
+	n, err := strconv.ParseFloat(s[:i], 64)
+	if err != nil {
+		return 0, fmt.Errorf("bad rate: %q", s)
+	}
+	switch s[i+1:] {
+	case "s":
+		return n, nil
+	case "m":
+		return n / 60, nil
+	case "h":
+		return n / 3600, nil
+	case "d":
+		return n / 86400, nil
+	}
+	return 0, fmt.Errorf("bad rate unit: %q", s)
+}
+
+// backoff returns how long a task waits before its retry'th retry.
+func (q *Queue) backoff(retry int) time.Duration {
+	d := q.MinBackoff
+	for i := 1; i < retry && i <= q.MaxDoublings && d < q.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > q.MaxBackoff {
+		d = q.MaxBackoff
+	}
+	return d
+}
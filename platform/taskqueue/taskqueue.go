@@ -0,0 +1,67 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package taskqueue adds tasks to push queues, which are App Engine's
+// unless Default is replaced, as the standalone server does with a Pool.
+package taskqueue
+
+import (
+	"context"
+	"net/url"
+
+	"google.golang.org/appengine/taskqueue"
+)
+
+type Task = taskqueue.Task
+
+var ErrTaskAlreadyAdded = taskqueue.ErrTaskAlreadyAdded
+
+// NewPOSTTask returns a task that posts params to path.
+func NewPOSTTask(path string, params url.Values) *Task {
+	return taskqueue.NewPOSTTask(path, params)
+}
+
+// Service adds tasks to named queues. An empty queue name is the default
+// queue. Adding a task whose name was already used returns
+// ErrTaskAlreadyAdded.
+type Service interface {
+	Add(c context.Context, t *Task, queueName string) (*Task, error)
+	// AddMulti returns errors of individual tasks as an
+	// appengine.MultiError.
+	AddMulti(c context.Context, tasks []*Task, queueName string) ([]*Task, error)
+}
+
+// Default is the Service used by Add and AddMulti.
+var Default Service = appEngine{}
+
+func Add(c context.Context, t *Task, queueName string) (*Task, error) {
+	return Default.Add(c, t, queueName)
+}
+
+func AddMulti(c context.Context, tasks []*Task, queueName string) ([]*Task, error) {
+	return Default.AddMulti(c, tasks, queueName)
+}
+
+// appEngine adds tasks to App Engine push queues.
+type appEngine struct{}
+
+func (appEngine) Add(c context.Context, t *Task, queueName string) (*Task, error) {
+	return taskqueue.Add(c, t, queueName)
+}
+
+func (appEngine) AddMulti(c context.Context, tasks []*Task, queueName string) ([]*Task, error) {
+	return taskqueue.AddMulti(c, tasks, queueName)
+}
@@ -0,0 +1,48 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package urlfetch makes outgoing HTTP requests through App Engine URL
+// Fetch, or directly when standalone.
+package urlfetch
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/msde/goread/platform"
+
+	"google.golang.org/appengine/urlfetch"
+)
+
+// Transport is an http.RoundTripper for requests made on behalf of
+// Context.
+type Transport struct {
+	Context context.Context
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if !platform.Standalone {
+		return (&urlfetch.Transport{Context: t.Context}).RoundTrip(req)
+	}
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+// Client returns an http.Client using a Transport for c.
+func Client(c context.Context) *http.Client {
+	return &http.Client{
+		Transport: &Transport{Context: c},
+	}
+}
@@ -0,0 +1,64 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+// Package user identifies the signed in user. When standalone, the server
+// authenticates requests itself and stores the user with NewContext.
+package user
+
+import (
+	"context"
+
+	"github.com/msde/goread/platform"
+
+	"google.golang.org/appengine/user"
+)
+
+type User = user.User
+
+type userKey struct{}
+
+// NewContext returns a context whose Current user is u.
+func NewContext(c context.Context, u *User) context.Context {
+	return context.WithValue(c, userKey{}, u)
+}
+
+// Current returns the signed in user, or nil if there is none.
+func Current(c context.Context) *User {
+	if !platform.Standalone {
+		return user.Current(c)
+	}
+	u, _ := c.Value(userKey{}).(*User)
+	return u
+}
+
+// IsAdmin reports whether the signed in user is an administrator.
+func IsAdmin(c context.Context) bool {
+	if !platform.Standalone {
+		return user.IsAdmin(c)
+	}
+	u := Current(c)
+	return u != nil && u.Admin
+}
+
+// LogoutURL returns a URL that signs the user out and goes to dest. The
+// standalone server leaves signing out to whatever authenticates users, so
+// it is dest itself.
+func LogoutURL(c context.Context, dest string) (string, error) {
+	if !platform.Standalone {
+		return user.LogoutURL(c, dest)
+	}
+	return dest, nil
+}
@@ -0,0 +1,109 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/user"
+)
+
+// SetPlayback saves the playback position of a story's enclosure. Position
+// and duration are in seconds. If completed (or the position reached the
+// duration) and markread is set, the story is also marked read.
+func SetPlayback(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	cu := user.Current(c)
+	feed := r.FormValue("feed")
+	story := r.FormValue("story")
+	if len(feed) == 0 || len(story) == 0 {
+		return
+	}
+	position, _ := strconv.ParseFloat(r.FormValue("position"), 64)
+	duration, _ := strconv.ParseFloat(r.FormValue("duration"), 64)
+	if position < 0 {
+		position = 0
+	}
+	if duration < 0 {
+		duration = 0
+	}
+	if duration > 0 && position > duration {
+		position = duration
+	}
+	completed := r.FormValue("completed") != "" || (duration > 0 && position >= duration)
+	markread := r.FormValue("markread") != ""
+
+	p := &UserPlayback{
+		Feed:      feed,
+		Story:     story,
+		Position:  position,
+		Duration:  duration,
+		Completed: completed,
+		Updated:   time.Now(),
+	}
+	var reads []*UserRead
+	var err error
+	if completed && markread {
+		reads, err = storyReads(c, []readStory{{Feed: feed, Story: story}})
+	}
+	if err == nil {
+		err = Store.RunInTransaction(c, func(c context.Context) error {
+			if err := Store.PutPlayback(c, cu.ID, p); err != nil {
+				return err
+			}
+			return Store.PutReads(c, cu.ID, reads)
+		})
+	}
+	if err != nil {
+		log.Errorf(c, "playback put err: %v", err)
+		serveError(w, err)
+		return
+	}
+	b, _ := json.Marshal(p)
+	w.Write(b)
+}
+
+// GetPlayback returns the playback state of one story if feed and story
+// are given, otherwise the most recently updated states.
+func GetPlayback(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	cu := user.Current(c)
+	feed := r.FormValue("feed")
+	story := r.FormValue("story")
+	var playback []*UserPlayback
+	if len(feed) > 0 && len(story) > 0 {
+		if p, err := Store.GetPlayback(c, cu.ID, feed, story); err == nil {
+			playback = append(playback, p)
+		} else if err != ErrNotFound {
+			serveError(w, err)
+			return
+		}
+	} else {
+		var err error
+		if playback, err = Store.Playbacks(c, cu.ID, time.Time{}, numStoriesLimit); err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+	b, _ := json.Marshal(playback)
+	w.Write(b)
+}
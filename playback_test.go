@@ -0,0 +1,54 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"net/url"
+	"testing"
+)
+
+func TestSetPlaybackMarksRead(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := threeStories()
+		defer s.Close()
+		subscribe(t, s)
+		serve(t, SetPlayback, testUser, "/user/set-playback", url.Values{
+			"feed":     {s.feedUrl()},
+			"story":    {"1"},
+			"position": {"30"},
+			"duration": {"30"},
+			"markread": {"1"},
+		})
+		serve(t, SetPlayback, testUser, "/user/set-playback", url.Values{
+			"feed":      {s.feedUrl()},
+			"story":     {"missing"},
+			"completed": {"1"},
+			"markread":  {"1"},
+		})
+
+		if ids := feedReads(t, testUser, s.feedUrl()); !equalIds(ids, "1") {
+			t.Errorf("reads: %v", ids)
+		}
+		c := context.Background()
+		for _, story := range []string{"1", "missing"} {
+			if p, err := Store.GetPlayback(c, testUser, s.feedUrl(), story); err != nil || !p.Completed {
+				t.Errorf("%v: %+v %v", story, p, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,108 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"strconv"
+	"strings"
+)
+
+// addEnclosure appends an enclosure to st unless its URL is already
+// there. The first audio enclosure is also kept in MediaContent.
+func addEnclosure(st *Story, url, typ string, length int64) {
+	url = strings.TrimSpace(url)
+	if url == "" {
+		return
+	}
+	for _, e := range st.Enclosures {
+		if e.Url == url {
+			return
+		}
+	}
+	if length < 0 {
+		length = 0
+	}
+	st.Enclosures = append(st.Enclosures, Enclosure{
+		Url:    url,
+		Type:   strings.TrimSpace(typ),
+		Length: length,
+	})
+	if st.MediaContent == "" && strings.HasPrefix(typ, "audio/") {
+		st.MediaContent = url
+	}
+}
+
+func parseLength(v string) int64 {
+	n, _ := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	return n
+}
+
+// parseItunesDuration returns the seconds in an itunes:duration, which is
+// either a number of seconds or [[HH:]MM:]SS.
+func parseItunesDuration(v string) int64 {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	var secs float64
+	for _, p := range strings.Split(v, ":") {
+		n, err := strconv.ParseFloat(p, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		secs = secs*60 + n
+	}
+	return int64(secs)
+}
+
+func parseExplicit(v string) bool {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "yes", "true", "explicit":
+		return true
+	}
+	return false
+}
+
+func parseEpisodeNumber(v string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(v))
+	if n < 0 {
+		return 0
+	}
+	return n
+}
+
+// setPodcast fills the iTunes and Podcasting 2.0 fields shared by RSS and
+// Atom entries.
+func setPodcast(st *Story, duration, image, episode, season, explicit, chapters string) {
+	st.Duration = parseItunesDuration(duration)
+	st.Image = strings.TrimSpace(image)
+	st.Episode = parseEpisodeNumber(episode)
+	st.Season = parseEpisodeNumber(season)
+	st.Explicit = parseExplicit(explicit)
+	st.Chapters = strings.TrimSpace(chapters)
+}
+
+func addTranscript(st *Story, url, typ, lang string) {
+	if url = strings.TrimSpace(url); url == "" {
+		return
+	}
+	st.Transcripts = append(st.Transcripts, Transcript{
+		Url:      url,
+		Type:     strings.TrimSpace(typ),
+		Language: strings.TrimSpace(lang),
+	})
+}
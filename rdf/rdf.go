@@ -31,16 +31,19 @@ type Channel struct {
 	Description string `xml:"description"`
 	Link        string `xml:"link"`
 	Date        string `xml:"date"`
+	Language    string `xml:"language"`
 }
 
 type Item struct {
-	About       string `xml:"about,attr"`
-	Format      string `xml:"format"`
-	Date        string `xml:"date"`
-	Source      string `xml:"source"`
-	Creator     string `xml:"creator"`
-	Title       string `xml:"title"`
-	Link        string `xml:"link"`
-	Description string `xml:"description"`
-	Content     string `xml:"encoded"`
+	About       string   `xml:"about,attr"`
+	Format      string   `xml:"format"`
+	Date        string   `xml:"date"`
+	Source      string   `xml:"source"`
+	Creators    []string `xml:"creator"`
+	Title       string   `xml:"title"`
+	Link        string   `xml:"link"`
+	Description string   `xml:"description"`
+	Content     string   `xml:"encoded"`
+	Subjects    []string `xml:"subject"`
+	Language    string   `xml:"language"`
 }
@@ -0,0 +1,416 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/gob"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/memcache"
+	"github.com/msde/goread/platform/taskqueue"
+	"github.com/msde/goread/platform/user"
+
+	"google.golang.org/appengine"
+)
+
+// markRead marks stories read for the user uid. Stories that don't exist
+// are skipped.
+func markRead(c context.Context, uid string, stories []readStory) error {
+	reads, err := storyReads(c, stories)
+	if err != nil {
+		return err
+	}
+	return Store.PutReads(c, uid, reads)
+}
+
+// storyReads returns the UserReads that mark stories read. Stories live in
+// their feed's entity group, so this is called outside of transactions on
+// the user's.
+func storyReads(c context.Context, stories []readStory) ([]*UserRead, error) {
+	ss, err := Store.GetStories(c, stories)
+	if err != nil {
+		return nil, err
+	}
+	reads := make([]*UserRead, 0, len(ss))
+	for i, s := range ss {
+		if s == nil {
+			continue
+		}
+		reads = append(reads, &UserRead{
+			Feed:    stories[i].Feed,
+			Story:   stories[i].Story,
+			Created: s.Created,
+		})
+	}
+	return reads, nil
+}
+
+// migrateRead moves the gob-encoded read state blob of the user uid to
+// UserRead entities, and clears it unless it changed meanwhile.
+func migrateRead(c context.Context, uid string, blob []byte) error {
+	read := make(Read)
+	gob.NewDecoder(bytes.NewReader(blob)).Decode(&read)
+	stories := make([]readStory, 0, len(read))
+	for rs := range read {
+		stories = append(stories, rs)
+	}
+	if err := markRead(c, uid, stories); err != nil {
+		return err
+	}
+	return Store.RunInTransaction(c, func(c context.Context) error {
+		ud, err := Store.GetUserData(c, uid)
+		if err != nil || !bytes.Equal(ud.Read, blob) {
+			return err
+		}
+		ud.Read = nil
+		return Store.PutUserData(c, uid, ud)
+	})
+}
+
+// Number of users whose read state is migrated per migrate-read task.
+const migrateReadBatch = 100
+
+// MigrateRead migrates the read state of all users. ListFeeds migrates it
+// too, so this only spares users the wait.
+func MigrateRead(w http.ResponseWriter, r *http.Request) {
+	c := appengine.NewContext(r)
+	uids, cur, err := Store.UserIds(c, Page{Cursor: r.FormValue("c"), Limit: migrateReadBatch})
+	if err != nil {
+		log.Errorf(c, "migrate read next error: %v", err)
+		serveError(w, err)
+		return
+	}
+	n := 0
+	for _, uid := range uids {
+		ud, err := Store.GetUserData(c, uid)
+		if err != nil && err != ErrNotFound {
+			log.Errorf(c, "migrate read %v: %v", uid, err)
+			serveError(w, err)
+			return
+		} else if ud.Read == nil {
+			continue
+		}
+		if err := migrateRead(c, uid, ud.Read); err != nil {
+			log.Errorf(c, "migrate read %v: %v", uid, err)
+			serveError(w, err)
+			return
+		}
+		n++
+	}
+	log.Infof(c, "migrated read state of %v of %v users", n, len(uids))
+	if len(uids) == migrateReadBatch {
+		t := taskqueue.NewPOSTTask(routeUrl("migrate-read"), url.Values{
+			"c": {cur},
+		})
+		if _, err := taskqueue.Add(c, t, ""); err != nil {
+			log.Errorf(c, "taskqueue error: %v", err.Error())
+			serveError(w, err)
+		}
+	}
+}
+
+// UnreadCounts returns the number of unread stories of each feed the user
+// is subscribed to. Unlike ListFeeds, it isn't limited to the newest
+// stories.
+func UnreadCounts(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	cu := user.Current(c)
+	u, err := Store.GetUser(c, cu.ID)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	ud, err := Store.GetUserData(c, cu.ID)
+	if err != nil && err != ErrNotFound {
+		serveError(w, err)
+		return
+	}
+	var uf Opml
+	json.Unmarshal(ud.Opml, &uf)
+	counts := make(map[string]int)
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	sem := make(chan bool, 20)
+	for feed := range uf.feedUrls() {
+		wg.Add(1)
+		sem <- true
+		go func(feed string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			n, err := Store.CountStories(c, feed, u.Read)
+			if err != nil {
+				log.Errorf(c, "count %v: %v", feed, err)
+				return
+			}
+			if n > 0 {
+				reads, err := Store.FeedReads(c, cu.ID, feed, u.Read)
+				if err != nil {
+					log.Errorf(c, "reads %v: %v", feed, err)
+					return
+				}
+				if n -= len(reads); n < 0 {
+					n = 0
+				}
+			}
+			lock.Lock()
+			counts[feed] = n
+			lock.Unlock()
+		}(feed)
+	}
+	wg.Wait()
+	b, _ := json.Marshal(counts)
+	w.Write(b)
+}
+
+// Time a mark-all-read can be undone in.
+const markAllUndoExpiration = time.Minute * 10
+
+// markAllUndo is what a mark-all-read changed. It is stored before
+// anything is marked, so it is kept small: marked stories are found by
+// their UserRead's Undo token instead of being listed.
+type markAllUndo struct {
+	// Read and PrevRead are User.Read after and before, if it moved.
+	Read, PrevRead time.Time
+	// Stories of Feeds created at or after Since were marked read.
+	Feeds []string
+	Since time.Time
+}
+
+func markAllUndoKey(uid, token string) string {
+	return fmt.Sprintf("mark-all-undo-%v-%v", uid, token)
+}
+
+// MarkAllRead marks the stories of the feed with URL feed, of the feeds in
+// the folder titled folder, or else of all feeds read. With before, a unix
+// time, only stories created before it are. The response has a token that
+// UndoMarkAllRead takes for markAllUndoExpiration.
+func MarkAllRead(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	cu := user.Current(c)
+	feed := r.FormValue("feed")
+	folder := r.FormValue("folder")
+	var before time.Time
+	if v := r.FormValue("before"); v != "" {
+		sec, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "bad before: "+v, http.StatusBadRequest)
+			return
+		}
+		before = time.Unix(sec, 0)
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	token := hex.EncodeToString(b)
+	// The undo is saved before anything is marked, so a failure to save it
+	// leaves nothing to undo.
+	saveUndo := func(undo *markAllUndo) error {
+		v, _ := json.Marshal(undo)
+		return memcache.Set(c, &memcache.Item{
+			Key:        markAllUndoKey(cu.ID, token),
+			Value:      v,
+			Expiration: markAllUndoExpiration,
+		})
+	}
+	var u *User
+	var err error
+	marked := 0
+	if feed == "" && folder == "" {
+		// Everything before User.Read is read, so moving it is enough.
+		if before.IsZero() {
+			before = time.Now()
+		}
+		err = Store.RunInTransaction(c, func(c context.Context) error {
+			if u, err = Store.GetUser(c, cu.ID); err != nil || !u.Read.Before(before) {
+				token = ""
+				return err
+			}
+			if err := saveUndo(&markAllUndo{Read: before, PrevRead: u.Read}); err != nil {
+				return err
+			}
+			u.Read = before
+			return Store.PutUser(c, u)
+		})
+	} else {
+		var feeds []string
+		if feeds, err = scopeFeeds(c, cu.ID, feed, folder); err != nil {
+			serveError(w, err)
+			return
+		} else if len(feeds) == 0 {
+			http.Error(w, "no such feed or folder", http.StatusNotFound)
+			return
+		}
+		if u, err = Store.GetUser(c, cu.ID); err == nil {
+			if err = saveUndo(&markAllUndo{Feeds: feeds, Since: u.Read}); err == nil {
+				marked, err = markAllFeeds(c, u, feeds, before, token)
+			}
+		}
+		if err == nil && marked == 0 {
+			memcache.Delete(c, markAllUndoKey(cu.ID, token))
+			token = ""
+		}
+	}
+	if err != nil {
+		log.Errorf(c, "mark all read: %v", err)
+		serveError(w, err)
+		return
+	}
+	b, _ = json.Marshal(struct {
+		Undo       string `json:",omitempty"`
+		UnreadDate time.Time
+		Marked     int
+	}{
+		Undo:       token,
+		UnreadDate: u.Read,
+		Marked:     marked,
+	})
+	w.Write(b)
+}
+
+// scopeFeeds returns the feed if the user uid is subscribed to it, or else
+// the feeds in folder.
+func scopeFeeds(c context.Context, uid, feed, folder string) ([]string, error) {
+	ud, err := Store.GetUserData(c, uid)
+	if err != nil && err != ErrNotFound {
+		return nil, err
+	}
+	var uf Opml
+	json.Unmarshal(ud.Opml, &uf)
+	if feed == "" {
+		return uf.folderUrls(folder), nil
+	} else if uf.feedUrls()[feed] {
+		return []string{feed}, nil
+	}
+	return nil, nil
+}
+
+// markAllFeeds marks the unread stories of feeds read with the undo token,
+// only those created before before if it is set. It returns how many it
+// marked.
+func markAllFeeds(c context.Context, u *User, feeds []string, before time.Time, undo string) (int, error) {
+	marked := 0
+	for _, f := range feeds {
+		reads, err := Store.FeedReads(c, u.Id, f, u.Read)
+		if err != nil {
+			return 0, err
+		}
+		read := make(map[string]bool, len(reads))
+		for _, r := range reads {
+			read[r.Story] = true
+		}
+		q := StoryQuery{Page: Page{Limit: 250}, Since: u.Read}
+		for {
+			stories, cur, err := Store.FeedStories(c, f, q)
+			if err != nil {
+				return 0, err
+			}
+			var nreads []*UserRead
+			for _, s := range stories {
+				if read[s.Id] || (!before.IsZero() && !s.Created.Before(before)) {
+					continue
+				}
+				nreads = append(nreads, &UserRead{Feed: f, Story: s.Id, Created: s.Created, Undo: undo})
+			}
+			if err := Store.PutReads(c, u.Id, nreads); err != nil {
+				return 0, err
+			}
+			marked += len(nreads)
+			if len(stories) < q.Limit {
+				break
+			}
+			q.Cursor = cur
+		}
+	}
+	return marked, nil
+}
+
+// UndoMarkAllRead reverts the MarkAllRead whose response had the token
+// undo. It fails if the token expired or was used, or if User.Read moved
+// since.
+func UndoMarkAllRead(w http.ResponseWriter, r *http.Request) {
+	c := r.Context()
+	cu := user.Current(c)
+	token := r.FormValue("undo")
+	key := markAllUndoKey(cu.ID, token)
+	item, err := memcache.Get(c, key)
+	if err == nil {
+		// Only the request that deletes the token may undo.
+		err = memcache.Delete(c, key)
+	}
+	if err == memcache.ErrCacheMiss {
+		http.Error(w, "undo expired", http.StatusGone)
+		return
+	} else if err != nil {
+		serveError(w, err)
+		return
+	}
+	var undo markAllUndo
+	if err := json.Unmarshal(item.Value, &undo); err != nil {
+		serveError(w, err)
+		return
+	}
+	if !undo.Read.IsZero() {
+		moved := false
+		err := Store.RunInTransaction(c, func(c context.Context) error {
+			u, err := Store.GetUser(c, cu.ID)
+			if err != nil {
+				return err
+			}
+			if moved = !u.Read.Equal(undo.Read); moved {
+				return nil
+			}
+			u.Read = undo.PrevRead
+			return Store.PutUser(c, u)
+		})
+		if err != nil {
+			serveError(w, err)
+			return
+		} else if moved {
+			http.Error(w, "read state changed since", http.StatusConflict)
+			return
+		}
+	}
+	for _, f := range undo.Feeds {
+		reads, err := Store.FeedReads(c, cu.ID, f, undo.Since)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		var stories []readStory
+		for _, r := range reads {
+			if r.Undo == token {
+				stories = append(stories, readStory{Feed: f, Story: r.Story})
+			}
+		}
+		if err := Store.DeleteReads(c, cu.ID, stories); err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,411 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// readBlob returns the legacy read state blob of stories.
+func readBlob(stories ...readStory) []byte {
+	read := make(Read)
+	for _, rs := range stories {
+		read[rs] = true
+	}
+	var b bytes.Buffer
+	gob.NewEncoder(&b).Encode(&read)
+	return b.Bytes()
+}
+
+// putReadBlob stores blob as the legacy read state of the user uid.
+func putReadBlob(t *testing.T, uid string, blob []byte) {
+	t.Helper()
+	c := context.Background()
+	ud, err := Store.GetUserData(c, uid)
+	if err != nil && err != ErrNotFound {
+		t.Fatal(err)
+	}
+	ud.Read = blob
+	if err := Store.PutUserData(c, uid, ud); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// feedReads returns the ids of the stories of feed the user uid has
+// UserRead entities for.
+func feedReads(t *testing.T, uid, feed string) []string {
+	t.Helper()
+	reads, err := Store.FeedReads(context.Background(), uid, feed, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	for _, r := range reads {
+		ids = append(ids, r.Story)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// threeStories returns a feed server of stories 1 to 3, an hour apart and
+// newer than the unread date of new users.
+func threeStories() *feedServer {
+	now := time.Now()
+	return newFeedServer(
+		testItem{"1", now.Add(-time.Hour * 3)},
+		testItem{"2", now.Add(-time.Hour * 2)},
+		testItem{"3", now.Add(-time.Hour)},
+	)
+}
+
+func TestListFeedsMigratesRead(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := threeStories()
+		defer s.Close()
+		subscribe(t, s)
+		putReadBlob(t, testUser, readBlob(
+			readStory{Feed: s.feedUrl(), Story: "1"},
+			readStory{Feed: s.feedUrl(), Story: "missing"},
+		))
+
+		if ids := listFeeds(t, s); !equalIds(ids, "2", "3") {
+			t.Errorf("unread: %v", ids)
+		}
+		if ids := feedReads(t, testUser, s.feedUrl()); !equalIds(ids, "1") {
+			t.Errorf("reads: %v", ids)
+		}
+		if ud, _ := Store.GetUserData(context.Background(), testUser); ud.Read != nil {
+			t.Error("blob not cleared")
+		}
+	})
+}
+
+func TestMigrateReadChanged(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := threeStories()
+		defer s.Close()
+		subscribe(t, s)
+		blob := readBlob(readStory{Feed: s.feedUrl(), Story: "1"})
+		changed := readBlob(readStory{Feed: s.feedUrl(), Story: "2"})
+		putReadBlob(t, testUser, changed)
+
+		// A blob that changed since it was read is kept for the next run.
+		if err := migrateRead(context.Background(), testUser, blob); err != nil {
+			t.Fatal(err)
+		}
+		if ids := feedReads(t, testUser, s.feedUrl()); !equalIds(ids, "1") {
+			t.Errorf("reads: %v", ids)
+		}
+		if ud, _ := Store.GetUserData(context.Background(), testUser); !bytes.Equal(ud.Read, changed) {
+			t.Error("changed blob cleared")
+		}
+	})
+}
+
+func TestMigrateRead(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := threeStories()
+		defer s.Close()
+		c := context.Background()
+		subscribe(t, s)
+		// More users than a task migrates, with the last ones holding blobs.
+		var uids []string
+		for i := 0; i <= migrateReadBatch; i++ {
+			uid := fmt.Sprintf("a%03d", i)
+			uids = append(uids, uid)
+			if err := Store.PutUser(c, &User{Id: uid}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		uids = append(uids, testUser)
+		last := uids[len(uids)-2:]
+		for _, uid := range last {
+			putReadBlob(t, uid, readBlob(readStory{Feed: s.feedUrl(), Story: "2"}))
+		}
+
+		serve(t, MigrateRead, "", "/tasks/migrate-read", url.Values{})
+		if n := tasks.count("/tasks/migrate-read"); n != 1 {
+			t.Fatalf("%v next tasks", n)
+		}
+		next, _ := url.ParseQuery(string(tasks.tasks[len(tasks.tasks)-1].Payload))
+		for _, uid := range last {
+			if ids := feedReads(t, uid, s.feedUrl()); len(ids) != 0 {
+				t.Errorf("%v migrated by the first task: %v", uid, ids)
+			}
+		}
+
+		serve(t, MigrateRead, "", "/tasks/migrate-read", next)
+		if n := tasks.count("/tasks/migrate-read"); n != 1 {
+			t.Errorf("%v next tasks after the last batch", n)
+		}
+		for _, uid := range last {
+			if ids := feedReads(t, uid, s.feedUrl()); !equalIds(ids, "2") {
+				t.Errorf("%v reads: %v", uid, ids)
+			}
+			if ud, _ := Store.GetUserData(c, uid); ud.Read != nil {
+				t.Errorf("%v blob not cleared", uid)
+			}
+		}
+	})
+}
+
+func TestListFeedsPrunesRead(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := threeStories()
+		defer s.Close()
+		c := context.Background()
+		subscribe(t, s)
+		serveJSON(t, MarkRead, testUser, "/user/mark-read", []readStory{
+			{Feed: s.feedUrl(), Story: "1"},
+			{Feed: s.feedUrl(), Story: "2"},
+			{Feed: s.feedUrl(), Story: "3"},
+		})
+		before, _ := Store.GetUser(c, testUser)
+
+		// With nothing unread, the unread date moves past all stories,
+		// which makes their UserReads redundant.
+		if ids := listFeeds(t, s); len(ids) != 0 {
+			t.Errorf("unread: %v", ids)
+		}
+		u, _ := Store.GetUser(c, testUser)
+		if !u.Read.After(before.Read) {
+			t.Errorf("unread date didn't move: %v", u.Read)
+		}
+		if ids := feedReads(t, testUser, s.feedUrl()); len(ids) != 0 {
+			t.Errorf("reads not pruned: %v", ids)
+		}
+		if ids := listFeeds(t, s); len(ids) != 0 {
+			t.Errorf("unread after pruning: %v", ids)
+		}
+	})
+}
+
+func TestGetFeedUnread(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := threeStories()
+		defer s.Close()
+		c := context.Background()
+		subscribe(t, s)
+		serveJSON(t, MarkRead, testUser, "/user/mark-read", []readStory{{Feed: s.feedUrl(), Story: "2"}})
+		getFeed := func() []string {
+			var gf struct {
+				Stories []*Story
+				Unread  []string
+			}
+			decode(t, serve(t, GetFeed, testUser, "/user/get-feed?"+url.Values{"f": {s.feedUrl()}}.Encode(), nil), &gf)
+			if len(gf.Stories) != 3 {
+				t.Errorf("%v stories", len(gf.Stories))
+			}
+			return gf.Unread
+		}
+		if ids := getFeed(); fmt.Sprint(ids) != "[3 1]" {
+			t.Errorf("unread: %v", ids)
+		}
+
+		// Stories before the unread date are read.
+		ss, _ := Store.GetStories(c, []readStory{{Feed: s.feedUrl(), Story: "1"}})
+		u, _ := Store.GetUser(c, testUser)
+		u.Read = ss[0].Created.Add(time.Second)
+		Store.PutUser(c, u)
+		if ids := getFeed(); fmt.Sprint(ids) != "[3]" {
+			t.Errorf("unread after moving the unread date: %v", ids)
+		}
+	})
+}
+
+func TestUnreadCounts(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := threeStories()
+		defer s.Close()
+		c := context.Background()
+		subscribe(t, s)
+		serveJSON(t, MarkRead, testUser, "/user/mark-read", []readStory{{Feed: s.feedUrl(), Story: "1"}})
+		counts := func() int {
+			var uc map[string]int
+			decode(t, serve(t, UnreadCounts, testUser, "/user/unread-counts", nil), &uc)
+			if len(uc) != 1 {
+				t.Errorf("counts: %v", uc)
+			}
+			return uc[s.feedUrl()]
+		}
+		if n := counts(); n != 2 {
+			t.Errorf("count: %v", n)
+		}
+
+		ss, _ := Store.GetStories(c, []readStory{{Feed: s.feedUrl(), Story: "2"}})
+		u, _ := Store.GetUser(c, testUser)
+		u.Read = ss[0].Created.Add(time.Second)
+		Store.PutUser(c, u)
+		if n := counts(); n != 1 {
+			t.Errorf("count after moving the unread date: %v", n)
+		}
+	})
+}
+
+type markAllResult struct {
+	Undo       string
+	UnreadDate time.Time
+	Marked     int
+}
+
+// markAll marks stories read with MarkAllRead.
+func markAll(t *testing.T, form url.Values) markAllResult {
+	t.Helper()
+	var res markAllResult
+	decode(t, serve(t, MarkAllRead, testUser, "/user/mark-all-read", form), &res)
+	return res
+}
+
+// undoStatus returns the status of undoing with token.
+func undoStatus(token string) int {
+	return serveStatus(UndoMarkAllRead, testUser, "/user/undo-mark-all-read", url.Values{"undo": {token}}).Code
+}
+
+func TestMarkAllReadFeed(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		a, b := threeStories(), threeStories()
+		defer a.Close()
+		defer b.Close()
+		subscribe(t, a)
+		subscribe(t, b)
+		serveJSON(t, MarkRead, testUser, "/user/mark-read", []readStory{{Feed: a.feedUrl(), Story: "1"}})
+		ss, _ := Store.GetStories(context.Background(), []readStory{{Feed: a.feedUrl(), Story: "3"}})
+		before := strconv.FormatInt(ss[0].Created.Unix(), 10)
+
+		res := markAll(t, url.Values{"feed": {a.feedUrl()}, "before": {before}})
+		if res.Marked != 1 || res.Undo == "" {
+			t.Fatalf("result: %+v", res)
+		}
+		if ids := listFeeds(t, a); !equalIds(ids, "3") {
+			t.Errorf("unread: %v", ids)
+		}
+		if ids := listFeeds(t, b); !equalIds(ids, "1", "2", "3") {
+			t.Errorf("unread in other feed: %v", ids)
+		}
+
+		// Undo only unmarks what the mark-all-read marked, and only once.
+		if code := undoStatus(res.Undo); code != http.StatusOK {
+			t.Fatalf("undo: %v", code)
+		}
+		if ids := listFeeds(t, a); !equalIds(ids, "2", "3") {
+			t.Errorf("unread after undo: %v", ids)
+		}
+		if code := undoStatus(res.Undo); code != http.StatusGone {
+			t.Errorf("second undo: %v", code)
+		}
+		if code := undoStatus("unknown"); code != http.StatusGone {
+			t.Errorf("unknown undo: %v", code)
+		}
+
+		if res := markAll(t, url.Values{"feed": {a.feedUrl()}, "before": {"0"}}); res.Marked != 0 || res.Undo != "" {
+			t.Errorf("nothing marked: %+v", res)
+		}
+		for _, form := range []url.Values{
+			{"feed": {"http://example.com/unsubscribed"}},
+			{"folder": {"none"}},
+		} {
+			if code := serveStatus(MarkAllRead, testUser, "/user/mark-all-read", form).Code; code != http.StatusNotFound {
+				t.Errorf("%v: %v", form, code)
+			}
+		}
+		if code := serveStatus(MarkAllRead, testUser, "/user/mark-all-read", url.Values{"before": {"soon"}}).Code; code != http.StatusBadRequest {
+			t.Errorf("bad before: %v", code)
+		}
+	})
+}
+
+func TestMarkAllReadFolder(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		a, b := threeStories(), threeStories()
+		defer a.Close()
+		defer b.Close()
+		subscribe(t, a)
+		subscribe(t, b)
+		c := context.Background()
+		ud, _ := Store.GetUserData(c, testUser)
+		ud.Opml, _ = json.Marshal(&Opml{Outline: []*OpmlOutline{
+			{Title: "folder", Outline: []*OpmlOutline{{XmlUrl: a.feedUrl()}}},
+			{XmlUrl: b.feedUrl()},
+		}})
+		Store.PutUserData(c, testUser, ud)
+
+		res := markAll(t, url.Values{"folder": {"folder"}})
+		if res.Marked != 3 {
+			t.Errorf("marked %v", res.Marked)
+		}
+		if ids := listFeeds(t, a); len(ids) != 0 {
+			t.Errorf("unread in folder: %v", ids)
+		}
+		if ids := listFeeds(t, b); !equalIds(ids, "1", "2", "3") {
+			t.Errorf("unread outside folder: %v", ids)
+		}
+		if code := undoStatus(res.Undo); code != http.StatusOK {
+			t.Fatalf("undo: %v", code)
+		}
+		if ids := listFeeds(t, a); !equalIds(ids, "1", "2", "3") {
+			t.Errorf("unread in folder after undo: %v", ids)
+		}
+	})
+}
+
+func TestMarkAllReadEverything(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		a, b := threeStories(), threeStories()
+		defer a.Close()
+		defer b.Close()
+		subscribe(t, a)
+		subscribe(t, b)
+		c := context.Background()
+
+		res := markAll(t, url.Values{})
+		u, _ := Store.GetUser(c, testUser)
+		if res.Undo == "" || !res.UnreadDate.Equal(u.Read) || time.Since(u.Read) > time.Minute {
+			t.Fatalf("result: %+v, unread date %v", res, u.Read)
+		}
+		if ids := append(listFeeds(t, a), listFeeds(t, b)...); len(ids) != 0 {
+			t.Errorf("unread: %v", ids)
+		}
+		if code := undoStatus(res.Undo); code != http.StatusOK {
+			t.Fatalf("undo: %v", code)
+		}
+		if ids := listFeeds(t, b); !equalIds(ids, "1", "2", "3") {
+			t.Errorf("unread after undo: %v", ids)
+		}
+
+		// Undo doesn't move the unread date back if it moved meanwhile.
+		res = markAll(t, url.Values{})
+		u, _ = Store.GetUser(c, testUser)
+		u.Read = u.Read.Add(time.Second)
+		Store.PutUser(c, u)
+		if code := undoStatus(res.Undo); code != http.StatusConflict {
+			t.Errorf("undo after the unread date moved: %v", code)
+		}
+		if u2, _ := Store.GetUser(c, testUser); !u2.Read.Equal(u.Read) {
+			t.Errorf("unread date: %v", u2.Read)
+		}
+	})
+}
@@ -4,6 +4,12 @@
 
 package rss
 
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
 type Rss struct {
 	XMLName       string  `xml:"rss"`
 	Title         string  `xml:"channel>title"`
@@ -12,6 +18,20 @@ type Rss struct {
 	PubDate       string  `xml:"channel>pubDate,omitempty"`
 	LastBuildDate string  `xml:"channel>lastBuildDate,omitempty"`
 	Items         []*Item `xml:"channel>item"`
+
+	// Publisher update hints: RSS 2.0 ttl, skipHours and skipDays, and
+	// the Syndication module (sy:) elements.
+	TTL             string   `xml:"channel>ttl,omitempty"`
+	SkipHours       []string `xml:"channel>skipHours>hour"`
+	SkipDays        []string `xml:"channel>skipDays>day"`
+	UpdatePeriod    string   `xml:"channel>updatePeriod,omitempty"`
+	UpdateFrequency string   `xml:"channel>updateFrequency,omitempty"`
+	UpdateBase      string   `xml:"channel>updateBase,omitempty"`
+
+	ItunesImage *ItunesImage `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd channel>image"`
+
+	// language or dc:language
+	Language string `xml:"channel>language"`
 }
 
 func (r *Rss) Hub() string {
@@ -32,6 +52,83 @@ func (r *Rss) BaseLink() string {
 	return ""
 }
 
+// TTLDuration returns the channel ttl, which is in minutes.
+func (r *Rss) TTLDuration() time.Duration {
+	n, err := strconv.Atoi(strings.TrimSpace(r.TTL))
+	if err != nil || n <= 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Minute
+}
+
+var syPeriods = map[string]time.Duration{
+	"hourly":  time.Hour,
+	"daily":   time.Hour * 24,
+	"weekly":  time.Hour * 24 * 7,
+	"monthly": time.Hour * 24 * 30,
+	"yearly":  time.Hour * 24 * 365,
+}
+
+// SyInterval returns the interval between updates given by sy:updatePeriod
+// and sy:updateFrequency, or 0 if no period is given.
+func (r *Rss) SyInterval() time.Duration {
+	p, ok := syPeriods[strings.ToLower(strings.TrimSpace(r.UpdatePeriod))]
+	if !ok {
+		return 0
+	}
+	freq := 1
+	if n, err := strconv.Atoi(strings.TrimSpace(r.UpdateFrequency)); err == nil && n > 0 {
+		freq = n
+	}
+	return p / time.Duration(freq)
+}
+
+var syBaseLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02",
+}
+
+// SyBase returns sy:updateBase, the time updates are counted from.
+func (r *Rss) SyBase() time.Time {
+	v := strings.TrimSpace(r.UpdateBase)
+	for _, l := range syBaseLayouts {
+		if t, err := time.Parse(l, v); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// SkipHourList returns the GMT hours (0-23) during which the feed should
+// not be read.
+func (r *Rss) SkipHourList() []int {
+	var hours []int
+	for _, h := range r.SkipHours {
+		n, err := strconv.Atoi(strings.TrimSpace(h))
+		if err != nil || n < 0 || n > 24 {
+			continue
+		}
+		// some feeds count hours 1-24
+		hours = append(hours, n%24)
+	}
+	return hours
+}
+
+// SkipDayList returns the days during which the feed should not be read.
+func (r *Rss) SkipDayList() []time.Weekday {
+	var days []time.Weekday
+	for _, d := range r.SkipDays {
+		d = strings.ToLower(strings.TrimSpace(d))
+		for i := time.Sunday; i <= time.Saturday; i++ {
+			if strings.ToLower(i.String()) == d {
+				days = append(days, i)
+			}
+		}
+	}
+	return days
+}
+
 type Link struct {
 	Rel      string `xml:"rel,attr"`
 	Href     string `xml:"href,attr"`
@@ -40,24 +137,83 @@ type Link struct {
 }
 
 type Item struct {
-	Title       string        `xml:"title,omitempty"`
-	Link        string        `xml:"link,omitempty"`
-	Description string        `xml:"description,omitempty"`
-	Author      string        `xml:"author,omitempty"`
-	Enclosure   *Enclosure    `xml:"enclosure"`
-	Guid        *Guid         `xml:"guid"`
-	PubDate     string        `xml:"pubDate,omitempty"`
-	Source      *Source       `xml:"source"`
-	Content     string        `xml:"encoded,omitempty"`
-	Date        string        `xml:"date,omitempty"`
-	Published   string        `xml:"published,omitempty"`
-	Media       *MediaContent `xml:"content"`
+	Title       string          `xml:"title,omitempty"`
+	Link        string          `xml:"link,omitempty"`
+	Description string          `xml:"description,omitempty"`
+	Author      string          `xml:"author,omitempty"`
+	Enclosures  []*Enclosure    `xml:"enclosure"`
+	Guid        *Guid           `xml:"guid"`
+	PubDate     string          `xml:"pubDate,omitempty"`
+	Source      *Source         `xml:"source"`
+	Content     string          `xml:"encoded,omitempty"`
+	Date        string          `xml:"date,omitempty"`
+	Published   string          `xml:"published,omitempty"`
+	Media       []*MediaContent `xml:"content"`
+
+	ItunesDuration string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	ItunesImage    *ItunesImage  `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+	ItunesEpisode  string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	ItunesSeason   string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	ItunesExplicit string        `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+	Chapters       *Chapters     `xml:"https://podcastindex.org/namespace/1.0 chapters"`
+	Transcripts    []*Transcript `xml:"https://podcastindex.org/namespace/1.0 transcript"`
+
+	MediaThumbnails []*MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
+	MediaGroups     []*MediaGroup     `xml:"http://search.yahoo.com/mrss/ group"`
+
+	Categories []*Category `xml:"category"`
+	Subjects   []string    `xml:"http://purl.org/dc/elements/1.1/ subject"`
+
+	// Comments is in DefaultSpace, the namespace the decoder gives
+	// unprefixed elements, so that it doesn't conflict with slash:comments.
+	Comments      string `xml:"DefaultSpace comments"`
+	CommentRss    string `xml:"http://wellformedweb.org/CommentAPI/ commentRss"`
+	SlashComments string `xml:"http://purl.org/rss/1.0/modules/slash/ comments"`
+
+	Creators     []string `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	Language     string   `xml:"http://purl.org/dc/elements/1.1/ language"`
+	Contributors []string `xml:"http://purl.org/dc/elements/1.1/ contributor"`
+}
+
+type Category struct {
+	Domain   string `xml:"domain,attr"`
+	Category string `xml:",chardata"`
+}
+
+type ItunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+// Chapters and Transcript are from the Podcasting 2.0 namespace.
+type Chapters struct {
+	Url  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type Transcript struct {
+	Url      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Language string `xml:"language,attr"`
 }
 
 type MediaContent struct {
 	XMLBase string `xml:"http://search.yahoo.com/mrss/ content"`
 	URL     string `xml:"url,attr"`
 	Type    string `xml:"type,attr"`
+	Medium  string `xml:"medium,attr"`
+	Width   string `xml:"width,attr"`
+	Height  string `xml:"height,attr"`
+}
+
+type MediaThumbnail struct {
+	URL    string `xml:"url,attr"`
+	Width  string `xml:"width,attr"`
+	Height string `xml:"height,attr"`
+}
+
+type MediaGroup struct {
+	Contents   []*MediaContent   `xml:"http://search.yahoo.com/mrss/ content"`
+	Thumbnails []*MediaThumbnail `xml:"http://search.yahoo.com/mrss/ thumbnail"`
 }
 
 type Source struct {
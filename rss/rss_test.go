@@ -18,8 +18,10 @@ package rss
 
 import (
 	"encoding/xml"
+	"reflect"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/msde/go-charset/charset"
 )
@@ -97,3 +99,135 @@ const WP_FEED = `
 </channel>
 </rss>
 `
+
+func TestUpdateHints(t *testing.T) {
+	r := Rss{}
+	d := xml.NewDecoder(strings.NewReader(HINTS_FEED))
+	d.CharsetReader = charset.NewReader
+	d.DefaultSpace = "DefaultSpace"
+	if err := d.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if v := r.TTLDuration(); v != time.Hour {
+		t.Error("bad ttl", v)
+	}
+	if v := r.SyInterval(); v != time.Hour*12 {
+		t.Error("bad sy interval", v)
+	}
+	if v := r.SyBase(); !v.Equal(time.Date(2000, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Error("bad sy base", v)
+	}
+	if v := r.SkipHourList(); !reflect.DeepEqual(v, []int{0, 1, 2}) {
+		t.Error("bad skip hours", v)
+	}
+	if v := r.SkipDayList(); !reflect.DeepEqual(v, []time.Weekday{time.Saturday, time.Sunday}) {
+		t.Error("bad skip days", v)
+	}
+}
+
+const HINTS_FEED = `
+<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:sy="http://purl.org/rss/1.0/modules/syndication/">
+<channel>
+	<title>Daily Digest</title>
+	<link>http://example.com/</link>
+	<ttl>60</ttl>
+	<sy:updatePeriod>daily</sy:updatePeriod>
+	<sy:updateFrequency>2</sy:updateFrequency>
+	<sy:updateBase>2000-01-01T12:00+00:00</sy:updateBase>
+	<skipHours><hour>24</hour><hour>1</hour><hour>2</hour><hour>x</hour></skipHours>
+	<skipDays><day>Saturday</day><day>sunday</day></skipDays>
+</channel>
+</rss>
+`
+
+func TestPodcast(t *testing.T) {
+	r := Rss{}
+	d := xml.NewDecoder(strings.NewReader(PODCAST_FEED))
+	d.CharsetReader = charset.NewReader
+	d.DefaultSpace = "DefaultSpace"
+	if err := d.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	if r.ItunesImage == nil || r.ItunesImage.Href != "http://example.com/show.jpg" {
+		t.Error("bad channel image")
+	}
+	if len(r.Items) != 1 {
+		t.Fatal("bad items", len(r.Items))
+	}
+	i := r.Items[0]
+	if len(i.Enclosures) != 2 || i.Enclosures[1].Type != "audio/ogg" || i.Enclosures[0].Length != "1234" {
+		t.Error("bad enclosures", i.Enclosures)
+	}
+	if i.ItunesDuration != "1:02:03" || i.ItunesEpisode != "7" || i.ItunesSeason != "2" || i.ItunesExplicit != "yes" {
+		t.Error("bad itunes", i.ItunesDuration, i.ItunesEpisode, i.ItunesSeason, i.ItunesExplicit)
+	}
+	if i.ItunesImage == nil || i.ItunesImage.Href != "http://example.com/ep7.jpg" {
+		t.Error("bad image")
+	}
+	if i.Chapters == nil || i.Chapters.Url != "http://example.com/ep7.json" {
+		t.Error("bad chapters")
+	}
+	if len(i.Transcripts) != 1 || i.Transcripts[0].Type != "text/vtt" {
+		t.Error("bad transcripts")
+	}
+}
+
+const PODCAST_FEED = `
+<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:itunes="http://www.itunes.com/dtds/podcast-1.0.dtd" xmlns:podcast="https://podcastindex.org/namespace/1.0">
+<channel>
+	<title>Show</title>
+	<link>http://example.com/</link>
+	<image><url>http://example.com/logo.png</url></image>
+	<itunes:image href="http://example.com/show.jpg"/>
+	<item>
+		<title>Episode 7</title>
+		<enclosure url="http://example.com/ep7.mp3" length="1234" type="audio/mpeg"/>
+		<enclosure url="http://example.com/ep7.ogg" length="1000" type="audio/ogg"/>
+		<itunes:duration>1:02:03</itunes:duration>
+		<itunes:image href="http://example.com/ep7.jpg"/>
+		<itunes:episode>7</itunes:episode>
+		<itunes:season>2</itunes:season>
+		<itunes:explicit>yes</itunes:explicit>
+		<podcast:chapters url="http://example.com/ep7.json" type="application/json+chapters"/>
+		<podcast:transcript url="http://example.com/ep7.vtt" type="text/vtt"/>
+	</item>
+</channel>
+</rss>
+`
+
+func TestComments(t *testing.T) {
+	r := Rss{}
+	d := xml.NewDecoder(strings.NewReader(COMMENTS_FEED))
+	d.CharsetReader = charset.NewReader
+	d.DefaultSpace = "DefaultSpace"
+	if err := d.Decode(&r); err != nil {
+		t.Fatal(err)
+	}
+	i := r.Items[0]
+	if i.Comments != "http://example.com/post#comments" {
+		t.Error("bad comments", i.Comments)
+	}
+	if i.CommentRss != "http://example.com/post/feed" {
+		t.Error("bad comment rss", i.CommentRss)
+	}
+	if i.SlashComments != "12" {
+		t.Error("bad slash comments", i.SlashComments)
+	}
+}
+
+const COMMENTS_FEED = `
+<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:wfw="http://wellformedweb.org/CommentAPI/" xmlns:slash="http://purl.org/rss/1.0/modules/slash/">
+<channel>
+	<title>Blog</title>
+	<item>
+		<title>Post</title>
+		<comments>http://example.com/post#comments</comments>
+		<wfw:commentRss>http://example.com/post/feed</wfw:commentRss>
+		<slash:comments>12</slash:comments>
+	</item>
+</channel>
+</rss>
+`
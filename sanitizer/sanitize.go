@@ -78,11 +78,19 @@ func sanitizeAttributes(u *url.URL, t *html.Token) {
 }
 
 func Sanitize(s string, u *url.URL) (string, string) {
+	h, text, _ := SanitizeImage(s, u)
+	return h, text
+}
+
+// SanitizeImage is Sanitize, but also returns the source of the first
+// image that isn't a tracking pixel.
+func SanitizeImage(s string, u *url.URL) (string, string, string) {
 	r := bytes.NewReader([]byte(strings.TrimSpace(s)))
 	z := html.NewTokenizer(r)
 	buf := &bytes.Buffer{}
 	strip := &bytes.Buffer{}
 	skip := 0
+	img := ""
 	if u != nil {
 		u.RawQuery = ""
 		u.Fragment = ""
@@ -92,7 +100,7 @@ func Sanitize(s string, u *url.URL) (string, string) {
 			if err := z.Err(); err == io.EOF {
 				break
 			} else {
-				return s, s
+				return s, s, ""
 			}
 		}
 
@@ -104,6 +112,9 @@ func Sanitize(s string, u *url.URL) (string, string) {
 				}
 			} else {
 				sanitizeAttributes(u, &t)
+				if t.Data == "img" && img == "" && skip == 0 {
+					img = imageSrc(&t)
+				}
 				buf.WriteString(t.String())
 			}
 		} else if t.Type == html.EndTagToken {
@@ -122,7 +133,22 @@ func Sanitize(s string, u *url.URL) (string, string) {
 		}
 	}
 
-	return buf.String(), strip.String()
+	return buf.String(), strip.String(), img
+}
+
+func imageSrc(t *html.Token) string {
+	var src string
+	for _, a := range t.Attr {
+		switch a.Key {
+		case "src":
+			src = a.Val
+		case "width", "height":
+			if v := strings.TrimSpace(a.Val); v == "0" || v == "1" || v == "1px" {
+				return ""
+			}
+		}
+	}
+	return src
 }
 
 // Based on list from MDN's HTML5 element list
@@ -0,0 +1,947 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/gob"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/appengine"
+	"google.golang.org/appengine/datastore"
+)
+
+// sqlStorage keeps entities in SQLite or PostgreSQL. Each entity is stored
+// as its datastore properties, with the properties that are queried copied
+// to columns.
+type sqlStorage struct {
+	db      *sql.DB
+	dialect sqlDialect
+}
+
+type sqlDialect struct {
+	// blob is the type of binary columns.
+	blob string
+	// numbered is set if placeholders are $1, $2... instead of ?.
+	numbered bool
+	// serializable is set if transactions must ask for serializable
+	// isolation, and may then fail and be retried.
+	serializable bool
+}
+
+var sqlDialects = map[string]sqlDialect{
+	"sqlite3":  {blob: "BLOB"},
+	"postgres": {blob: "BYTEA", numbered: true, serializable: true},
+}
+
+// Number of times a transaction is tried before its error is returned.
+const sqlTxAttempts = 3
+
+// sqlMigrations create and update the schema. They are applied in order,
+// each once, and recorded in schema_migrations. Statements are separated
+// by semicolons, and BLOB is replaced by the dialect's binary type.
+var sqlMigrations = []string{
+	`CREATE TABLE feeds (
+		url TEXT PRIMARY KEY,
+		next_update BIGINT NOT NULL,
+		data BLOB NOT NULL
+	);
+	CREATE INDEX feeds_next_update ON feeds (next_update);
+	CREATE TABLE stories (
+		feed TEXT NOT NULL,
+		id TEXT NOT NULL,
+		created BIGINT NOT NULL,
+		data BLOB NOT NULL,
+		content BLOB,
+		PRIMARY KEY (feed, id)
+	);
+	CREATE INDEX stories_created ON stories (feed, created);
+	CREATE TABLE story_categories (
+		feed TEXT NOT NULL,
+		id TEXT NOT NULL,
+		category TEXT NOT NULL,
+		PRIMARY KEY (feed, id, category)
+	);
+	CREATE INDEX story_categories_category ON story_categories (feed, category);
+	CREATE TABLE story_authors (
+		feed TEXT NOT NULL,
+		id TEXT NOT NULL,
+		author TEXT NOT NULL,
+		PRIMARY KEY (feed, id, author)
+	);
+	CREATE INDEX story_authors_author ON story_authors (author);
+	CREATE TABLE users (
+		id TEXT PRIMARY KEY,
+		email TEXT NOT NULL,
+		data BLOB NOT NULL
+	);
+	CREATE INDEX users_email ON users (email);
+	CREATE TABLE user_data (
+		uid TEXT PRIMARY KEY,
+		data BLOB NOT NULL
+	);
+	CREATE TABLE user_opmls (
+		uid TEXT NOT NULL,
+		id BIGINT NOT NULL,
+		data BLOB NOT NULL,
+		PRIMARY KEY (uid, id)
+	);
+	CREATE TABLE user_stars (
+		uid TEXT NOT NULL,
+		feed TEXT NOT NULL,
+		story TEXT NOT NULL,
+		created BIGINT NOT NULL,
+		data BLOB NOT NULL,
+		PRIMARY KEY (uid, feed, story)
+	);
+	CREATE INDEX user_stars_created ON user_stars (uid, created);
+	CREATE TABLE user_playback (
+		uid TEXT NOT NULL,
+		feed TEXT NOT NULL,
+		story TEXT NOT NULL,
+		updated BIGINT NOT NULL,
+		data BLOB NOT NULL,
+		PRIMARY KEY (uid, feed, story)
+	);
+	CREATE INDEX user_playback_updated ON user_playback (uid, updated);
+	CREATE TABLE user_charges (
+		uid TEXT PRIMARY KEY,
+		data BLOB NOT NULL
+	);
+	CREATE TABLE date_failures (
+		id TEXT PRIMARY KEY,
+		last BIGINT NOT NULL,
+		data BLOB NOT NULL
+	);
+	CREATE INDEX date_failures_last ON date_failures (last);
+	CREATE TABLE images (
+		id TEXT PRIMARY KEY,
+		data BLOB NOT NULL
+	)`,
+	`CREATE TABLE user_reads (
+		uid TEXT NOT NULL,
+		feed TEXT NOT NULL,
+		story TEXT NOT NULL,
+		created BIGINT NOT NULL,
+		data BLOB NOT NULL,
+		PRIMARY KEY (uid, feed, story)
+	);
+	CREATE INDEX user_reads_created ON user_reads (uid, created)`,
+}
+
+func init() {
+	gob.Register(time.Time{})
+	gob.Register(appengine.BlobKey(""))
+	gob.Register(datastore.ByteString(nil))
+}
+
+// NewSQLStorage returns a Storage using db, whose driver is sqlite3 or
+// postgres. The schema is created or updated first.
+func NewSQLStorage(db *sql.DB, driver string) (Storage, error) {
+	d, ok := sqlDialects[driver]
+	if !ok {
+		return nil, fmt.Errorf("unsupported database driver %q", driver)
+	}
+	s := &sqlStorage{db: db, dialect: d}
+	return s, s.migrate(context.Background())
+}
+
+func (s *sqlStorage) migrate(c context.Context) error {
+	if _, err := s.db.ExecContext(c, `CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		applied BIGINT NOT NULL
+	)`); err != nil {
+		return err
+	}
+	var version int
+	row := s.db.QueryRowContext(c, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations")
+	if err := row.Scan(&version); err != nil {
+		return err
+	}
+	for i := version; i < len(sqlMigrations); i++ {
+		err := s.RunInTransaction(c, func(c context.Context) error {
+			for _, stmt := range strings.Split(sqlMigrations[i], ";") {
+				if stmt = strings.TrimSpace(stmt); stmt == "" {
+					continue
+				}
+				stmt = strings.Replace(stmt, "BLOB", s.dialect.blob, -1)
+				if _, err := s.exec(c, stmt); err != nil {
+					return err
+				}
+			}
+			_, err := s.exec(c, "INSERT INTO schema_migrations (version, applied) VALUES (?, ?)",
+				i+1, time.Now().Unix())
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("schema migration %d: %v", i+1, err)
+		}
+	}
+	return nil
+}
+
+type sqlTxKey struct{}
+
+type sqlQuerier interface {
+	ExecContext(c context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(c context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(c context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// q returns the transaction if c is inside RunInTransaction, and the
+// database otherwise.
+func (s *sqlStorage) q(c context.Context) sqlQuerier {
+	if tx, ok := c.Value(sqlTxKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return s.db
+}
+
+// rebind rewrites the ? placeholders of query for the dialect.
+func (s *sqlStorage) rebind(query string) string {
+	if !s.dialect.numbered {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func (s *sqlStorage) exec(c context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return s.q(c).ExecContext(c, s.rebind(query), args...)
+}
+
+func (s *sqlStorage) query(c context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return s.q(c).QueryContext(c, s.rebind(query), args...)
+}
+
+func (s *sqlStorage) queryRow(c context.Context, query string, args ...interface{}) *sql.Row {
+	return s.q(c).QueryRowContext(c, s.rebind(query), args...)
+}
+
+func (s *sqlStorage) RunInTransaction(c context.Context, f func(c context.Context) error) error {
+	if _, ok := c.Value(sqlTxKey{}).(*sql.Tx); ok {
+		return f(c)
+	}
+	var opts *sql.TxOptions
+	if s.dialect.serializable {
+		opts = &sql.TxOptions{Isolation: sql.LevelSerializable}
+	}
+	var err error
+	for i := 0; i < sqlTxAttempts; i++ {
+		var tx *sql.Tx
+		if tx, err = s.db.BeginTx(c, opts); err != nil {
+			return err
+		}
+		if err = f(context.WithValue(c, sqlTxKey{}, tx)); err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+		if err == nil || !s.dialect.serializable || !strings.Contains(err.Error(), "could not serialize") {
+			break
+		}
+	}
+	return err
+}
+
+// sqlTime converts t to microseconds, which span every time goread uses,
+// from the zero time to timeMax.
+func sqlTime(t time.Time) int64 {
+	return t.Unix()*1e6 + int64(t.Nanosecond()/1e3)
+}
+
+// limit returns the LIMIT and OFFSET clause of p, and the offset after n
+// results as the next cursor.
+func (s *sqlStorage) limit(p Page) (string, func(n int) string) {
+	offset, _ := strconv.Atoi(p.Cursor)
+	if offset < 0 {
+		offset = 0
+	}
+	next := func(n int) string {
+		return strconv.Itoa(offset + n)
+	}
+	switch {
+	case p.Limit > 0:
+		return fmt.Sprintf(" LIMIT %d OFFSET %d", p.Limit, offset), next
+	case offset == 0:
+		return "", next
+	case s.dialect.numbered:
+		return fmt.Sprintf(" OFFSET %d", offset), next
+	default:
+		return fmt.Sprintf(" LIMIT -1 OFFSET %d", offset), next
+	}
+}
+
+// encodeEntity encodes the datastore properties of the struct pointer src.
+func encodeEntity(src interface{}) ([]byte, error) {
+	props, err := datastore.SaveStruct(src)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	err = gob.NewEncoder(&b).Encode(props)
+	return b.Bytes(), err
+}
+
+// decodeEntity loads b, as encoded by encodeEntity, into the struct pointer
+// dst. Properties dst no longer has are ignored.
+func decodeEntity(b []byte, dst interface{}) error {
+	var props []datastore.Property
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(&props); err != nil {
+		return err
+	}
+	err := datastore.LoadStruct(dst, props)
+	if _, ok := err.(*datastore.ErrFieldMismatch); ok {
+		return nil
+	}
+	return err
+}
+
+// get loads the data column of the row selected by query into dst.
+func (s *sqlStorage) get(c context.Context, dst interface{}, query string, args ...interface{}) error {
+	var b []byte
+	if err := s.queryRow(c, query, args...).Scan(&b); err == sql.ErrNoRows {
+		return ErrNotFound
+	} else if err != nil {
+		return err
+	}
+	return decodeEntity(b, dst)
+}
+
+// put inserts or replaces the row of table with the values of cols. The
+// first keys columns are the primary key.
+func (s *sqlStorage) put(c context.Context, table string, keys int, cols []string, args ...interface{}) error {
+	var set []string
+	for _, col := range cols[keys:] {
+		set = append(set, col+" = excluded."+col)
+	}
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (?%s) ON CONFLICT (%s) DO UPDATE SET %s",
+		table,
+		strings.Join(cols, ", "),
+		strings.Repeat(", ?", len(cols)-1),
+		strings.Join(cols[:keys], ", "),
+		strings.Join(set, ", "),
+	)
+	_, err := s.exec(c, query, args...)
+	return err
+}
+
+func (s *sqlStorage) GetFeed(c context.Context, url string) (*Feed, error) {
+	f := &Feed{}
+	err := s.get(c, f, "SELECT data FROM feeds WHERE url = ?", url)
+	f.Url = url
+	return f, err
+}
+
+func (s *sqlStorage) GetFeeds(c context.Context, urls []string) ([]*Feed, error) {
+	fs := make([]*Feed, len(urls))
+	for i, u := range urls {
+		f, err := s.GetFeed(c, u)
+		if err == nil {
+			fs[i] = f
+		} else if err != ErrNotFound {
+			return nil, err
+		}
+	}
+	return fs, nil
+}
+
+func (s *sqlStorage) PutFeed(c context.Context, f *Feed) error {
+	b, err := encodeEntity(f)
+	if err != nil {
+		return err
+	}
+	return s.put(c, "feeds", 1, []string{"url", "next_update", "data"},
+		f.Url, sqlTime(f.NextUpdate), b)
+}
+
+// feeds loads the feeds selected by query, which returns url and data.
+func (s *sqlStorage) feeds(c context.Context, query string, args ...interface{}) ([]*Feed, error) {
+	rows, err := s.query(c, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var fs []*Feed
+	for rows.Next() {
+		f := &Feed{}
+		var b []byte
+		if err := rows.Scan(&f.Url, &b); err != nil {
+			return nil, err
+		}
+		if err := decodeEntity(b, f); err != nil {
+			return nil, err
+		}
+		fs = append(fs, f)
+	}
+	return fs, rows.Err()
+}
+
+func (s *sqlStorage) DueFeeds(c context.Context, t time.Time, limit int) ([]*Feed, error) {
+	l, _ := s.limit(Page{Limit: limit})
+	return s.feeds(c, "SELECT url, data FROM feeds WHERE next_update <= ? ORDER BY next_update"+l, sqlTime(t))
+}
+
+// column returns the first column of the rows selected by query.
+func (s *sqlStorage) column(c context.Context, query string, args ...interface{}) ([]string, error) {
+	rows, err := s.query(c, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ret []string
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			return nil, err
+		}
+		ret = append(ret, v)
+	}
+	return ret, rows.Err()
+}
+
+func (s *sqlStorage) FeedUrls(c context.Context, next time.Time, p Page) ([]string, string, error) {
+	query := "SELECT url FROM feeds"
+	var args []interface{}
+	if !next.IsZero() {
+		query += " WHERE next_update = ?"
+		args = append(args, sqlTime(next))
+	}
+	limit, cur := s.limit(p)
+	urls, err := s.column(c, query+" ORDER BY url"+limit, args...)
+	return urls, cur(len(urls)), err
+}
+
+func (s *sqlStorage) getStory(c context.Context, id readStory) (*Story, error) {
+	st := &Story{}
+	err := s.get(c, st, "SELECT data FROM stories WHERE feed = ? AND id = ?", id.Feed, id.Story)
+	st.Id, st.Feed = id.Story, id.Feed
+	return st, err
+}
+
+func (s *sqlStorage) GetStories(c context.Context, ids []readStory) ([]*Story, error) {
+	ss := make([]*Story, len(ids))
+	for i, id := range ids {
+		st, err := s.getStory(c, id)
+		if err == nil {
+			ss[i] = st
+		} else if err != ErrNotFound {
+			return nil, err
+		}
+	}
+	return ss, nil
+}
+
+func (s *sqlStorage) PutStories(c context.Context, stories []*Story, content bool) error {
+	if len(stories) == 0 {
+		return nil
+	}
+	return s.RunInTransaction(c, func(c context.Context) error {
+		for _, st := range stories {
+			b, err := encodeEntity(st)
+			if err != nil {
+				return err
+			}
+			cols := []string{"feed", "id", "created", "data"}
+			args := []interface{}{st.Feed, st.Id, sqlTime(st.Created), b}
+			if content {
+				sc, err := encodeEntity(newStoryContent(st))
+				if err != nil {
+					return err
+				}
+				cols = append(cols, "content")
+				args = append(args, sc)
+			}
+			if err := s.put(c, "stories", 2, cols, args...); err != nil {
+				return err
+			}
+			for _, table := range []string{"story_categories", "story_authors"} {
+				if _, err := s.exec(c, "DELETE FROM "+table+" WHERE feed = ? AND id = ?", st.Feed, st.Id); err != nil {
+					return err
+				}
+			}
+			for _, k := range st.CategoryKeys {
+				if _, err := s.exec(c, "INSERT INTO story_categories (feed, id, category) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+					st.Feed, st.Id, k); err != nil {
+					return err
+				}
+			}
+			for _, k := range st.AuthorKeys {
+				if _, err := s.exec(c, "INSERT INTO story_authors (feed, id, author) VALUES (?, ?, ?) ON CONFLICT DO NOTHING",
+					st.Feed, st.Id, k); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlStorage) FeedStories(c context.Context, feed string, q StoryQuery) ([]*Story, string, error) {
+	query := "SELECT s.id, s.data FROM stories s WHERE s.feed = ? AND s.created >= ?"
+	args := []interface{}{feed, sqlTime(q.Since)}
+	if q.Category != "" {
+		query += " AND EXISTS (SELECT 1 FROM story_categories k WHERE k.feed = s.feed AND k.id = s.id AND k.category = ?)"
+		args = append(args, categoryKey(q.Category))
+	}
+	limit, cur := s.limit(q.Page)
+	rows, err := s.query(c, query+" ORDER BY s.created DESC, s.id"+limit, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	var stories []*Story
+	for rows.Next() {
+		st := &Story{Feed: feed}
+		var b []byte
+		if err := rows.Scan(&st.Id, &b); err != nil {
+			return nil, "", err
+		}
+		if err := decodeEntity(b, st); err != nil {
+			return nil, "", err
+		}
+		stories = append(stories, st)
+	}
+	return stories, cur(len(stories)), rows.Err()
+}
+
+func (s *sqlStorage) StoryContents(c context.Context, ids []readStory) ([]string, error) {
+	ret := make([]string, len(ids))
+	for i, id := range ids {
+		var b []byte
+		err := s.queryRow(c, "SELECT content FROM stories WHERE feed = ? AND id = ?", id.Feed, id.Story).Scan(&b)
+		if err == sql.ErrNoRows || len(b) == 0 {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		var sc StoryContent
+		if err := decodeEntity(b, &sc); err != nil {
+			return nil, err
+		}
+		ret[i] = sc.content()
+	}
+	return ret, nil
+}
+
+func (s *sqlStorage) DeleteStories(c context.Context, feed string) (int, error) {
+	var n int64
+	err := s.RunInTransaction(c, func(c context.Context) error {
+		for _, table := range []string{"story_categories", "story_authors"} {
+			if _, err := s.exec(c, "DELETE FROM "+table+" WHERE feed = ?", feed); err != nil {
+				return err
+			}
+		}
+		res, err := s.exec(c, "DELETE FROM stories WHERE feed = ?", feed)
+		if err != nil {
+			return err
+		}
+		n, err = res.RowsAffected()
+		return err
+	})
+	return int(n), err
+}
+
+func (s *sqlStorage) AuthorStories(c context.Context, author string, p Page) ([]readStory, []string, error) {
+	limit, cur := s.limit(p)
+	rows, err := s.query(c, `SELECT a.feed, a.id FROM story_authors a
+		JOIN stories s ON s.feed = a.feed AND s.id = a.id
+		WHERE a.author = ? ORDER BY s.created DESC, a.feed, a.id`+limit, author)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	var ids []readStory
+	var curs []string
+	for rows.Next() {
+		var id readStory
+		if err := rows.Scan(&id.Feed, &id.Story); err != nil {
+			return nil, nil, err
+		}
+		ids = append(ids, id)
+		curs = append(curs, cur(len(ids)))
+	}
+	return ids, curs, rows.Err()
+}
+
+func (s *sqlStorage) CountStories(c context.Context, feed string, since time.Time) (int, error) {
+	var n int
+	err := s.queryRow(c, "SELECT COUNT(*) FROM stories WHERE feed = ? AND created >= ?",
+		feed, sqlTime(since)).Scan(&n)
+	return n, err
+}
+
+func (s *sqlStorage) GetUser(c context.Context, id string) (*User, error) {
+	u := &User{}
+	err := s.get(c, u, "SELECT data FROM users WHERE id = ?", id)
+	u.Id = id
+	return u, err
+}
+
+func (s *sqlStorage) FindUser(c context.Context, email string) (*User, error) {
+	var id string
+	if err := s.queryRow(c, "SELECT id FROM users WHERE email = ? LIMIT 1", email).Scan(&id); err == sql.ErrNoRows {
+		return &User{}, ErrNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return s.GetUser(c, id)
+}
+
+func (s *sqlStorage) PutUser(c context.Context, u *User) error {
+	b, err := encodeEntity(u)
+	if err != nil {
+		return err
+	}
+	return s.put(c, "users", 1, []string{"id", "email", "data"}, u.Id, u.Email, b)
+}
+
+func (s *sqlStorage) UserIds(c context.Context, p Page) ([]string, string, error) {
+	limit, cur := s.limit(p)
+	ids, err := s.column(c, "SELECT id FROM users ORDER BY id"+limit)
+	return ids, cur(len(ids)), err
+}
+
+func (s *sqlStorage) CountUsers(c context.Context) (int, error) {
+	var n int
+	err := s.queryRow(c, "SELECT COUNT(*) FROM users").Scan(&n)
+	return n, err
+}
+
+func (s *sqlStorage) DeleteUser(c context.Context, id string) error {
+	return s.RunInTransaction(c, func(c context.Context) error {
+		for _, table := range []string{"user_data", "user_opmls", "user_stars", "user_reads", "user_playback", "user_charges"} {
+			if _, err := s.exec(c, "DELETE FROM "+table+" WHERE uid = ?", id); err != nil {
+				return err
+			}
+		}
+		_, err := s.exec(c, "DELETE FROM users WHERE id = ?", id)
+		return err
+	})
+}
+
+func (s *sqlStorage) GetUserData(c context.Context, uid string) (*UserData, error) {
+	ud := &UserData{}
+	err := s.get(c, ud, "SELECT data FROM user_data WHERE uid = ?", uid)
+	ud.Id = "data"
+	return ud, err
+}
+
+func (s *sqlStorage) PutUserData(c context.Context, uid string, ud *UserData) error {
+	ud.Id = "data"
+	b, err := encodeEntity(ud)
+	if err != nil {
+		return err
+	}
+	return s.put(c, "user_data", 1, []string{"uid", "data"}, uid, b)
+}
+
+func (s *sqlStorage) GetUserOpml(c context.Context, uid string, id int64) (*UserOpml, error) {
+	uo := &UserOpml{}
+	err := s.get(c, uo, "SELECT data FROM user_opmls WHERE uid = ? AND id = ?", uid, id)
+	uo.Id = id
+	return uo, err
+}
+
+func (s *sqlStorage) PutUserOpml(c context.Context, uid string, uo *UserOpml) error {
+	b, err := encodeEntity(uo)
+	if err != nil {
+		return err
+	}
+	return s.put(c, "user_opmls", 2, []string{"uid", "id", "data"}, uid, uo.Id, b)
+}
+
+func (s *sqlStorage) UserOpmls(c context.Context, uid string) ([]int64, error) {
+	rows, err := s.query(c, "SELECT id FROM user_opmls WHERE uid = ? ORDER BY id", uid)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+func (s *sqlStorage) PutStar(c context.Context, uid string, us *UserStar) error {
+	us.Id = us.Story
+	b, err := encodeEntity(us)
+	if err != nil {
+		return err
+	}
+	return s.put(c, "user_stars", 3, []string{"uid", "feed", "story", "created", "data"},
+		uid, us.Feed, us.Story, sqlTime(us.Created), b)
+}
+
+func (s *sqlStorage) DeleteStar(c context.Context, uid, feed, story string) error {
+	_, err := s.exec(c, "DELETE FROM user_stars WHERE uid = ? AND feed = ? AND story = ?", uid, feed, story)
+	return err
+}
+
+func (s *sqlStorage) Stars(c context.Context, uid string, q StarQuery) ([]*UserStar, string, error) {
+	query := "SELECT feed, story, data FROM user_stars WHERE uid = ? AND created >= ?"
+	args := []interface{}{uid, sqlTime(q.Since)}
+	if q.Feed != "" {
+		query += " AND feed = ?"
+		args = append(args, q.Feed)
+	}
+	limit, cur := s.limit(q.Page)
+	rows, err := s.query(c, query+" ORDER BY created DESC, feed, story"+limit, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	var stars []*UserStar
+	for rows.Next() {
+		us := &UserStar{}
+		var b []byte
+		if err := rows.Scan(&us.Feed, &us.Story, &b); err != nil {
+			return nil, "", err
+		}
+		if err := decodeEntity(b, us); err != nil {
+			return nil, "", err
+		}
+		us.Id = us.Story
+		stars = append(stars, us)
+	}
+	return stars, cur(len(stars)), rows.Err()
+}
+
+func (s *sqlStorage) PutReads(c context.Context, uid string, reads []*UserRead) error {
+	return s.RunInTransaction(c, func(c context.Context) error {
+		for _, r := range reads {
+			r.Id = r.Story
+			b, err := encodeEntity(r)
+			if err != nil {
+				return err
+			}
+			if err := s.put(c, "user_reads", 3, []string{"uid", "feed", "story", "created", "data"},
+				uid, r.Feed, r.Story, sqlTime(r.Created), b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlStorage) DeleteReads(c context.Context, uid string, ids []readStory) error {
+	return s.RunInTransaction(c, func(c context.Context) error {
+		for _, id := range ids {
+			if _, err := s.exec(c, "DELETE FROM user_reads WHERE uid = ? AND feed = ? AND story = ?",
+				uid, id.Feed, id.Story); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlStorage) FeedReads(c context.Context, uid, feed string, since time.Time) ([]*UserRead, error) {
+	rows, err := s.query(c, "SELECT story, data FROM user_reads WHERE uid = ? AND feed = ? AND created >= ?",
+		uid, feed, sqlTime(since))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var reads []*UserRead
+	for rows.Next() {
+		r := &UserRead{Feed: feed}
+		var b []byte
+		if err := rows.Scan(&r.Story, &b); err != nil {
+			return nil, err
+		}
+		if err := decodeEntity(b, r); err != nil {
+			return nil, err
+		}
+		r.Id = r.Story
+		reads = append(reads, r)
+	}
+	return reads, rows.Err()
+}
+
+func (s *sqlStorage) DeleteReadsBefore(c context.Context, uid string, t time.Time) error {
+	var err error
+	if t.IsZero() {
+		_, err = s.exec(c, "DELETE FROM user_reads WHERE uid = ?", uid)
+	} else {
+		_, err = s.exec(c, "DELETE FROM user_reads WHERE uid = ? AND created < ?", uid, sqlTime(t))
+	}
+	return err
+}
+
+func (s *sqlStorage) GetPlayback(c context.Context, uid, feed, story string) (*UserPlayback, error) {
+	p := &UserPlayback{}
+	err := s.get(c, p, "SELECT data FROM user_playback WHERE uid = ? AND feed = ? AND story = ?", uid, feed, story)
+	p.Id, p.Feed, p.Story = story, feed, story
+	return p, err
+}
+
+func (s *sqlStorage) PutPlayback(c context.Context, uid string, p *UserPlayback) error {
+	p.Id = p.Story
+	b, err := encodeEntity(p)
+	if err != nil {
+		return err
+	}
+	return s.put(c, "user_playback", 3, []string{"uid", "feed", "story", "updated", "data"},
+		uid, p.Feed, p.Story, sqlTime(p.Updated), b)
+}
+
+// playbacks loads the playback states selected by query, which returns
+// feed, story and data.
+func (s *sqlStorage) playbacks(c context.Context, query string, args ...interface{}) ([]*UserPlayback, error) {
+	rows, err := s.query(c, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var playback []*UserPlayback
+	for rows.Next() {
+		p := &UserPlayback{}
+		var b []byte
+		if err := rows.Scan(&p.Feed, &p.Story, &b); err != nil {
+			return nil, err
+		}
+		if err := decodeEntity(b, p); err != nil {
+			return nil, err
+		}
+		p.Id = p.Story
+		playback = append(playback, p)
+	}
+	return playback, rows.Err()
+}
+
+func (s *sqlStorage) Playbacks(c context.Context, uid string, since time.Time, limit int) ([]*UserPlayback, error) {
+	l, _ := s.limit(Page{Limit: limit})
+	return s.playbacks(c, "SELECT feed, story, data FROM user_playback WHERE uid = ? AND updated >= ? ORDER BY updated DESC"+l,
+		uid, sqlTime(since))
+}
+
+func (s *sqlStorage) FeedPlaybacks(c context.Context, uid, feed string) ([]*UserPlayback, error) {
+	return s.playbacks(c, "SELECT feed, story, data FROM user_playback WHERE uid = ? AND feed = ?", uid, feed)
+}
+
+func (s *sqlStorage) DeletePlayback(c context.Context, uid, feed, story string) error {
+	_, err := s.exec(c, "DELETE FROM user_playback WHERE uid = ? AND feed = ? AND story = ?", uid, feed, story)
+	return err
+}
+
+func (s *sqlStorage) GetCharge(c context.Context, uid string) (*UserCharge, error) {
+	uc := &UserCharge{}
+	err := s.get(c, uc, "SELECT data FROM user_charges WHERE uid = ?", uid)
+	uc.Id = 1
+	return uc, err
+}
+
+func (s *sqlStorage) PutCharge(c context.Context, uid string, uc *UserCharge) error {
+	uc.Id = 1
+	b, err := encodeEntity(uc)
+	if err != nil {
+		return err
+	}
+	return s.put(c, "user_charges", 1, []string{"uid", "data"}, uid, b)
+}
+
+func (s *sqlStorage) DeleteCharge(c context.Context, uid string) error {
+	_, err := s.exec(c, "DELETE FROM user_charges WHERE uid = ?", uid)
+	return err
+}
+
+func (s *sqlStorage) GetDateFailures(c context.Context, ids []string) ([]*DateFailure, error) {
+	dfs := make([]*DateFailure, len(ids))
+	for i, id := range ids {
+		df := &DateFailure{}
+		err := s.get(c, df, "SELECT data FROM date_failures WHERE id = ?", id)
+		if err == nil {
+			df.Id = id
+			dfs[i] = df
+		} else if err != ErrNotFound {
+			return nil, err
+		}
+	}
+	return dfs, nil
+}
+
+func (s *sqlStorage) PutDateFailures(c context.Context, dfs []*DateFailure) error {
+	return s.RunInTransaction(c, func(c context.Context) error {
+		for _, df := range dfs {
+			b, err := encodeEntity(df)
+			if err != nil {
+				return err
+			}
+			if err := s.put(c, "date_failures", 1, []string{"id", "last", "data"}, df.Id, sqlTime(df.Last), b); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *sqlStorage) DateFailures(c context.Context, limit int) ([]*DateFailure, error) {
+	l, _ := s.limit(Page{Limit: limit})
+	rows, err := s.query(c, "SELECT id, data FROM date_failures ORDER BY last DESC"+l)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var dfs []*DateFailure
+	for rows.Next() {
+		df := &DateFailure{}
+		var b []byte
+		if err := rows.Scan(&df.Id, &b); err != nil {
+			return nil, err
+		}
+		if err := decodeEntity(b, df); err != nil {
+			return nil, err
+		}
+		dfs = append(dfs, df)
+	}
+	return dfs, rows.Err()
+}
+
+func (s *sqlStorage) GetImage(c context.Context, id string) (*Image, error) {
+	img := &Image{}
+	err := s.get(c, img, "SELECT data FROM images WHERE id = ?", id)
+	img.Id = id
+	return img, err
+}
+
+func (s *sqlStorage) PutImage(c context.Context, img *Image) error {
+	b, err := encodeEntity(img)
+	if err != nil {
+		return err
+	}
+	return s.put(c, "images", 1, []string{"id", "data"}, img.Id, b)
+}
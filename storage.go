@@ -0,0 +1,145 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/appengine/datastore"
+)
+
+// Storage is where handlers keep their entities. Feeds are identified by
+// URL, stories by feed URL and story id, and everything else by the id of
+// the user it belongs to.
+//
+// Single-entity getters always return an entity with its ids set, which is
+// otherwise empty when the error is ErrNotFound. Multi-entity getters
+// return nil entries for entities that don't exist.
+type Storage interface {
+	GetFeed(c context.Context, url string) (*Feed, error)
+	GetFeeds(c context.Context, urls []string) ([]*Feed, error)
+	PutFeed(c context.Context, f *Feed) error
+	// DueFeeds returns up to limit feeds whose NextUpdate is not after t.
+	DueFeeds(c context.Context, t time.Time, limit int) ([]*Feed, error)
+	// FeedUrls lists feeds whose NextUpdate is exactly next, or all feeds
+	// if next is zero.
+	FeedUrls(c context.Context, next time.Time, q Page) ([]string, string, error)
+
+	GetStories(c context.Context, ids []readStory) ([]*Story, error)
+	// PutStories stores stories, and with content also their content.
+	PutStories(c context.Context, stories []*Story, content bool) error
+	// FeedStories returns stories of a feed, newest first.
+	FeedStories(c context.Context, feed string, q StoryQuery) ([]*Story, string, error)
+	StoryContents(c context.Context, ids []readStory) ([]string, error)
+	// DeleteStories deletes the stories of a feed and their content.
+	DeleteStories(c context.Context, feed string) (int, error)
+	// AuthorStories lists stories of all feeds with the author key, newest
+	// first. The i-th cursor continues after the i-th story.
+	AuthorStories(c context.Context, author string, q Page) ([]readStory, []string, error)
+	// CountStories counts the stories of a feed created at or after since.
+	CountStories(c context.Context, feed string, since time.Time) (int, error)
+
+	GetUser(c context.Context, id string) (*User, error)
+	FindUser(c context.Context, email string) (*User, error)
+	PutUser(c context.Context, u *User) error
+	UserIds(c context.Context, q Page) ([]string, string, error)
+	CountUsers(c context.Context) (int, error)
+	// DeleteUser deletes a user and everything belonging to them.
+	DeleteUser(c context.Context, id string) error
+
+	GetUserData(c context.Context, uid string) (*UserData, error)
+	PutUserData(c context.Context, uid string, ud *UserData) error
+
+	GetUserOpml(c context.Context, uid string, id int64) (*UserOpml, error)
+	PutUserOpml(c context.Context, uid string, uo *UserOpml) error
+	// UserOpmls lists the ids of a user's OPML backups, oldest first.
+	UserOpmls(c context.Context, uid string) ([]int64, error)
+
+	PutStar(c context.Context, uid string, us *UserStar) error
+	DeleteStar(c context.Context, uid, feed, story string) error
+	Stars(c context.Context, uid string, q StarQuery) ([]*UserStar, string, error)
+
+	// PutReads marks stories read for a user. Stories created before
+	// User.Read are read without one.
+	PutReads(c context.Context, uid string, reads []*UserRead) error
+	DeleteReads(c context.Context, uid string, ids []readStory) error
+	// FeedReads returns a user's reads of the stories of a feed created at
+	// or after since.
+	FeedReads(c context.Context, uid, feed string, since time.Time) ([]*UserRead, error)
+	// DeleteReadsBefore deletes a user's reads of stories created before t,
+	// or all of them if t is zero.
+	DeleteReadsBefore(c context.Context, uid string, t time.Time) error
+
+	GetPlayback(c context.Context, uid, feed, story string) (*UserPlayback, error)
+	PutPlayback(c context.Context, uid string, p *UserPlayback) error
+	// Playbacks returns a user's playback states, most recently updated
+	// first.
+	Playbacks(c context.Context, uid string, since time.Time, limit int) ([]*UserPlayback, error)
+	FeedPlaybacks(c context.Context, uid, feed string) ([]*UserPlayback, error)
+	DeletePlayback(c context.Context, uid, feed, story string) error
+
+	GetCharge(c context.Context, uid string) (*UserCharge, error)
+	PutCharge(c context.Context, uid string, uc *UserCharge) error
+	DeleteCharge(c context.Context, uid string) error
+
+	GetDateFailures(c context.Context, ids []string) ([]*DateFailure, error)
+	PutDateFailures(c context.Context, dfs []*DateFailure) error
+	// DateFailures returns the most recently seen date failures.
+	DateFailures(c context.Context, limit int) ([]*DateFailure, error)
+
+	GetImage(c context.Context, id string) (*Image, error)
+	PutImage(c context.Context, img *Image) error
+
+	// RunInTransaction runs f atomically for the entities of one user. f
+	// must use the context it is passed.
+	RunInTransaction(c context.Context, f func(c context.Context) error) error
+}
+
+// ErrNotFound is returned for missing entities. It is the datastore's
+// error so existing comparisons hold for every implementation.
+var ErrNotFound = datastore.ErrNoSuchEntity
+
+// Store is the Storage used by handlers.
+var Store Storage = datastoreStorage{}
+
+// Page selects part of a query result. Cursor is what a previous query
+// returned, and Limit is unlimited if zero.
+type Page struct {
+	Cursor string
+	Limit  int
+}
+
+// StoryQuery filters FeedStories. Since is a lower bound on Created.
+type StoryQuery struct {
+	Page
+	Since    time.Time
+	Category string
+}
+
+// StarQuery filters Stars. Without Feed, stars of all feeds are returned
+// newest first.
+type StarQuery struct {
+	Page
+	Feed  string
+	Since time.Time
+}
+
+func starID(feed, story string) string {
+	return fmt.Sprintf("%s|%s", feed, story)
+}
@@ -0,0 +1,556 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newSQLiteStorage returns a sqlStorage in a new in-memory database.
+func newSQLiteStorage(t *testing.T) *sqlStorage {
+	db, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Each connection would have its own database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	s, err := NewSQLStorage(db, "sqlite3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s.(*sqlStorage)
+}
+
+// testTime is a time every Storage keeps exactly.
+var testTime = time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+
+func at(hours int) time.Time {
+	return testTime.Add(time.Hour * time.Duration(hours))
+}
+
+// allPages collects every page of size limit that list returns.
+func allPages(t *testing.T, limit int, list func(p Page) ([]string, string, error)) []string {
+	t.Helper()
+	var all []string
+	p := Page{Limit: limit}
+	for i := 0; ; i++ {
+		ids, cur, err := list(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		all = append(all, ids...)
+		if len(ids) < limit || i > 10 {
+			return all
+		}
+		p.Cursor = cur
+	}
+}
+
+func TestStorageFeeds(t *testing.T) {
+	forEachStore(t, func(t *testing.T, _ *taskRecorder) {
+		c := context.Background()
+		if f, err := Store.GetFeed(c, "a"); err != ErrNotFound || f.Url != "a" {
+			t.Fatalf("missing feed: %v, %v", f, err)
+		}
+		for i, u := range []string{"c", "a", "b"} {
+			f := &Feed{Url: u, Title: "t" + u, NextUpdate: at(i), SkipHours: []int{1, 2}, Author: Person{Name: "n"}}
+			if err := Store.PutFeed(c, f); err != nil {
+				t.Fatal(err)
+			}
+		}
+		f, err := Store.GetFeed(c, "a")
+		if err != nil || f.Title != "ta" || !f.NextUpdate.Equal(at(1)) || !reflect.DeepEqual(f.SkipHours, []int{1, 2}) || f.Author.Name != "n" {
+			t.Errorf("get feed: %+v, %v", f, err)
+		}
+		f.Title = "new"
+		Store.PutFeed(c, f)
+		if f, _ := Store.GetFeed(c, "a"); f.Title != "new" {
+			t.Errorf("put didn't replace: %v", f.Title)
+		}
+
+		fs, err := Store.GetFeeds(c, []string{"b", "x", "c"})
+		if err != nil || len(fs) != 3 || fs[0].Url != "b" || fs[1] != nil || fs[2].Title != "tc" {
+			t.Errorf("get feeds: %v, %v", fs, err)
+		}
+		fs, err = Store.DueFeeds(c, at(1), 10)
+		if err != nil || len(fs) != 2 || fs[0].Url != "c" || fs[1].Url != "a" {
+			t.Errorf("due feeds: %v, %v", fs, err)
+		}
+		if fs, _ := Store.DueFeeds(c, at(2), 1); len(fs) != 1 {
+			t.Errorf("due feeds limit: %v", fs)
+		}
+		urls := allPages(t, 2, func(p Page) ([]string, string, error) {
+			return Store.FeedUrls(c, time.Time{}, p)
+		})
+		if !equalIds(urls, "a", "b", "c") {
+			t.Errorf("feed urls: %v", urls)
+		}
+		if urls, _, _ := Store.FeedUrls(c, at(2), Page{}); !equalIds(urls, "b") {
+			t.Errorf("feed urls next: %v", urls)
+		}
+	})
+}
+
+func TestStorageStories(t *testing.T) {
+	forEachStore(t, func(t *testing.T, _ *taskRecorder) {
+		c := context.Background()
+		var stories []*Story
+		for i, id := range []string{"1", "2", "3", "4"} {
+			s := &Story{Id: id, Feed: "f", Title: "t" + id, Created: at(i), content: "c" + id}
+			if i%2 == 0 {
+				s.CategoryKeys = []string{categoryKey("even")}
+				s.AuthorKeys = []string{"ann"}
+			}
+			stories = append(stories, s)
+		}
+		stories = append(stories, &Story{Id: "1", Feed: "g", Created: at(10), AuthorKeys: []string{"ann"}})
+		if err := Store.PutStories(c, stories, true); err != nil {
+			t.Fatal(err)
+		}
+
+		ss, err := Store.GetStories(c, []readStory{{"f", "2"}, {"f", "x"}, {"g", "1"}})
+		if err != nil || ss[0].Title != "t2" || ss[0].Feed != "f" || ss[1] != nil || ss[2].Feed != "g" {
+			t.Fatalf("get stories: %v, %v", ss, err)
+		}
+		ids := func(ss []*Story) []string {
+			var ids []string
+			for _, s := range ss {
+				ids = append(ids, s.Id)
+			}
+			return ids
+		}
+		all := allPages(t, 3, func(p Page) ([]string, string, error) {
+			ss, cur, err := Store.FeedStories(c, "f", StoryQuery{Page: p})
+			return ids(ss), cur, err
+		})
+		if !equalIds(all, "4", "3", "2", "1") {
+			t.Errorf("feed stories: %v", all)
+		}
+		if ss, _, _ := Store.FeedStories(c, "f", StoryQuery{Since: at(2)}); !equalIds(ids(ss), "4", "3") {
+			t.Errorf("feed stories since: %v", ids(ss))
+		}
+		if ss, _, _ := Store.FeedStories(c, "f", StoryQuery{Category: "Even"}); !equalIds(ids(ss), "3", "1") {
+			t.Errorf("feed stories category: %v", ids(ss))
+		}
+		if n, err := Store.CountStories(c, "f", at(1)); err != nil || n != 3 {
+			t.Errorf("count stories: %v, %v", n, err)
+		}
+		if cs, err := Store.StoryContents(c, []readStory{{"f", "3"}, {"g", "1"}}); err != nil || !equalIds(cs, "c3", "") {
+			t.Errorf("contents: %q, %v", cs, err)
+		}
+		rs, curs, err := Store.AuthorStories(c, "ann", Page{Limit: 2})
+		if err != nil || !reflect.DeepEqual(rs, []readStory{{"g", "1"}, {"f", "3"}}) || len(curs) != 2 {
+			t.Errorf("author stories: %v, %v, %v", rs, curs, err)
+		} else if rs, _, _ := Store.AuthorStories(c, "ann", Page{Cursor: curs[0]}); !reflect.DeepEqual(rs, []readStory{{"f", "3"}, {"f", "1"}}) {
+			t.Errorf("author stories after the first: %v", rs)
+		}
+
+		if n, err := Store.DeleteStories(c, "f"); err != nil || n != 4 {
+			t.Errorf("delete stories: %v, %v", n, err)
+		}
+		if ss, _ := Store.GetStories(c, []readStory{{"f", "1"}, {"g", "1"}}); ss[0] != nil || ss[1] == nil {
+			t.Errorf("deleted stories: %v", ss)
+		}
+		if cs, _ := Store.StoryContents(c, []readStory{{"f", "1"}}); cs[0] != "" {
+			t.Errorf("deleted content: %q", cs)
+		}
+	})
+}
+
+func TestStorageUsers(t *testing.T) {
+	forEachStore(t, func(t *testing.T, _ *taskRecorder) {
+		c := context.Background()
+		if u, err := Store.GetUser(c, "u"); err != ErrNotFound || u.Id != "u" {
+			t.Fatalf("missing user: %v, %v", u, err)
+		}
+		if _, err := Store.GetUserData(c, "u"); err != ErrNotFound {
+			t.Fatalf("missing data: %v", err)
+		}
+		for _, id := range []string{"u", "v", "w"} {
+			if err := Store.PutUser(c, &User{Id: id, Email: id + "@x", Read: at(1)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if u, err := Store.FindUser(c, "v@x"); err != nil || u.Id != "v" || !u.Read.Equal(at(1)) {
+			t.Errorf("find user: %v, %v", u, err)
+		}
+		if _, err := Store.FindUser(c, "none@x"); err != ErrNotFound {
+			t.Errorf("find missing user: %v", err)
+		}
+		ids := allPages(t, 2, func(p Page) ([]string, string, error) {
+			return Store.UserIds(c, p)
+		})
+		if !equalIds(ids, "u", "v", "w") {
+			t.Errorf("user ids: %v", ids)
+		}
+
+		Store.PutUserData(c, "u", &UserData{Opml: []byte("o")})
+		Store.PutUserOpml(c, "u", &UserOpml{Id: 2, Opml: []byte("b")})
+		Store.PutUserOpml(c, "u", &UserOpml{Id: 1, Opml: []byte("a")})
+		Store.PutStar(c, "u", &UserStar{Feed: "f", Story: "1", Created: at(1)})
+		Store.PutReads(c, "u", []*UserRead{{Feed: "f", Story: "1", Created: at(1)}})
+		Store.PutPlayback(c, "u", &UserPlayback{Feed: "f", Story: "1", Updated: at(1)})
+		Store.PutCharge(c, "u", &UserCharge{Customer: "c"})
+		if ud, err := Store.GetUserData(c, "u"); err != nil || string(ud.Opml) != "o" {
+			t.Errorf("user data: %v, %v", ud, err)
+		}
+		if ids, err := Store.UserOpmls(c, "u"); err != nil || !reflect.DeepEqual(ids, []int64{1, 2}) {
+			t.Errorf("user opmls: %v, %v", ids, err)
+		}
+		if uo, err := Store.GetUserOpml(c, "u", 2); err != nil || string(uo.Opml) != "b" {
+			t.Errorf("user opml: %v, %v", uo, err)
+		}
+		if uc, err := Store.GetCharge(c, "u"); err != nil || uc.Customer != "c" {
+			t.Errorf("charge: %v, %v", uc, err)
+		}
+		Store.PutUserData(c, "v", &UserData{})
+		Store.PutStar(c, "v", &UserStar{Feed: "f", Story: "1", Created: at(1)})
+
+		if err := Store.DeleteUser(c, "u"); err != nil {
+			t.Fatal(err)
+		}
+		if n, _ := Store.CountUsers(c); n != 2 {
+			t.Errorf("count users: %v", n)
+		}
+		if _, err := Store.GetUserData(c, "u"); err != ErrNotFound {
+			t.Errorf("deleted data: %v", err)
+		}
+		if ids, _ := Store.UserOpmls(c, "u"); len(ids) != 0 {
+			t.Errorf("deleted opmls: %v", ids)
+		}
+		if us, _, _ := Store.Stars(c, "u", StarQuery{}); len(us) != 0 {
+			t.Errorf("deleted stars: %v", us)
+		}
+		if rs, _ := Store.FeedReads(c, "u", "f", time.Time{}); len(rs) != 0 {
+			t.Errorf("deleted reads: %v", rs)
+		}
+		if _, err := Store.GetPlayback(c, "u", "f", "1"); err != ErrNotFound {
+			t.Errorf("deleted playback: %v", err)
+		}
+		if _, err := Store.GetCharge(c, "u"); err != ErrNotFound {
+			t.Errorf("deleted charge: %v", err)
+		}
+		if us, _, _ := Store.Stars(c, "v", StarQuery{}); len(us) != 1 {
+			t.Errorf("other user's stars: %v", us)
+		}
+	})
+}
+
+func TestStorageStars(t *testing.T) {
+	forEachStore(t, func(t *testing.T, _ *taskRecorder) {
+		c := context.Background()
+		for i, rs := range []readStory{{"f", "1"}, {"g", "1"}, {"f", "2"}} {
+			if err := Store.PutStar(c, "u", &UserStar{Feed: rs.Feed, Story: rs.Story, Created: at(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ids := func(us []*UserStar) []string {
+			var ids []string
+			for _, s := range us {
+				ids = append(ids, starID(s.Feed, s.Story))
+			}
+			return ids
+		}
+		all := allPages(t, 2, func(p Page) ([]string, string, error) {
+			us, cur, err := Store.Stars(c, "u", StarQuery{Page: p})
+			return ids(us), cur, err
+		})
+		if !equalIds(all, "f|2", "g|1", "f|1") {
+			t.Errorf("stars: %v", all)
+		}
+		if us, _, _ := Store.Stars(c, "u", StarQuery{Feed: "f", Since: at(1)}); !equalIds(ids(us), "f|2") || !us[0].Created.Equal(at(2)) {
+			t.Errorf("feed stars: %v", ids(us))
+		}
+		Store.DeleteStar(c, "u", "f", "2")
+		if us, _, _ := Store.Stars(c, "u", StarQuery{Feed: "f"}); !equalIds(ids(us), "f|1") {
+			t.Errorf("deleted star: %v", ids(us))
+		}
+	})
+}
+
+func TestStorageReads(t *testing.T) {
+	forEachStore(t, func(t *testing.T, _ *taskRecorder) {
+		c := context.Background()
+		err := Store.PutReads(c, "u", []*UserRead{
+			{Feed: "f", Story: "1", Created: at(1)},
+			{Feed: "f", Story: "2", Created: at(2)},
+			{Feed: "f", Story: "3", Created: at(3)},
+			{Feed: "g", Story: "1", Created: at(1)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		Store.PutReads(c, "v", []*UserRead{{Feed: "f", Story: "1", Created: at(1)}})
+		reads := func(uid, feed string, since time.Time) []string {
+			rs, err := Store.FeedReads(c, uid, feed, since)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var ids []string
+			for _, r := range rs {
+				if r.Feed != feed {
+					t.Errorf("read of %v in %v", r.Feed, feed)
+				}
+				ids = append(ids, r.Story)
+			}
+			sort.Strings(ids)
+			return ids
+		}
+		if ids := reads("u", "f", at(2)); !equalIds(ids, "2", "3") {
+			t.Errorf("feed reads: %v", ids)
+		}
+		Store.DeleteReads(c, "u", []readStory{{"f", "3"}, {"f", "x"}})
+		if ids := reads("u", "f", time.Time{}); !equalIds(ids, "1", "2") {
+			t.Errorf("deleted read: %v", ids)
+		}
+		Store.DeleteReadsBefore(c, "u", at(2))
+		if ids := reads("u", "f", time.Time{}); !equalIds(ids, "2") {
+			t.Errorf("deleted reads before: %v", ids)
+		}
+		if ids := reads("u", "g", time.Time{}); len(ids) != 0 {
+			t.Errorf("deleted reads before in other feed: %v", ids)
+		}
+		Store.DeleteReadsBefore(c, "u", time.Time{})
+		if ids := reads("u", "f", time.Time{}); len(ids) != 0 {
+			t.Errorf("deleted all reads: %v", ids)
+		}
+		if ids := reads("v", "f", time.Time{}); !equalIds(ids, "1") {
+			t.Errorf("other user's reads: %v", ids)
+		}
+	})
+}
+
+func TestStoragePlayback(t *testing.T) {
+	forEachStore(t, func(t *testing.T, _ *taskRecorder) {
+		c := context.Background()
+		if p, err := Store.GetPlayback(c, "u", "f", "1"); err != ErrNotFound || p.Feed != "f" || p.Story != "1" {
+			t.Fatalf("missing playback: %v, %v", p, err)
+		}
+		for i, rs := range []readStory{{"f", "1"}, {"g", "1"}, {"f", "2"}} {
+			if err := Store.PutPlayback(c, "u", &UserPlayback{Feed: rs.Feed, Story: rs.Story, Position: float64(i), Updated: at(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if p, err := Store.GetPlayback(c, "u", "f", "2"); err != nil || p.Position != 2 {
+			t.Errorf("get playback: %v, %v", p, err)
+		}
+		ps, err := Store.Playbacks(c, "u", at(1), 10)
+		if err != nil || len(ps) != 2 || ps[0].Story != "2" || ps[1].Feed != "g" {
+			t.Errorf("playbacks: %v, %v", ps, err)
+		}
+		if ps, _ := Store.Playbacks(c, "u", time.Time{}, 1); len(ps) != 1 {
+			t.Errorf("playbacks limit: %v", ps)
+		}
+		if ps, _ := Store.FeedPlaybacks(c, "u", "f"); len(ps) != 2 {
+			t.Errorf("feed playbacks: %v", ps)
+		}
+		Store.DeletePlayback(c, "u", "f", "1")
+		if ps, _ := Store.FeedPlaybacks(c, "u", "f"); len(ps) != 1 || ps[0].Story != "2" || ps[0].Feed != "f" {
+			t.Errorf("deleted playback: %v", ps)
+		}
+	})
+}
+
+func TestStorageMisc(t *testing.T) {
+	forEachStore(t, func(t *testing.T, _ *taskRecorder) {
+		c := context.Background()
+		Store.PutCharge(c, "u", &UserCharge{Customer: "c", Next: at(1)})
+		if uc, err := Store.GetCharge(c, "u"); err != nil || !uc.Next.Equal(at(1)) {
+			t.Errorf("charge: %v, %v", uc, err)
+		}
+		Store.DeleteCharge(c, "u")
+		if _, err := Store.GetCharge(c, "u"); err != ErrNotFound {
+			t.Errorf("deleted charge: %v", err)
+		}
+
+		err := Store.PutDateFailures(c, []*DateFailure{
+			{Id: "a", Raw: "ra", Count: 1, Last: at(2)},
+			{Id: "b", Raw: "rb", Count: 2, Last: at(1)},
+			{Id: "c", Raw: "rc", Count: 3, Last: at(3)},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		dfs, err := Store.GetDateFailures(c, []string{"b", "x"})
+		if err != nil || len(dfs) != 2 || dfs[0].Raw != "rb" || dfs[1] != nil {
+			t.Errorf("get date failures: %v, %v", dfs, err)
+		}
+		dfs, err = Store.DateFailures(c, 2)
+		if err != nil || len(dfs) != 2 || dfs[0].Id != "c" || dfs[1].Id != "a" {
+			t.Errorf("date failures: %v, %v", dfs, err)
+		}
+
+		if _, err := Store.GetImage(c, "i"); err != ErrNotFound {
+			t.Errorf("missing image: %v", err)
+		}
+		Store.PutImage(c, &Image{Id: "i", Data: []byte{1, 2}, Type: "image/png", Updated: at(1)})
+		if img, err := Store.GetImage(c, "i"); err != nil || !reflect.DeepEqual(img.Data, []byte{1, 2}) || !img.Updated.Equal(at(1)) {
+			t.Errorf("image: %v, %v", img, err)
+		}
+	})
+}
+
+func TestStorageTransaction(t *testing.T) {
+	forEachStore(t, func(t *testing.T, _ *taskRecorder) {
+		c := context.Background()
+		Store.PutUser(c, &User{Id: "u", Options: "a"})
+		fail := errors.New("fail")
+		err := Store.RunInTransaction(c, func(c context.Context) error {
+			u, err := Store.GetUser(c, "u")
+			if err != nil {
+				return err
+			}
+			u.Options = "b"
+			Store.PutUser(c, u)
+			Store.PutStar(c, "u", &UserStar{Feed: "f", Story: "1"})
+			// Nested transactions are part of the outer one.
+			return Store.RunInTransaction(c, func(c context.Context) error {
+				if u, _ := Store.GetUser(c, "u"); u.Options != "b" {
+					t.Errorf("write not visible in transaction: %v", u.Options)
+				}
+				return fail
+			})
+		})
+		if err != fail {
+			t.Fatalf("transaction error: %v", err)
+		}
+		if u, _ := Store.GetUser(c, "u"); u.Options != "a" {
+			t.Errorf("user not rolled back: %v", u.Options)
+		}
+		if us, _, _ := Store.Stars(c, "u", StarQuery{}); len(us) != 0 {
+			t.Errorf("star not rolled back: %v", us)
+		}
+		err = Store.RunInTransaction(c, func(c context.Context) error {
+			u, _ := Store.GetUser(c, "u")
+			u.Options = "c"
+			return Store.PutUser(c, u)
+		})
+		if u, _ := Store.GetUser(c, "u"); err != nil || u.Options != "c" {
+			t.Errorf("transaction not committed: %v, %v", u.Options, err)
+		}
+	})
+}
+
+func TestSQLRebind(t *testing.T) {
+	s := &sqlStorage{dialect: sqlDialects["postgres"]}
+	if q := s.rebind("a = ? AND b IN (?, ?)"); q != "a = $1 AND b IN ($2, $3)" {
+		t.Errorf("postgres: %v", q)
+	}
+	s.dialect = sqlDialects["sqlite3"]
+	if q := s.rebind("a = ?"); q != "a = ?" {
+		t.Errorf("sqlite3: %v", q)
+	}
+}
+
+func TestSQLLimit(t *testing.T) {
+	for i, test := range []struct {
+		driver string
+		p      Page
+		clause string
+		next   string
+	}{
+		{"sqlite3", Page{}, "", "3"},
+		{"sqlite3", Page{Limit: 5}, " LIMIT 5 OFFSET 0", "3"},
+		{"sqlite3", Page{Cursor: "10"}, " LIMIT -1 OFFSET 10", "13"},
+		{"sqlite3", Page{Cursor: "-1", Limit: 2}, " LIMIT 2 OFFSET 0", "3"},
+		{"sqlite3", Page{Cursor: "junk"}, "", "3"},
+		{"postgres", Page{Cursor: "10"}, " OFFSET 10", "13"},
+		{"postgres", Page{Cursor: "10", Limit: 5}, " LIMIT 5 OFFSET 10", "13"},
+	} {
+		s := &sqlStorage{dialect: sqlDialects[test.driver]}
+		clause, next := s.limit(test.p)
+		if clause != test.clause || next(3) != test.next {
+			t.Errorf("%v: got %q, %v; want %q, %v", i, clause, next(3), test.clause, test.next)
+		}
+	}
+}
+
+func TestSQLRetry(t *testing.T) {
+	s := newSQLiteStorage(t)
+	// Pretend SQLite is PostgreSQL, whose serializable transactions fail
+	// when they conflict.
+	s.dialect.serializable = true
+	c := context.Background()
+	for i, test := range []struct {
+		fails int
+		err   string
+		runs  int
+		ok    bool
+	}{
+		{0, "could not serialize access", 1, true},
+		{2, "could not serialize access", 3, true},
+		{sqlTxAttempts, "could not serialize access", sqlTxAttempts, false},
+		{1, "other", 1, false},
+	} {
+		runs := 0
+		err := s.RunInTransaction(c, func(c context.Context) error {
+			runs++
+			if err := s.PutUser(c, &User{Id: "u"}); err != nil {
+				return err
+			}
+			if runs <= test.fails {
+				return errors.New(test.err)
+			}
+			return nil
+		})
+		if runs != test.runs || (err == nil) != test.ok {
+			t.Errorf("%v: %v runs, %v", i, runs, err)
+		}
+	}
+}
+
+func TestSQLMigrations(t *testing.T) {
+	s := newSQLiteStorage(t)
+	c := context.Background()
+	if err := s.migrate(c); err != nil {
+		t.Fatalf("migrating again: %v", err)
+	}
+	var n, max int
+	if err := s.db.QueryRowContext(c, "SELECT COUNT(*), MAX(version) FROM schema_migrations").Scan(&n, &max); err != nil {
+		t.Fatal(err)
+	}
+	if n != len(sqlMigrations) || max != len(sqlMigrations) {
+		t.Errorf("%v migrations recorded up to %v, want %v", n, max, len(sqlMigrations))
+	}
+}
+
+func TestSQLDecodeEntity(t *testing.T) {
+	// An entity saved with a field that was since removed still loads.
+	b, err := encodeEntity(&struct {
+		Title string `datastore:"t"`
+		Gone  string `datastore:"gone"`
+	}{"title", "x"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f Feed
+	if err := decodeEntity(b, &f); err != nil || f.Title != "title" {
+		t.Errorf("got %q, %v", f.Title, err)
+	}
+	if err := decodeEntity([]byte("junk"), &f); err == nil {
+		t.Error("expected error for junk")
+	}
+}
@@ -17,14 +17,15 @@
 package goread
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
+	"crypto/x509"
 	"encoding/base64"
 	"encoding/xml"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -34,13 +35,13 @@ import (
 
 	"github.com/mjibson/goon"
 	"github.com/msde/go-charset/charset"
+	"github.com/msde/goread/platform/blobstore"
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/taskqueue"
+	"github.com/msde/goread/platform/urlfetch"
 
 	"google.golang.org/appengine"
-	"google.golang.org/appengine/blobstore"
 	"google.golang.org/appengine/datastore"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/taskqueue"
-	"google.golang.org/appengine/urlfetch"
 )
 
 func taskNameShouldEscape(c byte) bool {
@@ -99,7 +100,6 @@ func taskNameEscape(s string) string {
 
 func ImportOpmlTask(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
 	userid := r.FormValue("user")
 	bk := r.FormValue("key")
 	del := func() {
@@ -166,15 +166,13 @@ func ImportOpmlTask(w http.ResponseWriter, r *http.Request) {
 	}
 	wg.Wait()
 
-	ud := UserData{Id: "data", Parent: gn.Key(&User{Id: userid})}
-	if err := gn.RunInTransaction(func(gn *goon.Goon) error {
-		gn.Get(&ud)
-		if err := mergeUserOpml(c, &ud, userOpml...); err != nil {
+	if err := Store.RunInTransaction(c, func(c context.Context) error {
+		ud, _ := Store.GetUserData(c, userid)
+		if err := mergeUserOpml(c, ud, userOpml...); err != nil {
 			return err
 		}
-		_, err := gn.Put(&ud)
-		return err
-	}, nil); err != nil {
+		return Store.PutUserData(c, userid, ud)
+	}); err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		log.Errorf(c, "ude update error: %v", err.Error())
 		return
@@ -197,16 +195,14 @@ const IMPORT_LIMIT = 10
 
 func SubscribeCallback(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
 	furl := r.FormValue("feed")
 	b, _ := base64.URLEncoding.DecodeString(furl)
-	f := Feed{Url: string(b)}
-	log.Infof(c, "url: %v", f.Url)
-	if err := gn.Get(&f); err != nil {
+	log.Infof(c, "url: %s", b)
+	f, err := Store.GetFeed(c, string(b))
+	if err != nil {
 		http.Error(w, "", http.StatusNotFound)
 		return
 	}
-	fk := gn.Key(&f)
 	if r.Method == "GET" {
 		if f.NotViewed() || r.FormValue("hub.mode") != "subscribe" || r.FormValue("hub.topic") != f.Url {
 			http.Error(w, "", http.StatusNotFound)
@@ -215,11 +211,11 @@ func SubscribeCallback(w http.ResponseWriter, r *http.Request) {
 		w.Write([]byte(r.FormValue("hub.challenge")))
 		i, _ := strconv.Atoi(r.FormValue("hub.lease_seconds"))
 		f.Subscribed = time.Now().Add(time.Second * time.Duration(i))
-		gn.Put(&f)
-		log.Debugf(c, "subscribed: %v - %v - %v", fk, f.Url, f.Subscribed)
+		Store.PutFeed(c, f)
+		log.Debugf(c, "subscribed: %v - %v", f.Url, f.Subscribed)
 		return
 	} else if !f.NotViewed() {
-		log.Infof(c, "push: %v - %v", fk, f.Url)
+		log.Infof(c, "push: %v", f.Url)
 		defer r.Body.Close()
 		b, _ := ioutil.ReadAll(r.Body)
 		nf, ss, err := ParseFeed(c, r.Header.Get("Content-Type"), f.Url, f.Url, b)
@@ -231,7 +227,7 @@ func SubscribeCallback(w http.ResponseWriter, r *http.Request) {
 			log.Errorf(c, "push error: %v", err)
 		}
 	} else {
-		log.Infof(c, "not viewed - %v", fk)
+		log.Infof(c, "not viewed - %v", f.Url)
 	}
 }
 
@@ -239,15 +235,13 @@ func SubscribeCallback(w http.ResponseWriter, r *http.Request) {
 func SubscribeFeed(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
 	start := time.Now()
-	gn := goon.FromContext(c)
-	f := Feed{Url: r.FormValue("feed")}
-	fk := gn.Key(&f)
+	f, err := Store.GetFeed(c, r.FormValue("feed"))
 	s := ""
 	defer func() {
 		log.Infof(c, "SubscribeFeed - %v - start %s - f.sub %s - %s",
-			fk, start.String(), f.Subscribed.String(), s)
+			f.Url, start.String(), f.Subscribed.String(), s)
 	}()
-	if err := gn.Get(&f); err != nil {
+	if err != nil {
 		log.Errorf(c, "%v: %v", err, f.Url)
 		serveError(w, err)
 		s += "err"
@@ -275,7 +269,7 @@ func SubscribeFeed(w http.ResponseWriter, r *http.Request) {
 		log.Errorf(c, "req error: %v", err)
 	} else if resp.StatusCode != http.StatusNoContent {
 		f.Subscribed = time.Now().Add(time.Hour * 48)
-		gn.Put(&f)
+		Store.PutFeed(c, f)
 		if resp.StatusCode != http.StatusConflict {
 			log.Errorf(c, "resp: %v - %v", f.Url, resp.Status)
 			log.Errorf(c, "%s", resp.Body)
@@ -293,6 +287,10 @@ func SubscribeFeed(w http.ResponseWriter, r *http.Request) {
 func DatastoreCleanup(w http.ResponseWriter, r *http.Request) {
 	// add timeout to context?
 	c := appengine.NewContext(r)
+	// obsolete Log entities only exist in the datastore
+	if _, ok := Store.(datastoreStorage); !ok {
+		return
+	}
 	g := goon.FromContext(c)
 	limit := 2000
 	q := datastore.NewQuery(g.Kind(&Log{})).Limit(limit).KeysOnly()
@@ -316,28 +314,21 @@ func UpdateFeeds(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
 	now := time.Now()
 	limit := 10 * 60 * 2 // 10-Hz queue, 2-min cron
-	q := datastore.NewQuery("F").Filter("n <=", now).Limit(limit)
 	tctx, cancel := context.WithTimeout(c, time.Minute)
 	defer cancel()
-	it := q.Run(tctx)
+	feeds, err := Store.DueFeeds(tctx, now, limit)
+	if err != nil {
+		log.Errorf(c, "due feeds error: %v", err.Error())
+	}
 	tc := make(chan *taskqueue.Task)
 	done := make(chan bool)
 	i := 0
 	u := routeUrl("update-feed")
-	var feed Feed
-	var id string
+	hosts := make(map[string]int)
 
 	go taskSender(c, "update-feed", tc, done)
-	for {
-		k, err := it.Next(&feed)
-		if err == datastore.Done {
-			break
-		}
-		if err != nil {
-			log.Errorf(c, "next error: %v", err.Error())
-			break
-		}
-		id = k.StringID()
+	for _, feed := range feeds {
+		id := feed.Url
 		// To guard against queuing duplicate feeds,
 		// use the feed id (URL) as the task name.
 		// https://cloud.google.com/appengine/docs/go/taskqueue#Go_Task_names
@@ -348,16 +339,82 @@ func UpdateFeeds(w http.ResponseWriter, r *http.Request) {
 		newTask.Name = fmt.Sprintf("%v_%v",
 			feed.NextUpdate.UTC().Format("2006-01-02T15-04-05Z07-00"),
 			taskNameEscape(id))
+		// Spread out feeds from the same host so they don't all
+		// fire at once and get pushed back by acquireHost.
+		host := feedHost(id)
+		newTask.Delay = hostDelay(hosts[host])
+		hosts[host]++
 		log.Debugf(c, "queuing feed %v", newTask.Name)
 		tc <- newTask
 		i++
 	}
 	close(tc)
 	<-done
+	saveHostList(c, hosts)
 	log.Infof(c, "updating %d feeds", i)
 }
 
-func fetchFeed(c context.Context, origUrl, fetchUrl string) (*Feed, []*Story, error) {
+var ErrNotModified = errors.New("feed not modified")
+
+const (
+	FetchNotFound    = "not-found"
+	FetchGone        = "gone"
+	FetchDNS         = "dns"
+	FetchTLS         = "tls"
+	FetchParse       = "parse"
+	FetchTooLarge    = "too-large"
+	FetchRateLimited = "rate-limited"
+	FetchStatus      = "status"
+	FetchNetwork     = "network"
+)
+
+// FetchError is returned by fetchFeed when a feed could not be retrieved
+// or parsed. Class is one of the Fetch* constants. RetryAfter is set if
+// the server sent a Retry-After header.
+type FetchError struct {
+	Class      string
+	Err        error
+	RetryAfter time.Time
+}
+
+func (e *FetchError) Error() string {
+	return e.Err.Error()
+}
+
+// classifyNetError determines whether a transport error was caused by
+// DNS or TLS. urlfetch reports these as API errors, so the message is
+// checked as well as the error type.
+func classifyNetError(err error) string {
+	var dnsErr *net.DNSError
+	var certErr x509.UnknownAuthorityError
+	var hostErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	msg := err.Error()
+	switch {
+	case errors.As(err, &dnsErr), strings.Contains(msg, "DNS_ERROR"):
+		return FetchDNS
+	case errors.As(err, &certErr), errors.As(err, &hostErr), errors.As(err, &invalidErr),
+		strings.Contains(msg, "SSL_CERTIFICATE_ERROR"), strings.Contains(msg, "tls:"):
+		return FetchTLS
+	default:
+		return FetchNetwork
+	}
+}
+
+func fetchErrorClass(err error) string {
+	if fe, ok := err.(*FetchError); ok {
+		return fe.Class
+	}
+	return ""
+}
+
+// fetchFeed downloads and parses the feed at fetchUrl. If prev is not nil,
+// its ETag and LastModified are sent as validators to the URL they came
+// from, and ErrNotModified is returned when the server reports the feed
+// unchanged. The returned feed's MovedTo is set if fetchUrl only answered
+// with permanent redirects; with ErrNotModified, the returned feed carries
+// nothing else.
+func fetchFeed(c context.Context, origUrl, fetchUrl string, prev *Feed) (*Feed, []*Story, error) {
 	u, err := url.Parse(fetchUrl)
 	if err != nil {
 		return nil, nil, err
@@ -379,44 +436,94 @@ func fetchFeed(c context.Context, origUrl, fetchUrl string) (*Feed, []*Story, er
 		}
 	}
 
+	permanent := true
 	cl := &http.Client{
 		Transport: &urlfetch.Transport{
 			Context: c,
 		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			switch req.Response.StatusCode {
+			case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+			default:
+				permanent = false
+			}
+			return nil
+		},
 	}
-	if resp, err := cl.Get(fetchUrl); err == nil && resp.StatusCode == http.StatusOK {
+	movedTo := func(resp *http.Response) string {
+		if permanent && origUrl == fetchUrl && resp.Request.URL.String() != fetchUrl {
+			return resp.Request.URL.String()
+		}
+		return ""
+	}
+	req, err := http.NewRequest("GET", fetchUrl, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	if prev != nil && prev.ValidatorUrl == fetchUrl {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+	if resp, err := cl.Do(req); err == nil && resp.StatusCode == http.StatusOK {
 		const sz = 1 << 21
 		reader := &io.LimitedReader{R: resp.Body, N: sz}
 		defer resp.Body.Close()
 		b, err := ioutil.ReadAll(reader)
 		if err != nil {
-			return nil, nil, err
+			return nil, nil, &FetchError{Class: FetchNetwork, Err: err}
 		}
 		if reader.N == 0 {
-			return nil, nil, fmt.Errorf("feed larger than %d bytes", sz)
+			return nil, nil, &FetchError{Class: FetchTooLarge, Err: fmt.Errorf("feed larger than %d bytes", sz)}
 		}
-		if autoUrl, err := Autodiscover(b); err == nil && origUrl == fetchUrl {
-			if autoU, err := url.Parse(autoUrl); err == nil {
-				if autoU.Scheme == "" {
-					autoU.Scheme = u.Scheme
-				}
-				if autoU.Host == "" {
-					autoU.Host = u.Host
-				}
-				autoUrl = autoU.String()
-			}
-			if autoUrl != fetchUrl {
-				return fetchFeed(c, origUrl, autoUrl)
+		if links, err := Autodiscover(resp.Request.URL, b); err == nil && origUrl == fetchUrl {
+			if autoUrl := links[0].Url; autoUrl != fetchUrl {
+				return fetchFeed(c, origUrl, autoUrl, prev)
 			}
 		}
-		return ParseFeed(c, resp.Header.Get("Content-Type"), origUrl, fetchUrl, b)
+		feed, stories, err := ParseFeed(c, resp.Header.Get("Content-Type"), origUrl, fetchUrl, b)
+		if err != nil {
+			return nil, nil, &FetchError{Class: FetchParse, Err: err}
+		}
+		if feed != nil {
+			feed.ETag = resp.Header.Get("ETag")
+			feed.LastModified = resp.Header.Get("Last-Modified")
+			feed.ValidatorUrl = fetchUrl
+			feed.MovedTo = movedTo(resp)
+		}
+		return feed, stories, err
+	} else if err == nil && resp.StatusCode == http.StatusNotModified {
+		resp.Body.Close()
+		return &Feed{Url: origUrl, MovedTo: movedTo(resp)}, nil, ErrNotModified
 	} else if err != nil {
 		log.Warningf(c, "fetch feed error: %v", err)
-		return nil, nil, fmt.Errorf("Could not fetch feed")
+		return nil, nil, &FetchError{Class: classifyNetError(err), Err: fmt.Errorf("Could not fetch feed")}
 	} else {
 		log.Warningf(c, "fetch feed error: status code: %s %s",
 			resp.Status, resp.Body)
-		return nil, nil, fmt.Errorf("Bad response code from server")
+		resp.Body.Close()
+		fe := &FetchError{
+			Class: FetchStatus,
+			Err:   fmt.Errorf("Bad response code from server: %s", resp.Status),
+		}
+		switch resp.StatusCode {
+		case http.StatusNotFound:
+			fe.Class = FetchNotFound
+		case http.StatusGone:
+			fe.Class = FetchGone
+		case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+			fe.Class = FetchRateLimited
+		}
+		if t, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+			fe.RetryAfter = t
+		}
+		return nil, nil, fe
 	}
 }
 
@@ -424,12 +531,17 @@ func updateFeed(c context.Context, url string, feed *Feed, stories []*Story, upd
 	// TODO this used to have a 1-min timeout
 	// but I'm confused about datastore context vs goon
 	// godoc.org/cloud.google.com/go/datastore
-	gn := goon.FromContext(c)
-	f := Feed{Url: url}
-	if err := gn.Get(&f); err != nil {
+	old, err := Store.GetFeed(c, url)
+	if err != nil {
 		return fmt.Errorf("feed not found: %s", url)
 	}
-	log.Debugf(c, "feed update: %v", gn.Key(&f))
+	f := *old
+	log.Debugf(c, "feed update: %v", url)
+	if old.Migrated {
+		// Hub pushes and admin refetches bypass UpdateFeed's check.
+		log.Infof(c, "feed %v migrated to %v, not updating", url, old.MovedTo)
+		return nil
+	}
 
 	// Compare the feed's listed update to the story's update.
 	// Note: these may not be accurate, hence, only compare them to each other,
@@ -444,7 +556,17 @@ func updateFeed(c context.Context, url string, feed *Feed, stories []*Story, upd
 	feed.Date = f.Date
 	feed.Average = f.Average
 	feed.LastViewed = f.LastViewed
+	movedTo := feed.MovedTo
+	feed.MovedTo = f.MovedTo
+	feed.MovedCount = f.MovedCount
+	feed.Migrated = f.Migrated
+	feed.Image = f.Image
+	feed.ImageDate = f.ImageDate
+	feed.Subscribed = f.Subscribed
 	f = *feed
+	if !fromSub {
+		noteRedirect(c, &f, movedTo)
+	}
 	if updateLast {
 		f.LastViewed = time.Now()
 	}
@@ -453,28 +575,31 @@ func updateFeed(c context.Context, url string, feed *Feed, stories []*Story, upd
 		log.Infof(c, "feed %s already updated to %v, putting", url, feed.Updated)
 		f.Updated = time.Now()
 		scheduleNextUpdate(c, &f)
-		gn.Put(&f)
+		Store.PutFeed(c, &f)
 		return nil
 	}
 
 	log.Debugf(c, "hasUpdate: %v, isFeedUpdated: %v, storyDate: %v, stories: %v", hasUpdated, isFeedUpdated, storyDate, len(stories))
-	puts := []interface{}{&f}
 
 	// find non existant stories
-	fk := gn.Key(&f)
-	getStories := make([]*Story, len(stories))
+	ids := make([]readStory, len(stories))
 	for i, s := range stories {
-		getStories[i] = &Story{Id: s.Id, Parent: fk}
+		s.Feed = f.Url
+		ids[i] = readStory{Feed: f.Url, Story: s.Id}
 	}
-	err := gn.GetMulti(getStories)
-	if _, ok := err.(appengine.MultiError); err != nil && !ok {
-		log.Errorf(c, "GetMulti error: %v", err)
+	getStories, err := Store.GetStories(c, ids)
+	if err != nil {
+		log.Errorf(c, "GetStories error: %v", err)
 		return err
 	}
 	var updateStories []*Story
+	var failures []string
+	newStories := 0
 	for i, s := range getStories {
-		if goon.NotFound(err, i) {
+		if s == nil {
 			updateStories = append(updateStories, stories[i])
+			failures = append(failures, stories[i].dateFailures...)
+			newStories++
 		} else if (!stories[i].Updated.IsZero() && !stories[i].Updated.Equal(s.Updated)) || updateAll {
 			if !s.Created.IsZero() {
 				stories[i].Created = s.Created
@@ -487,30 +612,14 @@ func updateFeed(c context.Context, url string, feed *Feed, stories []*Story, upd
 	}
 	log.Debugf(c, "%v update stories", len(updateStories))
 
-	for _, s := range updateStories {
-		puts = append(puts, s)
-		sc := StoryContent{
-			Id:     1,
-			Parent: gn.Key(s),
-		}
-		buf := &bytes.Buffer{}
-		if gz, err := gzip.NewWriterLevel(buf, gzip.BestCompression); err == nil {
-			gz.Write([]byte(s.content))
-			gz.Close()
-			sc.Compressed = buf.Bytes()
-		}
-		if len(sc.Compressed) == 0 {
-			sc.Content = s.content
-		}
-		if _, err := gn.Put(&sc); err != nil {
-			log.Errorf(c, "put sc err: %v", err)
-			return err
-		}
+	if newStories > 0 {
+		// The feed's own dates are reparsed every poll, so only count
+		// them along with new stories.
+		recordDateFailures(c, f.Url, append(f.dateFailures, failures...))
 	}
 
-	log.Debugf(c, "putting %v entities", len(puts))
-	if len(puts) > 1 {
-		updateAverage(&f, f.Date, len(puts)-1)
+	if len(updateStories) > 0 {
+		updateAverage(&f, f.Date, len(updateStories))
 		f.Date = time.Now()
 		if !hasUpdated {
 			f.Updated = f.Date
@@ -525,7 +634,11 @@ func updateFeed(c context.Context, url string, feed *Feed, stories []*Story, upd
 	}
 	delay := f.NextUpdate.Sub(time.Now())
 	log.Infof(c, "next update scheduled for %v from now", delay-delay%time.Second)
-	_, err = gn.PutMulti(puts)
+	if err := Store.PutStories(c, updateStories, true); err != nil {
+		log.Errorf(c, "put stories err: %v", err)
+		return err
+	}
+	err = Store.PutFeed(c, &f)
 	if err != nil {
 		log.Errorf(c, "update put err: %v", err)
 	}
@@ -534,7 +647,6 @@ func updateFeed(c context.Context, url string, feed *Feed, stories []*Story, upd
 
 func UpdateFeed(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
-	gn := goon.FromContext(c)
 	url := r.FormValue("feed")
 	if url == "" {
 		log.Errorf(c, "empty update feed")
@@ -542,18 +654,28 @@ func UpdateFeed(w http.ResponseWriter, r *http.Request) {
 	}
 	log.Debugf(c, "update feed %s", url)
 	last := len(r.FormValue("last")) > 0
-	f := Feed{Url: url}
+	f, err := Store.GetFeed(c, url)
 	s := ""
 	defer func() {
-		log.Debugf(c, "UpdateFeed:%v - %s", gn.Key(&f), s)
+		log.Debugf(c, "UpdateFeed:%v - %s", url, s)
 	}()
-	if err := gn.Get(&f); err == datastore.ErrNoSuchEntity {
+	if err == ErrNotFound {
 		log.Errorf(c, "no such entity - "+url)
 		s += "NSE"
 		return
 	} else if err != nil {
 		s += "err - " + err.Error()
 		return
+	} else if f.Migrated {
+		s += "migrated"
+		return
+	} else if f.ErrorClass == FetchGone {
+		s += "gone"
+		if last {
+			f.LastViewed = time.Now()
+			Store.PutFeed(c, f)
+		}
+		return
 	} else if last {
 		// noop
 	} else if time.Now().Before(f.NextUpdate) {
@@ -561,10 +683,32 @@ func UpdateFeed(w http.ResponseWriter, r *http.Request) {
 		s += "already updated"
 		return
 	}
+	if until := hostCooldown(c, feedHost(f.Url)); time.Now().Before(until) {
+		s += "host cooldown"
+		f.NextUpdate = until
+		if last {
+			f.LastViewed = time.Now()
+		}
+		Store.PutFeed(c, f)
+		return
+	}
+	release, ok := acquireHost(c, feedHost(f.Url))
+	if !ok {
+		s += "host busy"
+		f.NextUpdate = hostPushbackTime()
+		if last {
+			f.LastViewed = time.Now()
+		}
+		Store.PutFeed(c, f)
+		return
+	}
+	defer release()
 
 	feedError := func(err error) {
 		s += "feed err - " + err.Error()
 		f.Errors++
+		f.ErrorClass = fetchErrorClass(err)
+		f.ErrorMessage = err.Error()
 		v := f.Errors + 1
 		const max = 24 * 7
 		if v > max {
@@ -573,16 +717,42 @@ func UpdateFeed(w http.ResponseWriter, r *http.Request) {
 			v = 0
 		}
 		f.NextUpdate = time.Now().Add(time.Hour * time.Duration(v))
-		gn.Put(&f)
+		if fe, ok := err.(*FetchError); ok {
+			if fe.RetryAfter.After(f.NextUpdate) {
+				f.NextUpdate = fe.RetryAfter
+			}
+			if fe.Class == FetchRateLimited {
+				noteRateLimited(c, feedHost(f.Url), fe.RetryAfter)
+			}
+		}
+		if f.ErrorClass == FetchGone {
+			// the server says the feed will not come back, so stop polling
+			f.NextUpdate = timeMax
+		}
+		Store.PutFeed(c, f)
 		log.Warningf(c, "error with %v (%v), bump next update to %v, %v", url, f.Errors, f.NextUpdate, err)
 	}
 
-	if feed, stories, err := fetchFeed(c, f.Url, f.Url); err == nil {
+	if feed, stories, err := fetchFeed(c, f.Url, f.Url, f); err == nil {
 		if err := updateFeed(c, f.Url, feed, stories, false, false, last); err != nil {
 			feedError(err)
 		} else {
 			s += "success"
 		}
+	} else if err == ErrNotModified {
+		s += "not modified"
+		noteRedirect(c, f, feed.MovedTo)
+		f.Errors = 0
+		f.ErrorClass = ""
+		f.ErrorMessage = ""
+		f.Checked = time.Now()
+		if last {
+			f.LastViewed = time.Now()
+		}
+		scheduleNextUpdate(c, f)
+		if err := Store.PutFeed(c, f); err != nil {
+			log.Errorf(c, "not modified put err: %v", err)
+		}
 	} else {
 		feedError(err)
 	}
@@ -591,15 +761,14 @@ func UpdateFeed(w http.ResponseWriter, r *http.Request) {
 
 func UpdateFeedLast(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
-	gn := goon.FromContext(c)
 	url := r.FormValue("feed")
 	log.Debugf(c, "update feed last %s", url)
-	f := Feed{Url: url}
-	if err := gn.Get(&f); err != nil {
+	f, err := Store.GetFeed(c, url)
+	if err != nil {
 		return
 	}
 	f.LastViewed = time.Now()
-	gn.Put(&f)
+	Store.PutFeed(c, f)
 }
 
 func DeleteBlobs(c context.Context, w http.ResponseWriter, r *http.Request) {
@@ -643,28 +812,18 @@ func DeleteBlobs(c context.Context, w http.ResponseWriter, r *http.Request) {
 
 func DeleteOldFeeds(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
-	gn := goon.FromContext(c)
-	q := datastore.NewQuery(gn.Kind(&Feed{})).Filter("n=", timeMax).KeysOnly()
-	if cur, err := datastore.DecodeCursor(r.FormValue("c")); err == nil {
-		q = q.Start(cur)
-	}
 	tctx, cancel := context.WithTimeout(c, time.Minute)
 	defer cancel()
-	it := q.Run(tctx)
-	done := false
+	const limit = 100
+	urls, cur, err := Store.FeedUrls(tctx, timeMax, Page{Cursor: r.FormValue("c"), Limit: limit})
+	if err != nil {
+		log.Errorf(c, "err: %v", err)
+		return
+	}
 	var tasks []*taskqueue.Task
-	for i := 0; i < 10000 && len(tasks) < 100; i++ {
-		k, err := it.Next(nil)
-		if err == datastore.Done {
-			log.Criticalf(c, "done")
-			done = true
-			break
-		} else if err != nil {
-			log.Errorf(c, "err: %v", err)
-			continue
-		}
+	for _, u := range urls {
 		values := make(url.Values)
-		values.Add("f", k.StringID())
+		values.Add("f", u)
 		tasks = append(tasks, taskqueue.NewPOSTTask("/tasks/delete-old-feed", values))
 	}
 	if len(tasks) > 0 {
@@ -673,57 +832,36 @@ func DeleteOldFeeds(w http.ResponseWriter, r *http.Request) {
 			log.Errorf(c, "err: %v", err)
 		}
 	}
-	if !done {
-		if cur, err := it.Cursor(); err == nil {
-			values := make(url.Values)
-			values.Add("c", cur.String())
-			taskqueue.Add(c, taskqueue.NewPOSTTask("/tasks/delete-old-feeds", values), "")
-		} else {
-			log.Errorf(c, "err: %v", err)
-		}
+	if len(urls) < limit {
+		log.Criticalf(c, "done")
+		return
 	}
+	values := make(url.Values)
+	values.Add("c", cur)
+	taskqueue.Add(c, taskqueue.NewPOSTTask("/tasks/delete-old-feeds", values), "")
 }
 
 func DeleteOldFeed(w http.ResponseWriter, r *http.Request) {
-	// TODO this used to have a 1-min timeout
-	// but I'm confused about datastore context vs goon
-	// godoc.org/cloud.google.com/go/datastore
 	c := appengine.NewContext(r)
-	g := goon.FromContext(c)
 	oldDate := time.Now().Add(-time.Hour * 24 * 90)
-	feed := Feed{Url: r.FormValue("f")}
-	if err := g.Get(&feed); err != nil {
+	feed, err := Store.GetFeed(c, r.FormValue("f"))
+	if err != nil {
 		log.Criticalf(c, "err: %v", err)
 		return
 	}
 	if feed.LastViewed.After(oldDate) {
 		return
 	}
-	q := datastore.NewQuery(g.Kind(&Story{})).Ancestor(g.Key(&feed)).KeysOnly()
 	tctx, cancel := context.WithTimeout(c, time.Minute)
 	defer cancel()
-	keys, err := q.GetAll(tctx, nil)
-	if err != nil {
-		log.Criticalf(c, "err: %v", err)
-		return
-	}
-	q = datastore.NewQuery(g.Kind(&StoryContent{})).Ancestor(g.Key(&feed)).KeysOnly()
-	sckeys, err := q.GetAll(tctx, nil)
+	n, err := Store.DeleteStories(tctx, feed.Url)
 	if err != nil {
 		log.Criticalf(c, "err: %v", err)
 		return
 	}
-	keys = append(keys, sckeys...)
-	log.Infof(c, "delete: %v - %v", feed.Url, len(keys))
+	log.Infof(c, "delete: %v - %v", feed.Url, n)
 	feed.NextUpdate = timeMax.Add(time.Hour)
-	if _, err := g.Put(&feed); err != nil {
+	if err := Store.PutFeed(c, feed); err != nil {
 		log.Criticalf(c, "put err: %v", err)
 	}
-	if len(keys) == 0 {
-		return
-	}
-	err = g.DeleteMulti(keys)
-	if err != nil {
-		log.Criticalf(c, "err: %v", err)
-	}
 }
@@ -0,0 +1,224 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msde/goread/platform/taskqueue"
+)
+
+// update fetches the feed of s and stores it with updateFeed.
+func update(t *testing.T, s *feedServer) {
+	t.Helper()
+	c := context.Background()
+	f, err := Store.GetFeed(c, s.feedUrl())
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, stories, err := fetchFeed(c, f.Url, f.Url, f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := updateFeed(c, f.Url, feed, stories, false, false, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateFeed(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		now := time.Now()
+		s := newFeedServer(testItem{"1", now.Add(-time.Hour * 2)})
+		defer s.Close()
+		subscribe(t, s)
+		c := context.Background()
+		old, _ := Store.GetStories(c, []readStory{{Feed: s.feedUrl(), Story: "1"}})
+
+		s.add(testItem{"2", now.Add(-time.Hour)})
+		update(t, s)
+		stories, _, err := Store.FeedStories(c, s.feedUrl(), StoryQuery{})
+		if err != nil || len(stories) != 2 {
+			t.Fatalf("stories: %v, %v", stories, err)
+		}
+		for _, st := range stories {
+			if st.Id == "1" && !st.Created.Equal(old[0].Created) {
+				t.Errorf("created changed: %v -> %v", old[0].Created, st.Created)
+			}
+		}
+		if contents, _ := Store.StoryContents(c, []readStory{{Feed: s.feedUrl(), Story: "2"}}); contents[0] != "story 2" {
+			t.Errorf("content: %q", contents[0])
+		}
+		f, _ := Store.GetFeed(c, s.feedUrl())
+		if !f.NextUpdate.After(now) || f.Date.Before(now) || f.Average == 0 {
+			t.Errorf("feed: %+v", f)
+		}
+	})
+}
+
+func TestUpdateMigratedFeed(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := newFeedServer(testItem{"1", time.Now().Add(-time.Hour)})
+		defer s.Close()
+		subscribe(t, s)
+		c := context.Background()
+		f, _ := Store.GetFeed(c, s.feedUrl())
+		f.Migrated = true
+		f.MovedTo = "http://example.com/new"
+		f.NextUpdate = timeMax
+		Store.PutFeed(c, f)
+
+		// As a hub push would.
+		s.add(testItem{"2", time.Now()})
+		feed, stories, err := fetchFeed(c, f.Url, f.Url, f)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := updateFeed(c, f.Url, feed, stories, false, true, false); err != nil {
+			t.Fatal(err)
+		}
+		f, _ = Store.GetFeed(c, s.feedUrl())
+		if !f.Migrated || !f.NextUpdate.Equal(timeMax) {
+			t.Errorf("feed: migrated %v, next update %v", f.Migrated, f.NextUpdate)
+		}
+		if ss, _, _ := Store.FeedStories(c, f.Url, StoryQuery{}); len(ss) != 1 {
+			t.Errorf("%v stories stored", len(ss))
+		}
+	})
+}
+
+func TestUpdateFeedKeepsIcon(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := newFeedServer(testItem{"1", time.Now().Add(-time.Hour * 2)})
+		defer s.Close()
+		subscribe(t, s)
+		s.add(testItem{"2", time.Now().Add(-time.Hour)})
+		update(t, s)
+		s.add(testItem{"3", time.Now()})
+		update(t, s)
+		if n, m := s.count("/"), s.count("/icon.png"); n != 1 || m != 1 {
+			t.Errorf("page fetched %v times, icon %v times", n, m)
+		}
+		f, _ := Store.GetFeed(context.Background(), s.feedUrl())
+		if f.Image == "" || !f.ImageDate.After(time.Now()) {
+			t.Errorf("image %q, date %v", f.Image, f.ImageDate)
+		}
+	})
+}
+
+// runTasks runs tasks from now on in a Pool with the queues of queue.yaml,
+// as the standalone server does.
+func runTasks(t *testing.T) *taskqueue.Pool {
+	t.Helper()
+	b, err := ioutil.ReadFile("app/queue.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	queues, err := taskqueue.ParseQueues(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := taskqueue.NewPool(testRouter, 4, queues)
+	taskqueue.Default = p
+	return p
+}
+
+func TestUpdateFeeds(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		now := time.Now()
+		s := newFeedServer(testItem{"1", now.Add(-time.Hour)})
+		defer s.Close()
+		subscribe(t, s)
+		c := context.Background()
+		f, _ := Store.GetFeed(c, s.feedUrl())
+		f.NextUpdate = now.Add(-time.Minute)
+		Store.PutFeed(c, f)
+		s.add(testItem{"2", now})
+
+		p := runTasks(t)
+		serve(t, UpdateFeeds, "", "/tasks/update-feeds", nil)
+		p.Wait()
+		if n := s.count("/feed"); n != 2 {
+			t.Errorf("feed fetched %v times", n)
+		}
+		if ids := listFeeds(t, s); !equalIds(ids, "1", "2") {
+			t.Errorf("unread: %v", ids)
+		}
+		if f, _ := Store.GetFeed(c, s.feedUrl()); !f.NextUpdate.After(now) {
+			t.Errorf("next update: %v", f.NextUpdate)
+		}
+
+		// A feed that isn't due isn't queued.
+		serve(t, UpdateFeeds, "", "/tasks/update-feeds", nil)
+		p.Wait()
+		if n := s.count("/feed"); n != 2 {
+			t.Errorf("feed fetched %v times", n)
+		}
+	})
+}
+
+func TestFetchFeedValidators(t *testing.T) {
+	const lastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		// Both answer any conditional request as unchanged.
+		if r.Header.Get("If-Modified-Since") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("Last-Modified", lastModified)
+		switch r.URL.Path {
+		case "/page":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprint(w, `<html><head><link rel="alternate" type="application/rss+xml" href="/feed"></head></html>`)
+		case "/feed":
+			w.Header().Set("Content-Type", "application/rss+xml")
+			fmt.Fprint(w, `<?xml version="1.0"?><rss version="2.0"><channel><title>Test</title><item><guid>1</guid><title>1</title></item></channel></rss>`)
+		}
+	}))
+	defer srv.Close()
+	c := context.Background()
+	page := srv.URL + "/page"
+
+	f, _, err := fetchFeed(c, page, page, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.LastModified != lastModified || f.ValidatorUrl != srv.URL+"/feed" {
+		t.Fatalf("validators %q from %q", f.LastModified, f.ValidatorUrl)
+	}
+
+	// The page gets no validators, so its feed is still asked for.
+	if _, _, err := fetchFeed(c, page, page, f); err != ErrNotModified {
+		t.Errorf("got %v, want ErrNotModified", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if hits["/page"] != 2 || hits["/feed"] != 2 {
+		t.Errorf("hits: %v", hits)
+	}
+}
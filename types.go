@@ -21,18 +21,15 @@ import (
 	"compress/gzip"
 	"context"
 	"encoding/base64"
-	"fmt"
 	"io/ioutil"
 	"net/url"
 	"time"
 
-	"github.com/mjibson/goon"
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/taskqueue"
 
 	"google.golang.org/appengine"
 	"google.golang.org/appengine/datastore"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/taskqueue"
-	"google.golang.org/appengine/user"
 )
 
 type User struct {
@@ -100,27 +97,50 @@ type UserStar struct {
 	Id      string         `datastore:"-" goon:"id"`
 	Parent  *datastore.Key `datastore:"-" goon:"parent"`
 	Created time.Time      `datastore:"c"`
+
+	Feed  string `datastore:"-"`
+	Story string `datastore:"-"`
 }
 
-func starKey(c context.Context, feed, story string) *UserStar {
-	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := User{Id: cu.ID}
-	uk := gn.Key(&u)
-	return &UserStar{
-		Parent: datastore.NewKey(c, "USF", feed, 0, uk),
-		Id:     story,
-	}
+// parent: UserReadFeed (kind URF, key: Feed.Url), key: Story.Id
+type UserRead struct {
+	_kind   string         `goon:"kind,UR"`
+	Id      string         `datastore:"-" goon:"id"`
+	Parent  *datastore.Key `datastore:"-" goon:"parent"`
+	Created time.Time      `datastore:"c"`
+	// Undo token of the MarkAllRead that marked the story, if any.
+	Undo string `datastore:"u,noindex"`
+
+	Feed  string `datastore:"-"`
+	Story string `datastore:"-"`
 }
 
-func starID(key *datastore.Key) string {
-	return fmt.Sprintf("%s|%s", key.Parent().StringID(), key.StringID())
+// parent: UserPlaybackFeed (kind UPF, key: Feed.Url), key: Story.Id
+type UserPlayback struct {
+	_kind     string         `goon:"kind,UP"`
+	Id        string         `datastore:"-" goon:"id" json:"-"`
+	Parent    *datastore.Key `datastore:"-" goon:"parent" json:"-"`
+	Position  float64        `datastore:"p,noindex"`
+	Duration  float64        `datastore:"d,noindex"`
+	Completed bool           `datastore:"o,noindex"`
+	Updated   time.Time      `datastore:"u"`
+
+	Feed  string `datastore:"-"`
+	Story string `datastore:"-"`
+}
+
+// setIds fills Feed and Story from the key of a loaded playback.
+func (p *UserPlayback) setIds() {
+	p.Feed = p.Parent.StringID()
+	p.Story = p.Id
 }
 
 type readStory struct {
 	Feed, Story string
 }
 
+// Read is the gob-encoded UserData.Read that kept read stories before
+// UserRead. It is only decoded to migrate it.
 type Read map[readStory]bool
 
 type Feed struct {
@@ -140,12 +160,46 @@ type Feed struct {
 	Average    time.Duration `datastore:"a,noindex" json:"-"`
 	LastViewed time.Time     `datastore:"v" json:"-"`
 	NoAds      bool          `datastore:"o,noindex" json:"-"`
+
+	// HTTP validators from the last successful fetch, used for conditional GETs,
+	// and the URL they came from, which differs from Url for autodiscovered feeds.
+	ETag         string `datastore:"et,noindex" json:"-"`
+	LastModified string `datastore:"lm,noindex" json:"-"`
+	ValidatorUrl string `datastore:"vu,noindex" json:"-"`
+
+	// Target of consecutive permanent redirects, see noteRedirect.
+	MovedTo    string `datastore:"mt,noindex" json:"-"`
+	MovedCount int    `datastore:"mc,noindex" json:"-"`
+	Migrated   bool   `datastore:"mg,noindex" json:"-"`
+
+	// Class and message of the last fetch error, see FetchError.
+	ErrorClass   string `datastore:"ec,noindex" json:",omitempty"`
+	ErrorMessage string `datastore:"em,noindex" json:",omitempty"`
+	Health       string `datastore:"-"`
+
+	// Publisher update hints, see applyUpdateHints.
+	TTL          time.Duration `datastore:"tl,noindex" json:"-"`
+	UpdatePeriod time.Duration `datastore:"up,noindex" json:"-"`
+	UpdateBase   time.Time     `datastore:"ub,noindex" json:"-"`
+	SkipHours    []int         `datastore:"sh,noindex" json:"-"`
+	SkipDays     []int         `datastore:"sd,noindex" json:"-"`
+
+	// Link to older entries (RFC 5005), used to backfill new feeds.
+	ArchiveLink string `datastore:"al,noindex" json:"-"`
+
+	Author Person `datastore:"fa,noindex"`
+
+	// Declared or detected language, and "rtl" for right-to-left scripts.
+	Language string `datastore:"lg,noindex" json:",omitempty"`
+	Dir      string `datastore:"dr,noindex" json:",omitempty"`
+
+	// dates parseDate couldn't parse, see recordDateFailures
+	dateFailures []string
 }
 
 func (f *Feed) Subscribe(c context.Context) {
 	if !f.IsSubscribed() {
-		gn := goon.FromContext(c)
-		log.Debugf(c, "Subscribe %v %v", gn.Key(&f), f.Subscribed.String())
+		log.Debugf(c, "Subscribe %v %v", f.Url, f.Subscribed.String())
 		t := taskqueue.NewPOSTTask(routeUrl("subscribe-feed"), url.Values{
 			"feed": {f.Url},
 		})
@@ -161,6 +215,12 @@ func (f *Feed) IsSubscribed() bool {
 	return !ENABLE_PUBSUBHUBBUB || f.Hub == "" || time.Now().Before(f.Subscribed)
 }
 
+// IconURL is where the feed's stored icon is served.
+func (f *Feed) IconURL() string {
+	ru, _ := router.Get("icon").URL("feed", base64.URLEncoding.EncodeToString([]byte(f.Url)))
+	return ru.String()
+}
+
 func (f *Feed) PubSubURL() string {
 	b := base64.URLEncoding.EncodeToString([]byte(f.Url))
 	ru, _ := router.Get("subscribe-callback").URL()
@@ -176,6 +236,30 @@ func (f *Feed) NotViewed() bool {
 	return time.Since(f.LastViewed) > notViewedDisabled
 }
 
+const (
+	HealthOK     = "ok"
+	HealthError  = "error"
+	HealthBroken = "broken"
+	HealthGone   = "gone"
+)
+
+// Consecutive fetch errors after which a feed is reported as broken.
+const feedBrokenErrors = 10
+
+// health summarizes the fetch status of f for display.
+func (f *Feed) health() string {
+	switch {
+	case f.ErrorClass == FetchGone:
+		return HealthGone
+	case f.Errors >= feedBrokenErrors:
+		return HealthBroken
+	case f.Errors > 0:
+		return HealthError
+	default:
+		return HealthOK
+	}
+}
+
 // parent: Feed, key: story ID
 type Story struct {
 	_kind        string         `goon:"kind,S"`
@@ -190,8 +274,52 @@ type Story struct {
 	Author       string         `datastore:"a,noindex" json:",omitempty"`
 	Summary      string         `datastore:"s,noindex"`
 	MediaContent string         `datastore:"m,noindex" json:",omitempty"`
-
+	Thumbnail    string         `datastore:"th,noindex" json:",omitempty"`
+	Categories   []string       `datastore:"ca,noindex" json:",omitempty"`
+	CategoryKeys []string       `datastore:"ck" json:"-"`
+	CommentsLink string         `datastore:"cl,noindex" json:",omitempty"`
+	CommentsFeed string         `datastore:"cf,noindex" json:",omitempty"`
+	CommentCount int            `datastore:"cn,noindex" json:",omitempty"`
+	InReplyTo    string         `datastore:"ir,noindex" json:",omitempty"`
+	Authors      []Person       `datastore:"au,noindex" json:",omitempty"`
+	AuthorKeys   []string       `datastore:"ak" json:"-"`
+	Language     string         `datastore:"lg,noindex" json:",omitempty"`
+	Dir          string         `datastore:"dr,noindex" json:",omitempty"`
+
+	// Podcast episode data, see podcast.go.
+	Enclosures  []Enclosure  `datastore:"en,noindex" json:",omitempty"`
+	Duration    int64        `datastore:"du,noindex" json:",omitempty"`
+	Image       string       `datastore:"im,noindex" json:",omitempty"`
+	Episode     int          `datastore:"ep,noindex" json:",omitempty"`
+	Season      int          `datastore:"se,noindex" json:",omitempty"`
+	Explicit    bool         `datastore:"ex,noindex" json:",omitempty"`
+	Chapters    string       `datastore:"ch,noindex" json:",omitempty"`
+	Transcripts []Transcript `datastore:"tr,noindex" json:",omitempty"`
+
+	Feed    string `datastore:"-" json:"-"`
 	content string
+
+	// dates parseDate couldn't parse, see recordDateFailures
+	dateFailures []string
+}
+
+type Person struct {
+	Name        string `datastore:"n,noindex" json:",omitempty"`
+	Uri         string `datastore:"u,noindex" json:",omitempty"`
+	Email       string `datastore:"e,noindex" json:",omitempty"`
+	Contributor bool   `datastore:"c,noindex" json:",omitempty"`
+}
+
+type Enclosure struct {
+	Url    string `datastore:"u,noindex"`
+	Type   string `datastore:"t,noindex"`
+	Length int64  `datastore:"l,noindex" json:",omitempty"`
+}
+
+type Transcript struct {
+	Url      string `datastore:"u,noindex"`
+	Type     string `datastore:"t,noindex"`
+	Language string `datastore:"g,noindex" json:",omitempty"`
 }
 
 const IDX_COL = "c"
@@ -234,11 +362,60 @@ type Opml struct {
 	Outline []*OpmlOutline `xml:"body>outline"`
 }
 
+// feedUrls returns the set of feeds subscribed to in o.
+func (o *Opml) feedUrls() map[string]bool {
+	urls := make(map[string]bool)
+	for _, ol := range o.Outline {
+		if ol.XmlUrl != "" {
+			urls[ol.XmlUrl] = true
+		}
+		for _, so := range ol.Outline {
+			if so.XmlUrl != "" {
+				urls[so.XmlUrl] = true
+			}
+		}
+	}
+	return urls
+}
+
+// folderUrls returns the feeds in the folder with title in o.
+func (o *Opml) folderUrls(title string) []string {
+	var urls []string
+	for _, ol := range o.Outline {
+		if ol.XmlUrl != "" || ol.Title != title {
+			continue
+		}
+		for _, so := range ol.Outline {
+			if so.XmlUrl != "" {
+				urls = append(urls, so.XmlUrl)
+			}
+		}
+	}
+	return urls
+}
+
+// key: hex SHA-1 of Feed + "|" + Raw
+type DateFailure struct {
+	_kind string    `goon:"kind,DF"`
+	Id    string    `datastore:"-" goon:"id"`
+	Feed  string    `datastore:"f,noindex"`
+	Raw   string    `datastore:"r,noindex"`
+	Shape string    `datastore:"s,noindex"`
+	Count int       `datastore:"c,noindex"`
+	First time.Time `datastore:"t,noindex"`
+	Last  time.Time `datastore:"l"`
+}
+
+// Image is a feed's icon, resized and stored as PNG. Id is the feed URL and
+// Url where the icon was found.
 type Image struct {
-	_kind string            `goon:"kind,I"`
-	Id    string            `datastore:"-" goon:"id"`
-	Blob  appengine.BlobKey `datastore:"b,noindex"`
-	Url   string            `datastore:"u,noindex"`
+	_kind   string            `goon:"kind,I"`
+	Id      string            `datastore:"-" goon:"id"`
+	Blob    appengine.BlobKey `datastore:"b,noindex"`
+	Url     string            `datastore:"u,noindex"`
+	Data    []byte            `datastore:"d,noindex"`
+	Type    string            `datastore:"t,noindex"`
+	Updated time.Time         `datastore:"m,noindex"`
 }
 
 type Stories []*Story
@@ -21,7 +21,6 @@ import (
 	"bytes"
 	"compress/gzip"
 	"context"
-	"encoding/gob"
 	"encoding/json"
 	"encoding/xml"
 	"fmt"
@@ -34,28 +33,24 @@ import (
 	"sync"
 	"time"
 
-	"github.com/mjibson/goon"
 	"github.com/msde/go-charset/charset"
 	_ "github.com/msde/go-charset/data"
+	"github.com/msde/goread/platform/blobstore"
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/taskqueue"
+	"github.com/msde/goread/platform/user"
 	"github.com/msde/goread/sanitizer"
 
 	"google.golang.org/appengine"
-	"google.golang.org/appengine/blobstore"
-	"google.golang.org/appengine/datastore"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/taskqueue"
-	"google.golang.org/appengine/user"
 )
 
 func LoginGoogle(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
 	if cu := user.Current(c); cu != nil {
-		gn := goon.FromContext(c)
-		u := &User{Id: cu.ID}
-		if err := gn.Get(u); err == datastore.ErrNoSuchEntity {
+		if u, err := Store.GetUser(c, cu.ID); err == ErrNotFound {
 			u.Email = cu.Email
 			u.Read = time.Now().Add(-time.Hour * 24)
-			gn.Put(u)
+			Store.PutUser(c, u)
 		}
 	}
 
@@ -98,9 +93,7 @@ func UploadUrl(w http.ResponseWriter, r *http.Request) {
 func ImportOpml(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := User{Id: cu.ID}
-	if err := gn.Get(&u); err != nil {
+	if _, err := Store.GetUser(c, cu.ID); err != nil {
 		serveError(w, err)
 		return
 	}
@@ -168,27 +161,55 @@ func AddSubscription(w http.ResponseWriter, r *http.Request) {
 	backupOPML(c)
 	cu := user.Current(c)
 	url := r.FormValue("url")
+	var feed *Feed
+	var stories []*Story
+	if _, err := Store.GetFeed(c, url); err != nil {
+		// An unknown URL may be a page offering several feeds.
+		var links []*FeedLink
+		links, feed, stories, err = discoverFeeds(c, url)
+		if err != nil {
+			log.Warningf(c, "discover feeds (%s): %v", url, err)
+		}
+		switch {
+		case feed != nil:
+			url = feed.Url
+		case len(links) == 1:
+			url = links[0].Url
+		case len(links) > 1:
+			if r.Method == "GET" {
+				templates.ExecuteTemplate(w, "add-subscription.html", struct {
+					Url   string
+					Links []*FeedLink
+				}{url, links})
+				return
+			}
+			b, _ := json.Marshal(struct {
+				Feeds []*FeedLink
+			}{links})
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(b)
+			return
+		}
+	}
 	o := &OpmlOutline{
 		Outline: []*OpmlOutline{
 			{XmlUrl: url},
 		},
 	}
-	if err := addFeed(c, cu.ID, o); err != nil {
+	if err := addFetchedFeed(c, cu.ID, o, feed, stories); err != nil {
 		log.Errorf(c, "add sub error (%s): %s", url, err.Error())
 		serveError(w, err)
 		return
 	}
 
-	gn := goon.FromContext(c)
-	ud := UserData{Id: "data", Parent: gn.Key(&User{Id: cu.ID})}
-	gn.Get(&ud)
-	if err := mergeUserOpml(c, &ud, o); err != nil {
+	ud, _ := Store.GetUserData(c, cu.ID)
+	if err := mergeUserOpml(c, ud, o); err != nil {
 		log.Errorf(c, "add sub error opml (%v): %v", url, err)
 		serveError(w, err)
 		return
 	}
-	gn.Put(&ud)
-	log.Debugf(c, "add sub: %v - %v", ud.Parent, url)
+	Store.PutUserData(c, cu.ID, ud)
+	log.Debugf(c, "add sub: %v - %v", cu.ID, url)
 	if r.Method == "GET" {
 		http.Redirect(w, r, routeUrl("main"), http.StatusFound)
 	}
@@ -202,10 +223,13 @@ const accountFreeDuration = 30 * time.Hour * 24 // 30 days
 func ListFeeds(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := &User{Id: cu.ID}
-	ud := &UserData{Id: "data", Parent: gn.Key(u)}
-	if err := gn.GetMulti([]interface{}{u, ud}); err != nil && !goon.NotFound(err, 1) {
+	u, err := Store.GetUser(c, cu.ID)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	ud, err := Store.GetUserData(c, cu.ID)
+	if err != nil && err != ErrNotFound {
 		serveError(w, err)
 		return
 	}
@@ -213,12 +237,14 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 	l += fmt.Sprintf(", len opml %v", len(ud.Opml))
 	putU := false
 	putUD := false
-	fixRead := false
-	if time.Since(u.Read) > oldDuration {
-		u.Read = time.Now().Add(-oldDuration)
-		putU = true
-		fixRead = true
-		l += ", u.Read"
+	pruneRead := false
+	if ud.Read != nil {
+		if err := migrateRead(c, cu.ID, ud.Read); err != nil {
+			log.Errorf(c, "migrate read: %v", err)
+		} else {
+			ud.Read = nil
+			l += ", migrate read"
+		}
 	}
 	trialRemaining := 0
 	if STRIPE_KEY != "" && ud.Opml != nil && u.Account == AFree && u.Until.Before(time.Now()) {
@@ -236,45 +262,50 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 		}
 		trialRemaining = int((accountFreeDuration-time.Since(u.Created))/time.Hour/24) + 1
 	}
-	read := make(Read)
+	read := make(map[readStory]bool)
 	var uf Opml
 	log.Debugf(c, "unmarshal user data")
 	{
-		gob.NewDecoder(bytes.NewReader(ud.Read)).Decode(&read)
 		json.Unmarshal(ud.Opml, &uf)
 	}
-	var feeds []*Feed
+	var urls []string
+	var found []*Feed
 	opmlMap := make(map[string]*OpmlOutline)
-	var merr error
 	log.Debugf(c, "fetch feeds")
 	{
 		tctx, cancel := context.WithTimeout(c, time.Minute)
 		defer cancel()
-		gn := goon.FromContext(tctx)
 		for _, outline := range uf.Outline {
 			if outline.XmlUrl == "" {
 				for _, so := range outline.Outline {
-					feeds = append(feeds, &Feed{Url: so.XmlUrl})
+					urls = append(urls, so.XmlUrl)
 					opmlMap[so.XmlUrl] = so
 				}
 			} else {
-				feeds = append(feeds, &Feed{Url: outline.XmlUrl})
+				urls = append(urls, outline.XmlUrl)
 				opmlMap[outline.XmlUrl] = outline
 			}
 		}
-		merr = gn.GetMulti(feeds)
+		if found, err = Store.GetFeeds(tctx, urls); err != nil {
+			serveError(w, err)
+			return
+		}
+	}
+	feeds := make([]*Feed, len(urls))
+	for i, f := range found {
+		if f == nil {
+			f = &Feed{Url: urls[i]}
+		}
+		f.Health = f.health()
+		feeds[i] = f
 	}
 	lock := sync.Mutex{}
 	fl := make(map[string][]*Story)
-	q := datastore.NewQuery(gn.Kind(&Story{})).
-		Filter(IDX_COL+" >=", u.Read).
-		KeysOnly().
-		Order("-" + IDX_COL).
-		Limit(250)
 	updatedLinks := false
 	now := time.Now()
 	numStories := 0
 	var stars []string
+	var playback []*UserPlayback
 
 	log.Debugf(c, "feed unreads: %v", u.Read)
 	{
@@ -288,27 +319,18 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 				{
 					defer wg.Done()
 					var stories []*Story
+					var reads []*UserRead
 					tctx, cancel := context.WithTimeout(c, time.Minute)
 					defer cancel()
-					gn := goon.FromContext(tctx)
 
 					if !f.Date.Before(u.Read) {
-						fk := gn.Key(f)
-						sq := q.Ancestor(fk)
-						keys, _ := gn.GetAll(sq, nil)
-						stories = make([]*Story, len(keys))
-						for j, key := range keys {
-							stories[j] = &Story{
-								Id:     key.StringID(),
-								Parent: fk,
-							}
-						}
-						gn.GetMulti(stories)
+						stories, _, _ = Store.FeedStories(tctx, f.Url, StoryQuery{
+							Page:  Page{Limit: 250},
+							Since: u.Read,
+						})
 					}
-					if f.Link != opmlMap[f.Url].HtmlUrl {
-						l += fmt.Sprintf(", link: %v -> %v", opmlMap[f.Url].HtmlUrl, f.Link)
-						updatedLinks = true
-						opmlMap[f.Url].HtmlUrl = f.Link
+					if len(stories) > 0 {
+						reads, _ = Store.FeedReads(tctx, cu.ID, f.Url, u.Read)
 					}
 					manualDone := false
 					if time.Since(f.LastViewed) > time.Hour*24*2 {
@@ -330,8 +352,16 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 						})
 					}
 					lock.Lock()
+					if f.Link != opmlMap[f.Url].HtmlUrl {
+						l += fmt.Sprintf(", link: %v -> %v", opmlMap[f.Url].HtmlUrl, f.Link)
+						updatedLinks = true
+						opmlMap[f.Url].HtmlUrl = f.Link
+					}
 					fl[f.Url] = stories
 					numStories += len(stories)
+					for _, r := range reads {
+						read[readStory{Feed: r.Feed, Story: r.Story}] = true
+					}
 					lock.Unlock()
 				}
 			}
@@ -341,7 +371,7 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 			go feedProc()
 		}
 		for i, f := range feeds {
-			if goon.NotFound(merr, i) {
+			if found[i] == nil {
 				continue
 			}
 			wg.Add(1)
@@ -350,18 +380,14 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 		close(queue)
 		log.Debugf(c, "stars")
 		{
-			gn := goon.FromContext(c)
-			q := datastore.NewQuery(gn.Kind(&UserStar{})).
-				Ancestor(ud.Parent).
-				KeysOnly().
-				Filter("c >=", u.Read).
-				Order("-c")
-			keys, _ := gn.GetAll(q, nil)
-			stars = make([]string, len(keys))
-			for i, key := range keys {
-				stars[i] = starID(key)
+			us, _, _ := Store.Stars(c, cu.ID, StarQuery{Since: u.Read})
+			stars = make([]string, len(us))
+			for i, s := range us {
+				stars[i] = starID(s.Feed, s.Story)
 			}
 		}
+		log.Debugf(c, "playback")
+		playback, _ = Store.Playbacks(c, cu.ID, u.Read, numStoriesLimit)
 		// wait for feeds to complete so there are no more tasks to queue
 		wg.Wait()
 		// then finish enqueuing tasks
@@ -380,38 +406,15 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 				stories = stories[:numStoriesLimit]
 				fl = make(map[string][]*Story)
 				for _, s := range stories {
-					fk := s.Parent.StringID()
-					p := fl[fk]
-					fl[fk] = append(p, s)
+					p := fl[s.Feed]
+					fl[s.Feed] = append(p, s)
 				}
 			}
 			last := stories[len(stories)-1].Created
 			if u.Read.Before(last) {
 				u.Read = last
 				putU = true
-				fixRead = true
-			}
-		}
-	}
-	if fixRead {
-		log.Debugf(c, "fix read")
-		{
-			nread := make(Read)
-			for k, v := range fl {
-				for _, s := range v {
-					rs := readStory{Feed: k, Story: s.Id}
-					if read[rs] {
-						nread[rs] = true
-					}
-				}
-			}
-			if len(nread) != len(read) {
-				read = nread
-				var b bytes.Buffer
-				gob.NewEncoder(&b).Encode(&read)
-				ud.Read = b.Bytes()
-				putUD = true
-				l += ", fix read"
+				pruneRead = true
 			}
 		}
 	}
@@ -427,12 +430,6 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 		fl[k] = newStories
 	}
 	if numStories == 0 {
-		l += ", clear read"
-		fixRead = false
-		if ud.Read != nil {
-			putUD = true
-			ud.Read = nil
-		}
 		last := u.Read
 		for _, v := range feeds {
 			if last.Before(v.Date) {
@@ -442,6 +439,7 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 		log.Infof(c, "nothing here, move up: %v -> %v", u.Read, last)
 		if u.Read.Before(last) {
 			putU = true
+			pruneRead = true
 			u.Read = last
 		}
 	}
@@ -456,17 +454,23 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 	if putU {
-		gn.Put(u)
+		Store.PutUser(c, u)
 		l += ", putU"
 	}
+	if pruneRead {
+		// Everything before u.Read is read now, so these are redundant.
+		if err := Store.DeleteReadsBefore(c, cu.ID, u.Read); err != nil {
+			log.Errorf(c, "prune read: %v", err)
+		}
+		l += ", prune read"
+	}
 	if putUD {
-		gn.Put(ud)
+		Store.PutUserData(c, cu.ID, ud)
 		l += ", putUD"
 	}
 	l += fmt.Sprintf(", len opml %v", len(ud.Opml))
-	log.Debugf(c, "json marshal: %v - %v", ud.Parent, l)
+	log.Debugf(c, "json marshal: %v - %v", cu.ID, l)
 	{
-		gn := goon.FromContext(c)
 		o := struct {
 			Opml           []*OpmlOutline
 			Stories        map[string][]*Story
@@ -474,6 +478,7 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 			TrialRemaining int
 			Feeds          []*Feed
 			Stars          []string
+			Playback       []*UserPlayback
 			UnreadDate     time.Time
 			UntilDate      int64
 		}{
@@ -483,6 +488,7 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 			TrialRemaining: trialRemaining,
 			Feeds:          feeds,
 			Stars:          stars,
+			Playback:       playback,
 			UnreadDate:     u.Read,
 			UntilDate:      u.Until.Unix(),
 		}
@@ -495,7 +501,7 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 					if n != s.Summary {
 						s.Summary = n
 						log.Errorf(c, "cleaned %v", s.Id)
-						gn.Put(s)
+						Store.PutStories(c, []*Story{s}, false)
 					}
 				}
 			}
@@ -508,8 +514,6 @@ func ListFeeds(w http.ResponseWriter, r *http.Request) {
 func MarkRead(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	read := make(Read)
 	var stories []readStory
 	defer r.Body.Close()
 	b, _ := ioutil.ReadAll(r.Body)
@@ -517,77 +521,34 @@ func MarkRead(w http.ResponseWriter, r *http.Request) {
 		serveError(w, err)
 		return
 	}
-	gn.RunInTransaction(func(gn *goon.Goon) error {
-		u := &User{Id: cu.ID}
-		ud := &UserData{
-			Id:     "data",
-			Parent: gn.Key(u),
-		}
-		if err := gn.Get(ud); err != nil {
-			return err
-		}
-		gob.NewDecoder(bytes.NewReader(ud.Read)).Decode(&read)
-		for _, s := range stories {
-			read[s] = true
-		}
-		var b bytes.Buffer
-		gob.NewEncoder(&b).Encode(&read)
-		ud.Read = b.Bytes()
-		_, err := gn.Put(ud)
-		return err
-	}, nil)
+	if err := markRead(c, cu.ID, stories); err != nil {
+		serveError(w, err)
+	}
 }
 
 func MarkUnread(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	read := make(Read)
 	f := r.FormValue("feed")
 	s := r.FormValue("story")
-	rs := readStory{Feed: f, Story: s}
-	u := &User{Id: cu.ID}
-	ud := &UserData{
-		Id:     "data",
-		Parent: gn.Key(u),
-	}
-	gn.RunInTransaction(func(gn *goon.Goon) error {
-		if err := gn.Get(ud); err != nil {
-			return err
-		}
-		gob.NewDecoder(bytes.NewReader(ud.Read)).Decode(&read)
-		delete(read, rs)
-		b := bytes.Buffer{}
-		gob.NewEncoder(&b).Encode(&read)
-		ud.Read = b.Bytes()
-		_, err := gn.Put(ud)
-		return err
-	}, nil)
+	if err := Store.DeleteReads(c, cu.ID, []readStory{{Feed: f, Story: s}}); err != nil {
+		serveError(w, err)
+	}
 }
 
 func GetContents(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	var reqs []struct {
-		Feed  string
-		Story string
-	}
+	var reqs []readStory
 	defer r.Body.Close()
 	b, _ := ioutil.ReadAll(r.Body)
 	if err := json.Unmarshal(b, &reqs); err != nil {
 		serveError(w, err)
 		return
 	}
-	scs := make([]*StoryContent, len(reqs))
-	gn := goon.FromContext(c)
-	for i, r := range reqs {
-		f := &Feed{Url: r.Feed}
-		s := &Story{Id: r.Story, Parent: gn.Key(f)}
-		scs[i] = &StoryContent{Id: 1, Parent: gn.Key(s)}
-	}
-	gn.GetMulti(scs)
-	ret := make([]string, len(reqs))
-	for i, sc := range scs {
-		ret[i] = sc.content()
+	ret, err := Store.StoryContents(c, reqs)
+	if err != nil {
+		serveError(w, err)
+		return
 	}
 	b, _ = json.Marshal(&ret)
 	w.Write(b)
@@ -595,20 +556,16 @@ func GetContents(w http.ResponseWriter, r *http.Request) {
 
 func ExportOpml(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
-	var u User
-	if uid := r.FormValue("u"); len(uid) != 0 && user.IsAdmin(c) {
-		u = User{Id: uid}
-	} else {
-		cu := user.Current(c)
-		u = User{Id: cu.ID}
+	uid := r.FormValue("u")
+	if len(uid) == 0 || !user.IsAdmin(c) {
+		uid = user.Current(c).ID
 	}
-	ud := UserData{Id: "data", Parent: gn.Key(&u)}
-	if err := gn.Get(&u); err != nil {
+	u, err := Store.GetUser(c, uid)
+	if err != nil {
 		serveError(w, err)
 		return
 	}
-	gn.Get(&ud)
+	ud, _ := Store.GetUserData(c, uid)
 	downloadOpml(w, ud.Opml, u.Email)
 }
 
@@ -648,10 +605,8 @@ func UploadOpml(w http.ResponseWriter, r *http.Request) {
 	}
 	backupOPML(c)
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := User{Id: cu.ID}
-	ud := UserData{Id: "data", Parent: gn.Key(&u)}
-	if err := gn.Get(&ud); err != nil {
+	ud, err := Store.GetUserData(c, cu.ID)
+	if err != nil {
 		serveError(w, err)
 		log.Errorf(c, "get err: %v", err)
 		return
@@ -662,7 +617,7 @@ func UploadOpml(w http.ResponseWriter, r *http.Request) {
 		return
 	} else {
 		ud.Opml = b
-		if _, err := gn.Put(&ud); err != nil {
+		if err := Store.PutUserData(c, cu.ID, ud); err != nil {
 			serveError(w, err)
 			return
 		}
@@ -673,13 +628,11 @@ func UploadOpml(w http.ResponseWriter, r *http.Request) {
 
 func backupOPML(c context.Context) {
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := User{Id: cu.ID}
-	ud := UserData{Id: "data", Parent: gn.Key(&u)}
-	if err := gn.Get(&ud); err != nil {
+	ud, err := Store.GetUserData(c, cu.ID)
+	if err != nil {
 		return
 	}
-	uo := UserOpml{Id: time.Now().UnixNano(), Parent: gn.Key(&u)}
+	uo := &UserOpml{Id: time.Now().UnixNano()}
 	buf := &bytes.Buffer{}
 	if gz, err := gzip.NewWriterLevel(buf, gzip.BestCompression); err == nil {
 		gz.Write([]byte(ud.Opml))
@@ -689,32 +642,28 @@ func backupOPML(c context.Context) {
 		log.Errorf(c, "gz err: %v", err)
 		uo.Opml = ud.Opml
 	}
-	gn.Put(&uo)
+	Store.PutUserOpml(c, cu.ID, uo)
 }
 
 func FeedHistory(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := User{Id: cu.ID}
-	uk := gn.Key(&u)
 	if v := r.FormValue("v"); len(v) == 0 {
-		q := datastore.NewQuery(gn.Kind(&UserOpml{})).Ancestor(uk).KeysOnly()
-		keys, err := gn.GetAll(q, nil)
+		ids, err := Store.UserOpmls(c, cu.ID)
 		if err != nil {
 			serveError(w, err)
 			return
 		}
-		times := make([]string, len(keys))
-		for i, k := range keys {
-			times[i] = strconv.FormatInt(k.IntID(), 10)
+		times := make([]string, len(ids))
+		for i, id := range ids {
+			times[i] = strconv.FormatInt(id, 10)
 		}
 		b, _ := json.Marshal(&times)
 		w.Write(b)
 	} else {
 		a, _ := strconv.ParseInt(v, 10, 64)
-		uo := UserOpml{Id: a, Parent: uk}
-		if err := gn.Get(&uo); err != nil {
+		uo, err := Store.GetUserOpml(c, cu.ID, a)
+		if err != nil {
 			serveError(w, err)
 			return
 		}
@@ -725,79 +674,77 @@ func FeedHistory(w http.ResponseWriter, r *http.Request) {
 func SaveOptions(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
 	// TODO needs transaction?
-	gn.RunInTransaction(func(gn *goon.Goon) error {
-		u := User{Id: cu.ID}
-		if err := gn.Get(&u); err != nil {
+	Store.RunInTransaction(c, func(c context.Context) error {
+		u, err := Store.GetUser(c, cu.ID)
+		if err != nil {
 			serveError(w, err)
 			return nil
 		}
 		u.Options = r.FormValue("options")
-		_, err := gn.Put(&u)
-		log.Debugf(c, "save options: %v - %v", gn.Key(&u), u.Options)
+		err = Store.PutUser(c, u)
+		log.Debugf(c, "save options: %v - %v", u.Id, u.Options)
 		return err
-	}, nil)
+	})
 }
 
 func GetFeed(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
-	f := Feed{Url: r.FormValue("f")}
+	cu := user.Current(c)
+	feed := r.FormValue("f")
 	var stars []string
 	wg := sync.WaitGroup{}
-	fk := gn.Key(&f)
-	q := datastore.NewQuery(gn.Kind(&Story{})).Ancestor(fk).KeysOnly()
-	q = q.Order("-" + IDX_COL)
-	if cur := r.FormValue("c"); cur != "" {
-		if dc, err := datastore.DecodeCursor(cur); err == nil {
-			q = q.Start(dc)
-		}
-	} else {
+	cur := r.FormValue("c")
+	if cur == "" {
 		// grab the stars list on the first run
 		wg.Add(1)
 		go func(c context.Context) {
 			log.Debugf(c, "stars")
-			gn := goon.FromContext(c)
-			usk := starKey(c, f.Url, "")
-			q := datastore.NewQuery(gn.Kind(&UserStar{})).Ancestor(gn.Key(usk).Parent()).KeysOnly()
-			keys, _ := gn.GetAll(q, nil)
-			stars = make([]string, len(keys))
-			for i, key := range keys {
-				stars[i] = starID(key)
+			us, _, _ := Store.Stars(c, cu.ID, StarQuery{Feed: feed})
+			stars = make([]string, len(us))
+			for i, s := range us {
+				stars[i] = starID(s.Feed, s.Story)
 			}
 			wg.Done()
 		}(c)
 	}
-	iter := gn.Run(q)
-	var stories []*Story
-	for i := 0; i < 20; i++ {
-		if k, err := iter.Next(nil); err == nil {
-			stories = append(stories, &Story{
-				Id:     k.StringID(),
-				Parent: k.Parent(),
-			})
-		} else if err == datastore.Done {
-			break
-		} else {
-			serveError(w, err)
-			return
-		}
+	stories, cursor, err := Store.FeedStories(c, feed, StoryQuery{
+		Page:     Page{Cursor: cur, Limit: 20},
+		Category: r.FormValue("category"),
+	})
+	if err != nil {
+		serveError(w, err)
+		return
 	}
-	cursor := ""
-	if ic, err := iter.Cursor(); err == nil {
-		cursor = ic.String()
+	u, err := Store.GetUser(c, cu.ID)
+	if err != nil {
+		serveError(w, err)
+		return
+	}
+	var unread []string
+	if len(stories) > 0 && !stories[0].Created.Before(u.Read) {
+		reads, _ := Store.FeedReads(c, cu.ID, feed, u.Read)
+		read := make(map[string]bool, len(reads))
+		for _, r := range reads {
+			read[r.Story] = true
+		}
+		for _, s := range stories {
+			if !s.Created.Before(u.Read) && !read[s.Id] {
+				unread = append(unread, s.Id)
+			}
+		}
 	}
-	gn.GetMulti(&stories)
 	wg.Wait()
 	b, _ := json.Marshal(struct {
 		Cursor  string
 		Stories []*Story
 		Stars   []string `json:",omitempty"`
+		Unread  []string `json:",omitempty"`
 	}{
 		Cursor:  cursor,
 		Stories: stories,
 		Stars:   stars,
+		Unread:  unread,
 	})
 	w.Write(b)
 }
@@ -808,17 +755,7 @@ func DeleteAccount(w http.ResponseWriter, r *http.Request) {
 		log.Errorf(c, "uncheckout err: %v", err)
 	}
 	cu := user.Current(c)
-	gn := goon.FromContext(c)
-	u := User{Id: cu.ID}
-	uk := gn.Key(&u)
-	q := datastore.NewQuery("").KeysOnly().Ancestor(uk)
-	keys, err := gn.GetAll(q, nil)
-	if err != nil {
-		serveError(w, err)
-		return
-	}
-	err = gn.DeleteMulti(keys)
-	if err != nil {
+	if err := Store.DeleteUser(c, cu.ID); err != nil {
 		serveError(w, err)
 		return
 	}
@@ -827,20 +764,18 @@ func DeleteAccount(w http.ResponseWriter, r *http.Request) {
 
 func SetStar(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
+	cu := user.Current(c)
 	feed := r.FormValue("feed")
 	story := r.FormValue("story")
 	if len(feed) == 0 || len(story) == 0 {
 		return
 	}
 	del := r.FormValue("del") != ""
-	us := starKey(c, feed, story)
-	gn := goon.FromContext(c)
 	if del {
-		gn.Delete(gn.Key(us))
+		Store.DeleteStar(c, cu.ID, feed, story)
 	} else {
-		us.Created = time.Now()
-		_, err := gn.Put(us)
-		if err != nil {
+		us := &UserStar{Feed: feed, Story: story, Created: time.Now()}
+		if err := Store.PutStar(c, cu.ID, us); err != nil {
 			log.Errorf(c, "star put err: %v", err)
 			serveError(w, err)
 		}
@@ -849,58 +784,53 @@ func SetStar(w http.ResponseWriter, r *http.Request) {
 
 func GetStars(w http.ResponseWriter, r *http.Request) {
 	c := r.Context()
-	gn := goon.FromContext(c)
 	cu := user.Current(c)
-	u := User{Id: cu.ID}
-	q := datastore.NewQuery(gn.Kind(&UserStar{})).
-		Ancestor(gn.Key(&u)).
-		Order("-c").
-		Limit(20)
-	if cur := r.FormValue("c"); cur != "" {
-		if dc, err := datastore.DecodeCursor(cur); err == nil {
-			q = q.Start(dc)
-		}
+	us, cursor, err := Store.Stars(c, cu.ID, StarQuery{
+		Page: Page{Cursor: r.FormValue("c"), Limit: 20},
+	})
+	if err != nil {
+		serveError(w, err)
+		return
 	}
-	iter := gn.Run(q)
 	stars := make(map[string]int64)
-	var us UserStar
-	var stories []*Story
-	var feeds []*Feed
-	feedm := make(map[string]*Feed)
-	for {
-		if k, err := iter.Next(&us); err == nil {
-			stars[starID(k)] = us.Created.Unix()
-			feed := &Feed{Url: k.Parent().StringID()}
-			stories = append(stories, &Story{
-				Id:     k.StringID(),
-				Parent: gn.Key(feed),
-			})
-			feedm[feed.Url] = feed
-		} else if err == datastore.Done {
-			break
-		} else {
-			serveError(w, err)
-			return
+	var ids []readStory
+	var urls []string
+	feedm := make(map[string]bool)
+	for _, s := range us {
+		stars[starID(s.Feed, s.Story)] = s.Created.Unix()
+		ids = append(ids, readStory{Feed: s.Feed, Story: s.Story})
+		if !feedm[s.Feed] {
+			feedm[s.Feed] = true
+			urls = append(urls, s.Feed)
 		}
 	}
-	cursor := ""
-	if ic, err := iter.Cursor(); err == nil {
-		cursor = ic.String()
-	}
 	var smap map[string][]*Story
-	if len(stories) > 0 {
-		gn.GetMulti(&stories)
+	if len(ids) > 0 {
+		stories, err := Store.GetStories(c, ids)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
 		smap = make(map[string][]*Story)
 		for _, s := range stories {
-			f := s.Parent.StringID()
-			smap[f] = append(smap[f], s)
+			if s != nil {
+				smap[s.Feed] = append(smap[s.Feed], s)
+			}
 		}
 	}
-	if len(feedm) > 0 {
-		for _, v := range feedm {
-			feeds = append(feeds, v)
+	var feeds []*Feed
+	if len(urls) > 0 {
+		fs, err := Store.GetFeeds(c, urls)
+		if err != nil {
+			serveError(w, err)
+			return
+		}
+		for i, f := range fs {
+			if f == nil {
+				f = &Feed{Url: urls[i]}
+			}
+			feeds = append(feeds, f)
 		}
-		gn.GetMulti(&feeds)
 	}
 	b, _ := json.Marshal(struct {
 		Cursor  string
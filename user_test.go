@@ -0,0 +1,155 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"sort"
+	"testing"
+	"time"
+)
+
+// subscribe signs testUser in and subscribes them to the feed of s.
+func subscribe(t *testing.T, s *feedServer) {
+	t.Helper()
+	serve(t, LoginGoogle, testUser, "/login/google", nil)
+	serve(t, AddSubscription, testUser, "/user/add-subscription", url.Values{"url": {s.feedUrl()}})
+}
+
+// listFeeds returns the ids of the unread stories ListFeeds lists for the
+// feed of s.
+func listFeeds(t *testing.T, s *feedServer) []string {
+	t.Helper()
+	var lf struct {
+		Stories map[string][]*Story
+	}
+	decode(t, serve(t, ListFeeds, testUser, "/user/list-feeds", nil), &lf)
+	var ids []string
+	for _, st := range lf.Stories[s.feedUrl()] {
+		ids = append(ids, st.Id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func equalIds(a []string, b ...string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAddSubscription(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		now := time.Now()
+		s := newFeedServer(testItem{"1", now.Add(-time.Hour * 2)}, testItem{"2", now.Add(-time.Hour)})
+		defer s.Close()
+		subscribe(t, s)
+		if n := s.count("/feed"); n != 1 {
+			t.Errorf("feed fetched %v times", n)
+		}
+
+		c := context.Background()
+		f, err := Store.GetFeed(c, s.feedUrl())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Title != "Test" || f.NextUpdate.Before(now) {
+			t.Errorf("feed: %+v", f)
+		}
+		stories, _, err := Store.FeedStories(c, s.feedUrl(), StoryQuery{})
+		if err != nil || len(stories) != 2 || stories[0].Id != "2" {
+			t.Fatalf("stories: %v, %v", stories, err)
+		}
+		ud, err := Store.GetUserData(c, testUser)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var o Opml
+		if err := json.Unmarshal(ud.Opml, &o); err != nil || !o.feedUrls()[s.feedUrl()] {
+			t.Errorf("opml: %s, %v", ud.Opml, err)
+		}
+		if ids, _ := Store.UserOpmls(c, testUser); len(ids) == 0 {
+			t.Error("no opml backup")
+		}
+
+		// Subscribing again finds the stored feed without fetching it.
+		n := s.count("/feed")
+		serve(t, AddSubscription, testUser, "/user/add-subscription", url.Values{"url": {s.feedUrl()}})
+		if s.count("/feed") != n {
+			t.Error("stored feed fetched again")
+		}
+	})
+}
+
+func TestListFeedsMarkRead(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		now := time.Now()
+		s := newFeedServer(testItem{"1", now.Add(-time.Hour * 2)}, testItem{"2", now.Add(-time.Hour)})
+		defer s.Close()
+		subscribe(t, s)
+		if ids := listFeeds(t, s); !equalIds(ids, "1", "2") {
+			t.Fatalf("unread: %v", ids)
+		}
+
+		serveJSON(t, MarkRead, testUser, "/user/mark-read", []readStory{
+			{Feed: s.feedUrl(), Story: "1"},
+			{Feed: s.feedUrl(), Story: "missing"},
+		})
+		if ids := listFeeds(t, s); !equalIds(ids, "2") {
+			t.Errorf("unread after mark read: %v", ids)
+		}
+
+		serve(t, MarkUnread, testUser, "/user/mark-unread", url.Values{
+			"feed":  {s.feedUrl()},
+			"story": {"1"},
+		})
+		if ids := listFeeds(t, s); !equalIds(ids, "1", "2") {
+			t.Errorf("unread after mark unread: %v", ids)
+		}
+
+		serveJSON(t, MarkRead, testUser, "/user/mark-read", []readStory{
+			{Feed: s.feedUrl(), Story: "1"},
+			{Feed: s.feedUrl(), Story: "2"},
+		})
+		if ids := listFeeds(t, s); len(ids) != 0 {
+			t.Errorf("unread after marking all: %v", ids)
+		}
+	})
+}
+
+func TestAddSubscriptionPage(t *testing.T) {
+	forEachStore(t, func(t *testing.T, tasks *taskRecorder) {
+		s := newFeedServer(testItem{"1", time.Now()})
+		defer s.Close()
+		serve(t, LoginGoogle, testUser, "/login/google", nil)
+		serve(t, AddSubscription, testUser, "/user/add-subscription", url.Values{"url": {s.URL + "/"}})
+		if _, err := Store.GetFeed(context.Background(), s.feedUrl()); err != nil {
+			t.Errorf("feed found on the page not added: %v", err)
+		}
+		if ids := listFeeds(t, s); !equalIds(ids, "1") {
+			t.Errorf("unread: %v", ids)
+		}
+	})
+}
@@ -19,6 +19,7 @@ package goread
 import (
 	"bytes"
 	"context"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 	"html"
@@ -27,12 +28,18 @@ import (
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 	"unicode/utf8"
 
-	"github.com/mjibson/goon"
 	"github.com/msde/goread/atom"
+	"github.com/msde/goread/dateparse"
+	"github.com/msde/goread/jsonfeed"
+	"github.com/msde/goread/lang"
+	"github.com/msde/goread/platform/log"
+	"github.com/msde/goread/platform/taskqueue"
+	"github.com/msde/goread/platform/user"
 	"github.com/msde/goread/rdf"
 	"github.com/msde/goread/rss"
 	"github.com/msde/goread/sanitizer"
@@ -42,11 +49,6 @@ import (
 	"golang.org/x/text/transform"
 
 	"google.golang.org/appengine"
-	"google.golang.org/appengine/log"
-	"google.golang.org/appengine/memcache"
-	"google.golang.org/appengine/taskqueue"
-	"google.golang.org/appengine/urlfetch"
-	"google.golang.org/appengine/user"
 )
 
 func serveError(w http.ResponseWriter, err error) {
@@ -129,16 +131,14 @@ func includes(c context.Context, w http.ResponseWriter, r *http.Request) *Includ
 	}
 
 	if cu := user.Current(c); cu != nil {
-		gn := goon.FromContext(c)
-		user := &User{Id: cu.ID}
-		if err := gn.Get(user); err == nil {
+		if user, err := Store.GetUser(c, cu.ID); err == nil {
 			i.User = user
 			i.IsAdmin = cu.Admin
 
 			if len(user.Messages) > 0 {
 				i.Messages = user.Messages
 				user.Messages = nil
-				gn.Put(user)
+				Store.PutUser(c, user)
 			}
 
 			/*
@@ -157,197 +157,16 @@ func includes(c context.Context, w http.ResponseWriter, r *http.Request) *Includ
 	return i
 }
 
-var dateFormats = []string{
-	"01-02-2006",
-	"01/02/2006",
-	"01/02/2006 - 15:04",
-	"01/02/2006 15:04:05 MST",
-	"01/02/2006 3:04 PM",
-	"02-01-2006",
-	"02/01/2006",
-	"02.01.2006 -0700",
-	"02/01/2006 - 15:04",
-	"02.01.2006 15:04",
-	"02/01/2006 15:04:05",
-	"02.01.2006 15:04:05",
-	"02-01-2006 15:04:05 MST",
-	"02/01/2006 15:04 MST",
-	"02 Jan 2006",
-	"02 Jan 2006 15:04:05",
-	"02 Jan 2006 15:04:05 -0700",
-	"02 Jan 2006 15:04:05 MST",
-	"02 Jan 2006 15:04:05 UT",
-	"02 Jan 2006 15:04 MST",
-	"02 Monday, Jan 2006 15:04",
-	"06-1-2 15:04",
-	"06/1/2 15:04",
-	"1/2/2006",
-	"1/2/2006 15:04:05 MST",
-	"1/2/2006 3:04:05 PM",
-	"1/2/2006 3:04:05 PM MST",
-	"15:04 02.01.2006 -0700",
-	"2006-01-02",
-	"2006/01/02",
-	"2006-01-02 00:00:00.0 15:04:05.0 -0700",
-	"2006-01-02 15:04",
-	"2006-01-02 15:04:05 -0700",
-	"2006-01-02 15:04:05-07:00",
-	"2006-01-02 15:04:05-0700",
-	"2006-01-02 15:04:05 MST",
-	"2006-01-02 15:04:05Z",
-	"2006-01-02 at 15:04:05",
-	"2006-01-02T15:04:05",
-	"2006-01-02T15:04:05:00",
-	"2006-01-02T15:04:05 -0700",
-	"2006-01-02T15:04:05-07:00",
-	"2006-01-02T15:04:05-0700",
-	"2006-01-02T15:04:05:-0700",
-	"2006-01-02T15:04:05-07:00:00",
-	"2006-01-02T15:04:05Z",
-	"2006-01-02T15:04-07:00",
-	"2006-01-02T15:04Z",
-	"2006-1-02T15:04:05Z",
-	"2006-1-2",
-	"2006-1-2 15:04:05",
-	"2006-1-2T15:04:05Z",
-	"2006 January 02",
-	"2-1-2006",
-	"2/1/2006",
-	"2.1.2006 15:04:05",
-	"2 Jan 2006",
-	"2 Jan 2006 15:04:05 -0700",
-	"2 Jan 2006 15:04:05 MST",
-	"2 Jan 2006 15:04:05 Z",
-	"2 January 2006",
-	"2 January 2006 15:04:05 -0700",
-	"2 January 2006 15:04:05 MST",
-	"6-1-2 15:04",
-	"6/1/2 15:04",
-	"Jan 02, 2006",
-	"Jan 02 2006 03:04:05PM",
-	"Jan 2, 2006",
-	"Jan 2, 2006 15:04:05 MST",
-	"Jan 2, 2006 3:04:05 PM",
-	"Jan 2, 2006 3:04:05 PM MST",
-	"January 02, 2006",
-	"January 02, 2006 03:04 PM",
-	"January 02, 2006 15:04",
-	"January 02, 2006 15:04:05 MST",
-	"January 2, 2006",
-	"January 2, 2006 03:04 PM",
-	"January 2, 2006 15:04:05",
-	"January 2, 2006 15:04:05 MST",
-	"January 2, 2006, 3:04 p.m.",
-	"January 2, 2006 3:04 PM",
-	"Mon, 02 Jan 06 15:04:05 MST",
-	"Mon, 02 Jan 2006",
-	"Mon, 02 Jan 2006 15:04:05",
-	"Mon, 02 Jan 2006 15:04:05 00",
-	"Mon, 02 Jan 2006 15:04:05 -07",
-	"Mon 02 Jan 2006 15:04:05 -0700",
-	"Mon, 02 Jan 2006 15:04:05 --0700",
-	"Mon, 02 Jan 2006 15:04:05 -07:00",
-	"Mon, 02 Jan 2006 15:04:05 -0700",
-	"Mon,02 Jan 2006 15:04:05 -0700",
-	"Mon, 02 Jan 2006 15:04:05 GMT-0700",
-	"Mon , 02 Jan 2006 15:04:05 MST",
-	"Mon, 02 Jan 2006 15:04:05 MST",
-	"Mon, 02 Jan 2006 15:04:05MST",
-	"Mon, 02 Jan 2006, 15:04:05 MST",
-	"Mon, 02 Jan 2006 15:04:05 MST -0700",
-	"Mon, 02 Jan 2006 15:04:05 MST-07:00",
-	"Mon, 02 Jan 2006 15:04:05 UT",
-	"Mon, 02 Jan 2006 15:04:05 Z",
-	"Mon, 02 Jan 2006 15:04 -0700",
-	"Mon, 02 Jan 2006 15:04 MST",
-	"Mon,02 Jan 2006 15:04 MST",
-	"Mon, 02 Jan 2006 15 -0700",
-	"Mon, 02 Jan 2006 3:04:05 PM MST",
-	"Mon, 02 January 2006",
-	"Mon,02 January 2006 14:04:05 MST",
-	"Mon, 2006-01-02 15:04",
-	"Mon, 2 Jan 06 15:04:05 -0700",
-	"Mon, 2 Jan 06 15:04:05 MST",
-	"Mon, 2 Jan 15:04:05 MST",
-	"Mon, 2 Jan 2006",
-	"Mon,2 Jan 2006",
-	"Mon, 2 Jan 2006 15:04",
-	"Mon, 2 Jan 2006 15:04:05",
-	"Mon, 2 Jan 2006 15:04:05 -0700",
-	"Mon, 2 Jan 2006 15:04:05-0700",
-	"Mon, 2 Jan 2006 15:04:05 -0700 MST",
-	"mon,2 Jan 2006 15:04:05 MST",
-	"Mon 2 Jan 2006 15:04:05 MST",
-	"Mon, 2 Jan 2006 15:04:05 MST",
-	"Mon, 2 Jan 2006 15:04:05MST",
-	"Mon, 2 Jan 2006 15:04:05 UT",
-	"Mon, 2 Jan 2006 15:04 -0700",
-	"Mon, 2 Jan 2006, 15:04 -0700",
-	"Mon, 2 Jan 2006 15:04 MST",
-	"Mon, 2, Jan 2006 15:4",
-	"Mon, 2 Jan 2006 15:4:5 -0700 GMT",
-	"Mon, 2 Jan 2006 15:4:5 MST",
-	"Mon, 2 Jan 2006 3:04:05 PM -0700",
-	"Mon, 2 January 2006",
-	"Mon, 2 January 2006 15:04:05 -0700",
-	"Mon, 2 January 2006 15:04:05 MST",
-	"Mon, 2 January 2006, 15:04:05 MST",
-	"Mon, 2 January 2006, 15:04 -0700",
-	"Mon, 2 January 2006 15:04 MST",
-	"Monday, 02 January 2006 15:04:05",
-	"Monday, 02 January 2006 15:04:05 -0700",
-	"Monday, 02 January 2006 15:04:05 MST",
-	"Monday, 2 Jan 2006 15:04:05 -0700",
-	"Monday, 2 Jan 2006 15:04:05 MST",
-	"Monday, 2 January 2006 15:04:05 -0700",
-	"Monday, 2 January 2006 15:04:05 MST",
-	"Monday, January 02, 2006",
-	"Monday, January 2, 2006",
-	"Monday, January 2, 2006 03:04 PM",
-	"Monday, January 2, 2006 15:04:05 MST",
-	"Mon Jan 02 2006 15:04:05 -0700",
-	"Mon, Jan 02,2006 15:04:05 MST",
-	"Mon Jan 02, 2006 3:04 pm",
-	"Mon Jan 2 15:04:05 2006 MST",
-	"Mon Jan 2 15:04 2006",
-	"Mon, Jan 2 2006 15:04:05 -0700",
-	"Mon, Jan 2 2006 15:04:05 -700",
-	"Mon, Jan 2, 2006 15:04:05 MST",
-	"Mon, Jan 2 2006 15:04 MST",
-	"Mon, Jan 2, 2006 15:04 MST",
-	"Mon, January 02, 2006 15:04:05 MST",
-	"Mon, January 02, 2006, 15:04:05 MST",
-	"Mon, January 2 2006 15:04:05 -0700",
-	time.ANSIC,
-	time.RFC1123,
-	time.RFC1123Z,
-	time.RFC3339,
-	time.RFC822,
-	time.RFC822Z,
-	time.RFC850,
-	time.RubyDate,
-	time.UnixDate,
-	"Updated January 2, 2006",
-}
-
-const dateFormatCount = 500
-
-func parseDate(c context.Context, feed *Feed, ds ...string) (t time.Time, err error) {
+func parseDate(c context.Context, failures *[]string, ds ...string) (t time.Time, err error) {
 	for _, d := range ds {
 		d = strings.TrimSpace(d)
 		if d == "" {
 			continue
 		}
-		for _, f := range dateFormats {
-			if t, err = time.Parse(f, d); err == nil {
-				return
-			}
-		}
-		df := memcache.Item{
-			Key:   fmt.Sprintf("_dateformat-%v", rand.Int63n(dateFormatCount)),
-			Value: []byte(fmt.Sprintf("%v|%v", d, feed.Url)),
+		if t, err = dateparse.Parse(d); err == nil {
+			return
 		}
-		memcache.Add(c, &df)
+		*failures = append(*failures, d)
 	}
 	err = fmt.Errorf("could not parse date: %v", strings.Join(ds, ", "))
 	return
@@ -387,6 +206,15 @@ func nilCharsetReader(cs string, input io.Reader) (io.Reader, error) {
 }
 
 func ParseFeed(c context.Context, contentType, origUrl, fetchUrl string, body []byte) (*Feed, []*Story, error) {
+	if isJSONFeed(contentType, body) {
+		feed, stories, err := parseJSONFeed(c, body)
+		if feed == nil {
+			log.Warningf(c, "json feed parse error: %s", err.Error())
+			return nil, nil, fmt.Errorf("Could not parse feed data")
+		}
+		feed.Url = origUrl
+		return parseFix(c, feed, stories, fetchUrl)
+	}
 	cr := defaultCharsetReader
 	if !bytes.EqualFold(body[:len(xml.Header)], []byte(xml.Header)) {
 		enc, err := encodingReader(body, contentType)
@@ -403,7 +231,7 @@ func ParseFeed(c context.Context, contentType, origUrl, fetchUrl string, body []
 	}
 	var feed *Feed
 	var stories []*Story
-	var atomerr, rsserr, rdferr error
+	var atomerr, rsserr, rdferr, mf2err error
 	feed, stories, atomerr = parseAtom(c, body, cr)
 	if feed == nil {
 		feed, stories, rsserr = parseRSS(c, body, cr)
@@ -411,16 +239,106 @@ func ParseFeed(c context.Context, contentType, origUrl, fetchUrl string, body []
 	if feed == nil {
 		feed, stories, rdferr = parseRDF(c, body, cr)
 	}
+	if feed == nil {
+		// an HTML page without feed links may still mark up its posts
+		feed, stories, mf2err = parseMF2(c, body, fetchUrl)
+	}
 	if feed == nil {
 		log.Warningf(c, "atom parse error: %s", atomerr.Error())
 		log.Warningf(c, "xml parse error: %s", rsserr.Error())
 		log.Warningf(c, "rdf parse error: %s", rdferr.Error())
+		log.Warningf(c, "mf2 parse error: %s", mf2err.Error())
 		return nil, nil, fmt.Errorf("Could not parse feed data")
 	}
 	feed.Url = origUrl
 	return parseFix(c, feed, stories, fetchUrl)
 }
 
+// isJSONFeed reports whether body should be parsed as a JSON Feed rather
+// than XML. JSON Feeds are often served as text/plain or application/json,
+// so sniff the first non-space byte as well as the content type.
+func isJSONFeed(contentType string, body []byte) bool {
+	if strings.Contains(contentType, "application/feed+json") {
+		return true
+	}
+	b := bytes.TrimSpace(bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")))
+	return len(b) > 0 && b[0] == '{'
+}
+
+func parseJSONFeed(c context.Context, body []byte) (*Feed, []*Story, error) {
+	var f Feed
+	var s []*Story
+	j := jsonfeed.Feed{}
+	body = bytes.TrimPrefix(body, []byte("\xef\xbb\xbf"))
+	if err := json.Unmarshal(body, &j); err != nil {
+		return nil, nil, err
+	}
+	if !j.Valid() {
+		return nil, nil, fmt.Errorf("unknown json feed version: %q", j.Version)
+	}
+	f.Title = j.Title
+	f.Link = j.HomePageURL
+	f.Hub = j.Hub()
+	f.Language = j.Language
+	if len(j.Authors) > 0 && j.Authors[0] != nil {
+		f.Author = Person{Name: j.Authors[0].Name, Uri: j.Authors[0].URL}
+	} else if j.Author != nil {
+		f.Author = Person{Name: j.Author.Name, Uri: j.Author.URL}
+	}
+	f.ArchiveLink = j.NextURL
+
+	for _, i := range j.Items {
+		st := Story{
+			Id:       i.ID,
+			Title:    i.Title,
+			Link:     i.URL,
+			Summary:  i.Summary,
+			Language: i.Language,
+		}
+		if st.Link == "" {
+			st.Link = i.ExternalURL
+		}
+		if i.ContentHTML != "" {
+			st.content = i.ContentHTML
+		} else if i.ContentText != "" {
+			st.content = html.EscapeString(i.ContentText)
+		} else if i.Summary != "" {
+			st.content = html.EscapeString(i.Summary)
+		}
+		for _, a := range i.AllAuthors() {
+			if a != nil {
+				addAuthor(&st, Person{Name: a.Name, Uri: a.URL})
+			}
+		}
+		st.Author = authorNames(&st)
+		for _, tag := range i.Tags {
+			addCategory(&st, tag)
+		}
+		if i.Image != "" {
+			st.Thumbnail = i.Image
+		} else {
+			st.Thumbnail = i.BannerImage
+		}
+		for _, a := range i.Attachments {
+			if a == nil {
+				continue
+			}
+			addEnclosure(&st, a.URL, a.MimeType, a.SizeInBytes)
+			if st.Duration == 0 {
+				st.Duration = int64(a.DurationInSeconds)
+			}
+		}
+		if t, err := parseDate(c, &st.dateFailures, i.DatePublished); err == nil {
+			st.Published = t
+		}
+		if t, err := parseDate(c, &st.dateFailures, i.DateModified); err == nil {
+			st.Updated = t
+		}
+		s = append(s, &st)
+	}
+	return &f, s, nil
+}
+
 func parseAtom(c context.Context, body []byte, charsetReader func(string, io.Reader) (io.Reader, error)) (*Feed, []*Story, error) {
 	var f Feed
 	var s []*Story
@@ -433,7 +351,11 @@ func parseAtom(c context.Context, body []byte, charsetReader func(string, io.Rea
 		return nil, nil, err
 	}
 	f.Title = a.Title
-	if t, err := parseDate(c, &f, string(a.Updated)); err == nil {
+	if a.Author != nil {
+		f.Author = atomPerson(a.Author, false)
+	}
+	f.Language = a.Lang
+	if t, err := parseDate(c, &f.dateFailures, string(a.Updated)); err == nil {
 		f.Updated = t
 	}
 
@@ -451,6 +373,12 @@ func parseAtom(c context.Context, body []byte, charsetReader func(string, io.Rea
 				break
 			}
 		}
+		f.ArchiveLink = archiveLink(len(a.Link), func(i int) (string, string) {
+			return a.Link[i].Rel, a.Link[i].Href
+		})
+		if l, err := fb.Parse(f.ArchiveLink); err == nil && f.ArchiveLink != "" {
+			f.ArchiveLink = l.String()
+		}
 	}
 
 	for _, i := range a.Entry {
@@ -458,13 +386,14 @@ func parseAtom(c context.Context, body []byte, charsetReader func(string, io.Rea
 			eb = fb
 		}
 		st := Story{
-			Id:    i.ID,
-			Title: atomTitle(i.Title),
+			Id:       i.ID,
+			Title:    atomTitle(i.Title),
+			Language: i.Lang,
 		}
-		if t, err := parseDate(c, &f, string(i.Updated)); err == nil {
+		if t, err := parseDate(c, &st.dateFailures, string(i.Updated)); err == nil {
 			st.Updated = t
 		}
-		if t, err := parseDate(c, &f, string(i.Published)); err == nil {
+		if t, err := parseDate(c, &st.dateFailures, string(i.Published)); err == nil {
 			st.Published = t
 		}
 		if len(i.Link) > 0 {
@@ -473,14 +402,78 @@ func parseAtom(c context.Context, body []byte, charsetReader func(string, io.Rea
 				st.Link = l.String()
 			}
 		}
-		if i.Author != nil {
-			st.Author = i.Author.Name
+		authors := i.Authors
+		if len(authors) == 0 && a.Author != nil {
+			authors = []*atom.Person{a.Author}
+		}
+		for _, p := range authors {
+			if p != nil {
+				addAuthor(&st, atomPerson(p, false))
+			}
 		}
-		if i.Content != nil {
-			if len(strings.TrimSpace(i.Content.Body)) != 0 {
-				st.content = i.Content.Body
-			} else if len(i.Content.InnerXML) != 0 {
-				st.content = i.Content.InnerXML
+		for _, p := range i.Contributors {
+			if p != nil {
+				addAuthor(&st, atomPerson(p, true))
+			}
+		}
+		st.Author = authorNames(&st)
+		for _, l := range i.Link {
+			if l.Rel == "enclosure" {
+				if u, err := eb.Parse(l.Href); err == nil {
+					addEnclosure(&st, u.String(), l.Type, parseLength(l.Length))
+				}
+			}
+		}
+		var image, chapters string
+		if i.ItunesImage != nil {
+			image = i.ItunesImage.Href
+		}
+		if i.Chapters != nil {
+			chapters = i.Chapters.Url
+		}
+		setPodcast(&st, i.ItunesDuration, image, i.ItunesEpisode, i.ItunesSeason, i.ItunesExplicit, chapters)
+		for _, t := range i.Transcripts {
+			if t != nil {
+				addTranscript(&st, t.Url, t.Type, t.Language)
+			}
+		}
+		st.Thumbnail = atomThumbnail(i)
+		for _, l := range i.Link {
+			if l.Rel != "replies" {
+				continue
+			}
+			href := l.Href
+			if u, err := eb.Parse(l.Href); err == nil {
+				href = u.String()
+			}
+			if strings.Contains(l.Type, "html") {
+				st.CommentsLink = href
+			} else {
+				st.CommentsFeed = href
+			}
+			if n, err := strconv.Atoi(strings.TrimSpace(l.Count)); err == nil && n > st.CommentCount {
+				st.CommentCount = n
+			}
+		}
+		if n, err := strconv.Atoi(strings.TrimSpace(i.Total)); err == nil {
+			st.CommentCount = n
+		}
+		if len(i.InReplyTo) > 0 {
+			st.InReplyTo = i.InReplyTo[0].Ref
+		}
+		for _, cat := range i.Categories {
+			if cat != nil {
+				addCategory(&st, cat.Name())
+			}
+		}
+		for _, sub := range i.Subjects {
+			addCategory(&st, sub)
+		}
+		if content := i.Content(); content != nil {
+			if len(strings.TrimSpace(content.Body)) != 0 {
+				st.content = content.Body
+			} else if len(content.InnerXML) != 0 {
+				st.content = content.InnerXML
 			}
 		} else if i.Summary != nil {
 			st.content = i.Summary.Body
@@ -501,19 +494,40 @@ func parseRSS(c context.Context, body []byte, charsetReader func(string, io.Read
 		return nil, nil, err
 	}
 	f.Title = r.Title
-	if t, err := parseDate(c, &f, r.LastBuildDate, r.PubDate); err == nil {
+	if t, err := parseDate(c, &f.dateFailures, r.LastBuildDate, r.PubDate); err == nil {
 		f.Updated = t
 	} else {
 		log.Warningf(c, "no rss feed date: %v", f.Link)
 	}
 	f.Link = r.BaseLink()
 	f.Hub = r.Hub()
+	f.Language = r.Language
+	f.ArchiveLink = archiveLink(len(r.Link), func(i int) (string, string) {
+		return r.Link[i].Rel, r.Link[i].Href
+	})
+	f.TTL = r.TTLDuration()
+	f.UpdatePeriod = r.SyInterval()
+	f.UpdateBase = r.SyBase()
+	f.SkipHours = r.SkipHourList()
+	for _, d := range r.SkipDayList() {
+		f.SkipDays = append(f.SkipDays, int(d))
+	}
 
 	for _, i := range r.Items {
 		st := Story{
-			Link:   i.Link,
-			Author: i.Author,
+			Link:     i.Link,
+			Language: i.Language,
+		}
+		if i.Author != "" {
+			addAuthor(&st, rssPerson(i.Author))
+		}
+		for _, a := range i.Creators {
+			addAuthor(&st, Person{Name: a})
 		}
+		for _, a := range i.Contributors {
+			addAuthor(&st, Person{Name: a, Contributor: true})
+		}
+		st.Author = authorNames(&st)
 		if i.Content != "" {
 			st.content = i.Content
 		} else if i.Description != "" {
@@ -531,12 +545,44 @@ func parseRSS(c context.Context, body []byte, charsetReader func(string, io.Read
 		if i.Guid != nil {
 			st.Id = i.Guid.Guid
 		}
-		if i.Enclosure != nil && strings.HasPrefix(i.Enclosure.Type, "audio/") {
-			st.MediaContent = i.Enclosure.Url
-		} else if i.Media != nil && strings.HasPrefix(i.Media.Type, "audio/") {
-			st.MediaContent = i.Media.URL
+		for _, e := range i.Enclosures {
+			if e != nil {
+				addEnclosure(&st, e.Url, e.Type, parseLength(e.Length))
+			}
+		}
+		for _, m := range i.Media {
+			if m != nil && strings.HasPrefix(m.Type, "audio/") {
+				addEnclosure(&st, m.URL, m.Type, 0)
+			}
+		}
+		st.Thumbnail = rssThumbnail(i)
+		st.CommentsLink = strings.TrimSpace(i.Comments)
+		st.CommentsFeed = strings.TrimSpace(i.CommentRss)
+		st.CommentCount, _ = strconv.Atoi(strings.TrimSpace(i.SlashComments))
+		for _, cat := range i.Categories {
+			if cat != nil {
+				addCategory(&st, cat.Category)
+			}
+		}
+		for _, sub := range i.Subjects {
+			addCategory(&st, sub)
+		}
+		var image, chapters string
+		if i.ItunesImage != nil {
+			image = i.ItunesImage.Href
+		} else if r.ItunesImage != nil {
+			image = r.ItunesImage.Href
+		}
+		if i.Chapters != nil {
+			chapters = i.Chapters.Url
 		}
-		if t, err := parseDate(c, &f, i.PubDate, i.Date, i.Published); err == nil {
+		setPodcast(&st, i.ItunesDuration, image, i.ItunesEpisode, i.ItunesSeason, i.ItunesExplicit, chapters)
+		for _, t := range i.Transcripts {
+			if t != nil {
+				addTranscript(&st, t.Url, t.Type, t.Language)
+			}
+		}
+		if t, err := parseDate(c, &st.dateFailures, i.PubDate, i.Date, i.Published); err == nil {
 			st.Published = t
 			st.Updated = t
 		}
@@ -558,24 +604,32 @@ func parseRDF(c context.Context, body []byte, charsetReader func(string, io.Read
 	if rd.Channel != nil {
 		f.Title = rd.Channel.Title
 		f.Link = rd.Channel.Link
-		if t, err := parseDate(c, &f, rd.Channel.Date); err == nil {
+		f.Language = rd.Channel.Language
+		if t, err := parseDate(c, &f.dateFailures, rd.Channel.Date); err == nil {
 			f.Updated = t
 		}
 	}
 
 	for _, i := range rd.Item {
 		st := Story{
-			Id:     i.About,
-			Title:  textTitle(i.Title),
-			Link:   i.Link,
-			Author: i.Creator,
+			Id:       i.About,
+			Title:    textTitle(i.Title),
+			Link:     i.Link,
+			Language: i.Language,
+		}
+		for _, a := range i.Creators {
+			addAuthor(&st, Person{Name: a})
+		}
+		st.Author = authorNames(&st)
+		for _, sub := range i.Subjects {
+			addCategory(&st, sub)
 		}
 		if len(i.Description) > 0 {
 			st.content = html.UnescapeString(i.Description)
 		} else if len(i.Content) > 0 {
 			st.content = html.UnescapeString(i.Content)
 		}
-		if t, err := parseDate(c, &f, i.Date); err == nil {
+		if t, err := parseDate(c, &st.dateFailures, i.Date); err == nil {
 			st.Published = t
 			st.Updated = t
 		}
@@ -584,6 +638,36 @@ func parseRDF(c context.Context, body []byte, charsetReader func(string, io.Read
 	return &f, s, nil
 }
 
+const (
+	maxCategories   = 20
+	maxCategorySize = 100
+)
+
+// categoryKey normalizes a category for the ck index.
+func categoryKey(cat string) string {
+	return strings.ToLower(strings.TrimSpace(cat))
+}
+
+// addCategory adds cat to st's categories unless it is empty or already
+// present, ignoring case.
+func addCategory(st *Story, cat string) {
+	cat = strings.TrimSpace(html.UnescapeString(cat))
+	if cat == "" || len(st.Categories) >= maxCategories {
+		return
+	}
+	if len(cat) > maxCategorySize {
+		return
+	}
+	key := categoryKey(cat)
+	for _, k := range st.CategoryKeys {
+		if k == key {
+			return
+		}
+	}
+	st.Categories = append(st.Categories, cat)
+	st.CategoryKeys = append(st.CategoryKeys, key)
+}
+
 func textTitle(t string) string {
 	return html.UnescapeString(t)
 }
@@ -630,9 +714,7 @@ func findBestAtomLink(c context.Context, links []atom.Link) string {
 }
 
 func parseFix(c context.Context, f *Feed, ss []*Story, fetchUrl string) (*Feed, []*Story, error) {
-	g := goon.FromContext(c)
 	f.Checked = time.Now()
-	fk := g.Key(f)
 	f.Link = strings.TrimSpace(f.Link)
 	f.Title = html.UnescapeString(strings.TrimSpace(f.Title))
 
@@ -645,10 +727,12 @@ func parseFix(c context.Context, f *Feed, ss []*Story, fetchUrl string) (*Feed,
 	if err != nil {
 		log.Warningf(c, "unable to parse link: %v", f.Link)
 	}
+	f.Language = lang.Normalize(f.Language)
+	detected := make(map[string]int)
 
 	var nss []*Story
 	for _, s := range ss {
-		s.Parent = fk
+		s.Feed = f.Url
 		s.Created = f.Checked
 		s.Link = strings.TrimSpace(s.Link)
 		if !s.Updated.IsZero() && s.Published.IsZero() {
@@ -689,9 +773,17 @@ func parseFix(c context.Context, f *Feed, ss []*Story, fetchUrl string) (*Feed,
 				log.Warningf(c, "unable to resolve link: %v", s.Link)
 			}
 		}
+		if base != nil {
+			if l, err := base.Parse(s.CommentsLink); err == nil && s.CommentsLink != "" {
+				s.CommentsLink = l.String()
+			}
+			if l, err := base.Parse(s.CommentsFeed); err == nil && s.CommentsFeed != "" {
+				s.CommentsFeed = l.String()
+			}
+		}
+		// datastore keys are limited to 500 bytes: "/F,<url>/S,<id>"
 		const keySize = 500
-		sk := g.Key(s)
-		if kl := len(sk.String()); kl > keySize {
+		if kl := len(f.Url) + len(s.Id) + 6; kl > keySize {
 			log.Warningf(c, "key too long: %v, %v, %v", kl, f.Url, s.Id)
 			continue
 		}
@@ -701,51 +793,47 @@ func parseFix(c context.Context, f *Feed, ss []*Story, fetchUrl string) (*Feed,
 			s.Link = ""
 		}
 		const snipLen = 100
-		s.content, s.Summary = sanitizer.Sanitize(s.content, su)
+		var text, img string
+		s.content, text, img = sanitizer.SanitizeImage(s.content, su)
+		if s.Summary == "" {
+			s.Summary = text
+		}
+		if s.Thumbnail == "" {
+			s.Thumbnail = enclosureImage(s)
+		}
+		if s.Thumbnail == "" {
+			s.Thumbnail = img
+		} else if su != nil {
+			if t, err := su.Parse(s.Thumbnail); err == nil {
+				s.Thumbnail = t.String()
+			}
+		}
+		s.Language = lang.Normalize(s.Language)
+		if s.Language == "" {
+			s.Language = f.Language
+		}
+		if s.Language == "" {
+			s.Language = lang.Detect(s.Title + "\n" + text)
+			if s.Language != "" {
+				detected[s.Language]++
+			}
+		}
+		s.Dir = lang.Dir(s.Language)
 		s.Summary = sanitizer.SnipText(s.Summary, snipLen)
 		nss = append(nss, s)
 	}
-
-	return f, nss, nil
-}
-
-func loadImage(c context.Context, f *Feed) {
-	if f.ImageDate.After(time.Now()) {
-		return
-	}
-	f.ImageDate = time.Now().Add(time.Hour * 24 * 7)
-	s := f.Link
-	if s == "" {
-		s = f.Url
-	}
-	u, err := url.Parse(s)
-	if err != nil {
-		return
-	}
-	u.RawQuery = ""
-	u.Fragment = ""
-	p := "/favicon.ico"
-	client := urlfetch.Client(c)
-	if r, err := client.Get(u.String()); err == nil {
-		b, err := ioutil.ReadAll(r.Body)
-		r.Body.Close()
-		if err == nil {
-			i, err := FindIcon(b)
-			if err == nil {
-				p = i
+	if f.Language == "" {
+		// the feed is probably in the language most stories are in
+		n := 0
+		for l, c := range detected {
+			if c > n || (c == n && l < f.Language) {
+				f.Language, n = l, c
 			}
 		}
 	}
-	u, err = u.Parse(p)
-	if err != nil {
-		return
-	}
-	us := u.String()
-	r, err := client.Get(us)
-	if err != nil || r.StatusCode != http.StatusOK || r.ContentLength == 0 {
-		us = ""
-	}
-	f.Image = us
+	f.Dir = lang.Dir(f.Language)
+
+	return f, nss, nil
 }
 
 func updateAverage(f *Feed, previousUpdate time.Time, updateCount int) {
@@ -777,7 +865,7 @@ func scheduleNextUpdate(c context.Context, f *Feed) {
 
 	now := time.Now()
 	if f.Date.IsZero() {
-		f.NextUpdate = now.Add(UpdateDefault)
+		f.NextUpdate = applyUpdateHints(f, now, now.Add(UpdateDefault))
 		return
 	}
 
@@ -812,7 +900,60 @@ func scheduleNextUpdate(c context.Context, f *Feed) {
 	} else {
 		pause -= jitter
 	}
-	f.NextUpdate = time.Now().Add(pause)
+	f.NextUpdate = applyUpdateHints(f, now, now.Add(pause))
+}
+
+// Publisher hints can slow polling down to at most once a day.
+const updateHintMax = time.Hour * 24
+
+// applyUpdateHints adjusts next, the computed next update of f, to the
+// publisher's hints: ttl and sy:updatePeriod are lower bounds on the
+// interval, sy:updateBase aligns updates to the period, and skipHours and
+// skipDays are windows during which the feed is not polled.
+func applyUpdateHints(f *Feed, now, next time.Time) time.Time {
+	min := f.TTL
+	if f.UpdatePeriod > min {
+		min = f.UpdatePeriod
+	}
+	if min > updateHintMax {
+		min = updateHintMax
+	}
+	if t := now.Add(min); next.Before(t) {
+		next = t
+	}
+	// bases before 1970 are bogus and overflow the Sub
+	if p := f.UpdatePeriod; p > 0 && p <= updateHintMax && !f.UpdateBase.Before(time.Unix(0, 0)) && next.After(f.UpdateBase) {
+		if d := next.Sub(f.UpdateBase) % p; d > 0 {
+			next = next.Add(p - d)
+		}
+	}
+	if len(f.SkipHours) == 0 && len(f.SkipDays) == 0 {
+		return next
+	}
+	skipped := func(t time.Time) bool {
+		t = t.UTC()
+		for _, h := range f.SkipHours {
+			if t.Hour() == h {
+				return true
+			}
+		}
+		for _, d := range f.SkipDays {
+			if int(t.Weekday()) == d {
+				return true
+			}
+		}
+		return false
+	}
+	// step to the end of blackout hours, giving up if the whole week is
+	// blacked out
+	t := next
+	for i := 0; i < 24*7 && skipped(t); i++ {
+		t = t.UTC().Truncate(time.Hour).Add(time.Hour)
+	}
+	if skipped(t) {
+		return next
+	}
+	return t
 }
 
 func taskSender(c context.Context, queue string, tc chan *taskqueue.Task, done chan bool) {
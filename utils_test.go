@@ -0,0 +1,70 @@
+/*
+ * Copyright (c) 2013 Matt Jibson <matt.jibson@gmail.com>
+ *
+ * Permission to use, copy, modify, and distribute this software for any
+ * purpose with or without fee is hereby granted, provided that the above
+ * copyright notice and this permission notice appear in all copies.
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package goread
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseAtomRepliesBase(t *testing.T) {
+	const body = `<feed xmlns="http://www.w3.org/2005/Atom" xml:base="http://example.com/blog/">
+<title>t</title>
+<entry xml:base="posts/1/">
+<id>1</id>
+<title>one</title>
+<link rel="replies" type="text/html" href="comments" thr:count="2" xmlns:thr="http://purl.org/syndication/thread/1.0"/>
+<link rel="replies" type="application/atom+xml" href="comments.xml"/>
+</entry>
+</feed>`
+	_, stories, err := parseAtom(context.Background(), []byte(body), nil)
+	if err != nil || len(stories) != 1 {
+		t.Fatal(stories, err)
+	}
+	s := stories[0]
+	if s.CommentsLink != "http://example.com/blog/posts/1/comments" {
+		t.Errorf("comments link: %v", s.CommentsLink)
+	}
+	if s.CommentsFeed != "http://example.com/blog/posts/1/comments.xml" {
+		t.Errorf("comments feed: %v", s.CommentsFeed)
+	}
+	if s.CommentCount != 2 {
+		t.Errorf("comment count: %v", s.CommentCount)
+	}
+}
+
+func TestApplyUpdateHintsBase(t *testing.T) {
+	now := time.Date(2020, 6, 1, 10, 7, 0, 0, time.UTC)
+	tests := []struct {
+		base time.Time
+		want time.Time
+	}{
+		{time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2020, 6, 1, 14, 0, 0, 0, time.UTC)},
+		{time.Date(2020, 6, 1, 10, 27, 0, 0, time.UTC), time.Date(2020, 6, 1, 12, 27, 0, 0, time.UTC)},
+		{time.Date(2020, 6, 1, 12, 7, 0, 0, time.UTC), now.Add(time.Hour * 2)},
+		// implausible bases are ignored
+		{time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC), now.Add(time.Hour * 2)},
+		{time.Date(1000, 1, 1, 0, 0, 0, 0, time.UTC), now.Add(time.Hour * 2)},
+	}
+	for _, test := range tests {
+		f := &Feed{UpdatePeriod: time.Hour * 2, UpdateBase: test.base}
+		if got := applyUpdateHints(f, now, now.Add(time.Minute*20)); !got.Equal(test.want) {
+			t.Errorf("%v: got %v, want %v", test.base, got, test.want)
+		}
+	}
+}